@@ -0,0 +1,289 @@
+package gitolite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Push describes a push to check: the ref it updates and the files it changes
+type Push struct {
+	Ref string
+	// Perm is the permission needed: "W" for a fast-forward, "+" for a rewind,
+	// "C" to create or "D" to delete the ref. Empty means "W".
+	Perm     string
+	Files    []string
+	NewFiles []string
+	// BinSizes are the sizes of the new binary files of the push, by path
+	BinSizes map[string]int64
+}
+
+// RulesForRepo returns the rules applying to a repo, in the order they are
+// declared, including rules of configs for a group containing the repo, or @all,
+// then the rules of the subconfs included by the config (see AddChild).
+// Use the Merged config for the rules in the order gitolite applies them.
+func (gtl *Gitolite) RulesForRepo(reponame string) []*Rule {
+	res := []*Rule{}
+	for _, config := range gtl.configsApplyingTo(reponame) {
+		res = append(res, config.rules...)
+	}
+	return res
+}
+
+func (gtl *Gitolite) configsApplyingTo(reponame string) []*Config {
+	res := []*Config{}
+	for _, config := range gtl.configs {
+		for _, rog := range config.reposOrGroups {
+			if rog.GetName() == reponame || rog.GetName() == "@all" ||
+				(rog.Group() != nil && rog.Group().hasRepoOrGroup(reponame)) {
+				res = append(res, config)
+				break
+			}
+		}
+	}
+	for _, child := range gtl.children {
+		res = append(res, child.configsApplyingTo(reponame)...)
+	}
+	return res
+}
+
+// AppliesTo checks if a rule references a user, directly, through @all,
+// or through a user group (including groups of groups).
+func (rule *Rule) AppliesTo(username string) bool {
+	for _, uog := range rule.usersOrGroups {
+		if uog.GetName() == username || uog.GetName() == "@all" {
+			return true
+		}
+		if uog.Group() != nil {
+			for _, usr := range uog.Group().GetAllUsers() {
+				if usr.GetName() == username {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// appliesTo checks if a rule references a user like Rule.AppliesTo,
+// with the users of its groups as returned by RuleUsers.
+func (gtl *Gitolite) appliesTo(rule *Rule, username string) bool {
+	for _, uog := range rule.usersOrGroups {
+		if uog.GetName() == username || uog.GetName() == "@all" {
+			return true
+		}
+		if uog.Group() != nil {
+			for _, usr := range gtl.GroupUsers(uog.Group()) {
+				if usr.GetName() == username {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// MatchesRef checks if the refex of a (non VREF) rule matches a ref.
+// Like gitolite, an empty refex matches any ref, a refex not starting
+// with 'refs/' is a branch ('refs/heads/' is prepended), and refexes are
+// regexps anchored at the start.
+func (rule *Rule) MatchesRef(ref string) bool {
+	if IsVREF(rule.param) {
+		return false
+	}
+	if rule.param == "" {
+		return true
+	}
+	refex := rule.param
+	if !strings.HasPrefix(refex, "refs/") {
+		refex = "refs/heads/" + refex
+	}
+	rx, err := regexp.Compile("^" + refex)
+	if err != nil {
+		return strings.HasPrefix(ref, refex)
+	}
+	return rx.MatchString(ref)
+}
+
+func (gtl *Gitolite) userRulesForRepo(username, reponame string) []*Rule {
+	res := []*Rule{}
+	for _, rule := range gtl.RulesForRepo(reponame) {
+		if gtl.appliesTo(rule, username) {
+			res = append(res, rule)
+		}
+	}
+	return res
+}
+
+func (gtl *Gitolite) hasDenyRules(reponame string) bool {
+	for _, config := range gtl.configsApplyingTo(reponame) {
+		if config.Option("deny-rules") == "1" {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesGrant checks if a rule applying to a repo, for any user, grants a permission
+func (gtl *Gitolite) rulesGrant(reponame, perm string) bool {
+	for _, rule := range gtl.RulesForRepo(reponame) {
+		if !IsVREF(rule.param) && strings.Contains(rule.access, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+func denied(perm, ref, reponame, username, by string) error {
+	return fmt.Errorf("%v %v %v %v DENIED by %v", perm, ref, reponame, username, by)
+}
+
+// CheckAccess checks if a user has a permission ("R", "W", "+", "C" or "D")
+// on a ref of a repo, returning nil if allowed, or the reason of the denial.
+// The first rule matching the ref which either grants the permission or is
+// a '-' rule decides. For "R", the ref is ignored (gitolite checks the ref
+// 'any', matched by any refex) and '-' rules only apply with
+// 'option deny-rules = 1'.
+// Like gitolite, "C" and "D" are only checked if a rule of the repo grants
+// them: otherwise, creating a ref needs "W", and deleting it needs "+".
+func (gtl *Gitolite) CheckAccess(username, reponame, ref, perm string) error {
+	if perm == "R" {
+		ref = "any"
+	}
+	need := perm
+	if perm == "C" && !gtl.rulesGrant(reponame, "C") {
+		need = "W"
+	}
+	if perm == "D" && !gtl.rulesGrant(reponame, "D") {
+		need = "+"
+	}
+	denyRules := perm != "R" || gtl.hasDenyRules(reponame)
+	for _, rule := range gtl.userRulesForRepo(username, reponame) {
+		if IsVREF(rule.param) || (perm != "R" && !rule.MatchesRef(ref)) {
+			continue
+		}
+		if rule.access == "-" {
+			if denyRules {
+				return denied(perm, ref, reponame, username, "rule '"+strings.TrimSpace(rule.access+" "+rule.param)+"'")
+			}
+			continue
+		}
+		if strings.Contains(rule.access, need) {
+			return nil
+		}
+	}
+	return denied(perm, ref, reponame, username, "fallthru")
+}
+
+// Permission returns the strongest permission of a user on a repo: "RW+"
+// (rewind some ref), "RW" (write some ref), "R" (read only), or "" if the
+// user can't read the repo. Once a '-' rule without refex applies, which
+// denies writing any ref, later rules only grant read access.
+func (gtl *Gitolite) Permission(username, reponame string) string {
+	return gtl.Permissions(reponame, []string{username})[0]
+}
+
+// Permissions returns the permission of each user on a repo (see Permission),
+// collecting the rules applying to the repo once.
+func (gtl *Gitolite) Permissions(reponame string, usernames []string) []string {
+	rules := gtl.RulesForRepo(reponame)
+	denyRules := gtl.hasDenyRules(reponame)
+	userSets := []map[string]bool{}
+	for _, rule := range rules {
+		userSets = append(userSets, gtl.ruleUserSet(rule))
+	}
+	res := make([]string, len(usernames))
+	for i, username := range usernames {
+		userRules := []*Rule{}
+		for j, rule := range rules {
+			if userSets[j][username] || userSets[j]["@all"] {
+				userRules = append(userRules, rule)
+			}
+		}
+		res[i] = permission(userRules, denyRules)
+	}
+	return res
+}
+
+// ruleUserSet returns the names a rule applies to (see appliesTo):
+// its users and groups, and the users of its groups.
+func (gtl *Gitolite) ruleUserSet(rule *Rule) map[string]bool {
+	res := make(map[string]bool)
+	for _, uog := range rule.usersOrGroups {
+		res[uog.GetName()] = true
+		if uog.Group() != nil {
+			for _, usr := range gtl.GroupUsers(uog.Group()) {
+				res[usr.GetName()] = true
+			}
+		}
+	}
+	return res
+}
+
+func permission(rules []*Rule, denyRules bool) string {
+	res, denied := "", false
+	for _, rule := range rules {
+		switch {
+		case IsVREF(rule.param):
+		case rule.access == "-":
+			if res == "" && denyRules {
+				return ""
+			}
+			if rule.param == "" {
+				denied = true
+			}
+		case denied || !strings.Contains(rule.access, "W"):
+			if res == "" {
+				res = "R"
+			}
+		case strings.Contains(rule.access, "+"):
+			return "RW+"
+		default:
+			res = "RW"
+		}
+	}
+	return res
+}
+
+// CheckPush checks if a user can push to a repo: the user must have the
+// push permission on the ref, and the push must not trigger a '-' VREF rule.
+// VREF rules are checked in order, the first one matching a changed file
+// (NAME), or triggered by the push (COUNT, MAX_NEWBIN_SIZE) decides, and
+// unlike refs, a push matching no VREF rule is allowed.
+// Custom VREFs are ignored.
+func (gtl *Gitolite) CheckPush(username, reponame string, push *Push) error {
+	perm := push.Perm
+	if perm == "" {
+		perm = "W"
+	}
+	if err := gtl.CheckAccess(username, reponame, push.Ref, perm); err != nil {
+		return err
+	}
+	rules := []*Rule{}
+	for _, rule := range gtl.userRulesForRepo(username, reponame) {
+		if rule.vref != nil {
+			rules = append(rules, rule)
+		}
+	}
+	for _, file := range push.Files {
+		for _, rule := range rules {
+			if rule.vref.MatchesPath(file) {
+				if rule.access == "-" {
+					return denied(perm, "VREF/NAME/"+file, reponame, username, "rule '"+strings.TrimSpace(rule.access+" "+rule.param)+"'")
+				}
+				break
+			}
+		}
+	}
+	decided := make(map[string]bool)
+	for _, rule := range rules {
+		if decided[rule.param] || !rule.vref.Triggered(push) {
+			continue
+		}
+		decided[rule.param] = true
+		if rule.access == "-" {
+			return denied(perm, rule.param, reponame, username, "rule '"+strings.TrimSpace(rule.access+" "+rule.param)+"'")
+		}
+	}
+	return nil
+}
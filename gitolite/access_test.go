@@ -0,0 +1,161 @@
+package gitolite
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func addRule(gtl *Gitolite, cfg *Config, access, param string, users ...string) {
+	rule := NewRule(access, param, nil)
+	for _, user := range users {
+		gtl.AddUserOrGroupToRule(rule, user)
+	}
+	gtl.AddRuleToConfig(rule, cfg)
+}
+
+func TestAccess(t *testing.T) {
+
+	Convey("Refex are matched like gitolite does", t, func() {
+		So(NewRule("RW", "", nil).MatchesRef("refs/tags/v1"), ShouldBeTrue)
+		So(NewRule("RW", "master", nil).MatchesRef("refs/heads/master"), ShouldBeTrue)
+		So(NewRule("RW", "master", nil).MatchesRef("refs/heads/master2"), ShouldBeTrue)
+		So(NewRule("RW", "master$", nil).MatchesRef("refs/heads/master2"), ShouldBeFalse)
+		So(NewRule("RW", "master", nil).MatchesRef("refs/tags/master"), ShouldBeFalse)
+		So(NewRule("RW", "refs/tags/v[0-9]", nil).MatchesRef("refs/tags/v1"), ShouldBeTrue)
+		So(NewRule("RW", "refs/tags/v(", nil).MatchesRef("refs/tags/v(1"), ShouldBeTrue)
+		So(NewRule("RW", "VREF/NAME/", nil).MatchesRef("refs/heads/master"), ShouldBeFalse)
+	})
+
+	Convey("Access to refs is evaluated in rule order", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice", "bob"}, nil)
+		gtl.AddUserOrRepoGroup("@all-devs", []string{"@devs", "carol"}, nil)
+		cfg, _ := gtl.AddConfig([]string{"foo"}, nil)
+		addRule(gtl, cfg, "RW+", "dev/", "alice")
+		addRule(gtl, cfg, "-", "master", "bob")
+		addRule(gtl, cfg, "RW", "", "@all-devs")
+		addRule(gtl, cfg, "R", "", "dave")
+		all, _ := gtl.AddConfig([]string{"@all"}, nil)
+		addRule(gtl, all, "R", "", "gitweb")
+
+		So(len(gtl.RulesForRepo("foo")), ShouldEqual, 5)
+		So(len(gtl.RulesForRepo("bar")), ShouldEqual, 1)
+		So(gtl.Configs()[0].Rules()[2].AppliesTo("alice"), ShouldBeTrue)
+		So(gtl.Configs()[0].Rules()[2].AppliesTo("dave"), ShouldBeFalse)
+
+		So(gtl.CheckAccess("alice", "foo", "refs/heads/dev/x", "+"), ShouldBeNil)
+		So(gtl.CheckAccess("alice", "foo", "refs/heads/master", "W"), ShouldBeNil)
+		So(gtl.CheckAccess("alice", "foo", "refs/heads/master", "+").Error(), ShouldEqual, "+ refs/heads/master foo alice DENIED by fallthru")
+		So(gtl.CheckAccess("bob", "foo", "refs/heads/master", "W").Error(), ShouldEqual, "W refs/heads/master foo bob DENIED by rule '- master'")
+		So(gtl.CheckAccess("bob", "foo", "refs/heads/next", "W"), ShouldBeNil)
+		So(gtl.CheckAccess("bob", "foo", "", "R"), ShouldBeNil)
+		So(gtl.CheckAccess("carol", "foo", "refs/heads/master", "W"), ShouldBeNil)
+		So(gtl.CheckAccess("dave", "foo", "refs/heads/master", "W").Error(), ShouldEqual, "W refs/heads/master foo dave DENIED by fallthru")
+		So(gtl.CheckAccess("dave", "foo", "", "R"), ShouldBeNil)
+		So(gtl.CheckAccess("gitweb", "bar", "", "R"), ShouldBeNil)
+		So(gtl.CheckAccess("alice", "bar", "", "R").Error(), ShouldEqual, "R any bar alice DENIED by fallthru")
+
+		sub := NewSubconf(gtl, "bar")
+		subcfg, _ := sub.AddConfig([]string{"bar"}, nil)
+		addRule(sub, subcfg, "RW", "", "alice")
+		gtl.AddChild(sub, "conf/bar.conf", nil)
+		So(len(gtl.RulesForRepo("bar")), ShouldEqual, 2)
+		So(gtl.CheckAccess("alice", "bar", "refs/heads/master", "W"), ShouldBeNil)
+	})
+
+	Convey("The permission of a user is the strongest one granted", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice", "bob"}, nil)
+		cfg, _ := gtl.AddConfig([]string{"foo"}, nil)
+		addRule(gtl, cfg, "R", "", "@devs", "carol")
+		addRule(gtl, cfg, "RW", "master", "@devs")
+		addRule(gtl, cfg, "-", "", "bob")
+		addRule(gtl, cfg, "RW+", "dev/", "@devs")
+		addRule(gtl, cfg, "RW+", "VREF/NAME/doc", "carol")
+		So(gtl.Permission("alice", "foo"), ShouldEqual, "RW+")
+		So(gtl.Permission("bob", "foo"), ShouldEqual, "RW")
+		So(gtl.Permission("carol", "foo"), ShouldEqual, "R")
+		So(gtl.Permission("dave", "foo"), ShouldEqual, "")
+		So(gtl.Permissions("foo", []string{"alice", "dave"}), ShouldResemble, []string{"RW+", ""})
+
+		deny, _ := gtl.AddConfig([]string{"bar"}, nil)
+		addRule(gtl, deny, "-", "", "bob")
+		addRule(gtl, deny, "RW", "", "@devs")
+		So(gtl.Permissions("bar", []string{"alice", "bob"}), ShouldResemble, []string{"RW", "R"})
+		gtl.AddGitConfig(deny, "deny-rules", "1", true, nil)
+		So(gtl.Permissions("bar", []string{"alice", "bob"}), ShouldResemble, []string{"RW", ""})
+	})
+
+	Convey("Read denials need the deny-rules option", t, func() {
+		gtl := NewGitolite(nil)
+		cfg, _ := gtl.AddConfig([]string{"foo"}, nil)
+		addRule(gtl, cfg, "-", "", "alice")
+		addRule(gtl, cfg, "R", "", "@all")
+		So(gtl.CheckAccess("alice", "foo", "", "R"), ShouldBeNil)
+		gtl.AddGitConfig(cfg, "deny-rules", "1", true, nil)
+		So(gtl.CheckAccess("alice", "foo", "", "R").Error(), ShouldEqual, "R any foo alice DENIED by rule '-'")
+		So(gtl.CheckAccess("bob", "foo", "", "R"), ShouldBeNil)
+
+		Convey("Whatever the refex of the '-' rule", func() {
+			bar, _ := gtl.AddConfig([]string{"bar"}, nil)
+			addRule(gtl, bar, "-", "refs/heads/secret", "bob")
+			addRule(gtl, bar, "R", "", "bob")
+			So(gtl.CheckAccess("bob", "bar", "", "R"), ShouldBeNil)
+			So(gtl.Permission("bob", "bar"), ShouldEqual, "R")
+			gtl.AddGitConfig(bar, "deny-rules", "1", true, nil)
+			So(gtl.CheckAccess("bob", "bar", "", "R").Error(), ShouldEqual, "R any bar bob DENIED by rule '- refs/heads/secret'")
+			So(gtl.Permission("bob", "bar"), ShouldEqual, "")
+		})
+	})
+
+	Convey("Creating or deleting refs needs C or D only if a rule of the repo grants it", t, func() {
+		gtl := NewGitolite(nil)
+		cfg, _ := gtl.AddConfig([]string{"foo"}, nil)
+		addRule(gtl, cfg, "RW", "", "alice")
+		addRule(gtl, cfg, "RW+", "", "bob")
+		So(gtl.CheckAccess("alice", "foo", "refs/heads/dev", "C"), ShouldBeNil)
+		So(gtl.CheckAccess("alice", "foo", "refs/heads/dev", "D").Error(), ShouldEqual, "D refs/heads/dev foo alice DENIED by fallthru")
+		So(gtl.CheckAccess("bob", "foo", "refs/heads/dev", "D"), ShouldBeNil)
+
+		bar, _ := gtl.AddConfig([]string{"bar"}, nil)
+		addRule(gtl, bar, "RW", "", "alice")
+		addRule(gtl, bar, "RW+", "", "bob")
+		addRule(gtl, bar, "RWC", "refs/tags/", "carol")
+		addRule(gtl, bar, "RW+D", "dev/", "dave")
+		So(gtl.CheckAccess("alice", "bar", "refs/heads/dev", "C").Error(), ShouldEqual, "C refs/heads/dev bar alice DENIED by fallthru")
+		So(gtl.CheckAccess("carol", "bar", "refs/tags/v1", "C"), ShouldBeNil)
+		So(gtl.CheckAccess("bob", "bar", "refs/heads/dev", "D").Error(), ShouldEqual, "D refs/heads/dev bar bob DENIED by fallthru")
+		So(gtl.CheckAccess("dave", "bar", "refs/heads/dev/x", "D"), ShouldBeNil)
+	})
+
+	Convey("Pushes are checked against VREF rules", t, func() {
+		gtl := NewGitolite(nil)
+		cfg, _ := gtl.AddConfig([]string{"gitolite-admin"}, nil)
+		addRule(gtl, cfg, "RW+", "", "admin")
+		addRule(gtl, cfg, "RW", "VREF/NAME/conf/subs/project", "alice")
+		addRule(gtl, cfg, "-", "VREF/NAME/", "alice")
+		addRule(gtl, cfg, "-", "VREF/COUNT/2/NEWFILES", "alice")
+		addRule(gtl, cfg, "-", "VREF/MAX_NEWBIN_SIZE/1000", "@all")
+		addRule(gtl, cfg, "-", "VREF/EMAIL-CHECK", "@all")
+		addRule(gtl, cfg, "RW", "master", "alice")
+
+		push := &Push{Ref: "refs/heads/master", Files: []string{"conf/subs/project.conf"}}
+		So(gtl.CheckPush("alice", "gitolite-admin", push), ShouldBeNil)
+		So(gtl.CheckPush("admin", "gitolite-admin", push), ShouldBeNil)
+
+		push.Files = append(push.Files, "conf/gitolite.conf")
+		So(gtl.CheckPush("alice", "gitolite-admin", push).Error(), ShouldEqual, "W VREF/NAME/conf/gitolite.conf gitolite-admin alice DENIED by rule '- VREF/NAME/'")
+		So(gtl.CheckPush("admin", "gitolite-admin", push), ShouldBeNil)
+
+		push = &Push{Ref: "refs/heads/master", Files: []string{"conf/subs/project.conf"}, NewFiles: []string{"a", "b", "c"}}
+		So(gtl.CheckPush("alice", "gitolite-admin", push).Error(), ShouldEqual, "W VREF/COUNT/2/NEWFILES gitolite-admin alice DENIED by rule '- VREF/COUNT/2/NEWFILES'")
+
+		push = &Push{Ref: "refs/heads/master", BinSizes: map[string]int64{"big.bin": 1001}}
+		So(gtl.CheckPush("admin", "gitolite-admin", push).Error(), ShouldEqual, "W VREF/MAX_NEWBIN_SIZE/1000 gitolite-admin admin DENIED by rule '- VREF/MAX_NEWBIN_SIZE/1000'")
+
+		push = &Push{Ref: "refs/heads/master", Perm: "+"}
+		So(gtl.CheckPush("alice", "gitolite-admin", push).Error(), ShouldEqual, "+ refs/heads/master gitolite-admin alice DENIED by fallthru")
+		So(gtl.CheckPush("admin", "gitolite-admin", push), ShouldBeNil)
+	})
+}
@@ -0,0 +1,281 @@
+package gitolite
+
+// Clone returns a deep copy of a config and its subconfs: groups, repos,
+// users, configs, rules and comments are copied, and reference each other
+// like the originals do, so the copy can be modified ("what if alice is
+// added to @devs") without changing the original.
+// The rc and the VREFs of the rules, read-only, are shared. For a subconf,
+// the configs including it, and their groups, are shared too.
+func (gtl *Gitolite) Clone() *Gitolite {
+	cl := &cloner{
+		gtls:     make(map[*Gitolite]*Gitolite),
+		groups:   make(map[*Group]*Group),
+		repos:    make(map[*Repo]*Repo),
+		users:    make(map[*User]*User),
+		configs:  make(map[*Config]*Config),
+		rules:    make(map[*Rule]*Rule),
+		cmts:     make(map[*Comment]*Comment),
+		subconfs: make(map[*Subconf]*Subconf),
+	}
+	cl.register(gtl)
+	cl.fill(gtl)
+	return cl.gtls[gtl]
+}
+
+// cloner copies each element of a config once, and keeps the copies by
+// original, to reference the copies instead of the originals.
+type cloner struct {
+	gtls     map[*Gitolite]*Gitolite
+	groups   map[*Group]*Group
+	repos    map[*Repo]*Repo
+	users    map[*User]*User
+	configs  map[*Config]*Config
+	rules    map[*Rule]*Rule
+	cmts     map[*Comment]*Comment
+	subconfs map[*Subconf]*Subconf
+}
+
+// register creates the copies of a config and its subconfs, filled afterwards:
+// the elements of the configs reference the configs.
+func (cl *cloner) register(gtl *Gitolite) {
+	cl.gtls[gtl] = &Gitolite{}
+	for _, child := range gtl.children {
+		cl.register(child)
+	}
+}
+
+func (cl *cloner) fill(gtl *Gitolite) {
+	res := cl.gtls[gtl]
+	res.parent = cl.gitolite(gtl.parent)
+	res.path = gtl.path
+	res.rc = gtl.rc
+	res.subconf = gtl.subconf
+	res.violations = append([]error{}, gtl.violations...)
+	if gtl.localGroups != nil {
+		res.localGroups = make(map[string]string)
+		for k, v := range gtl.localGroups {
+			res.localGroups[k] = v
+		}
+	}
+	for _, grp := range gtl.groups {
+		res.groups = append(res.groups, cl.group(grp))
+	}
+	for _, rog := range gtl.reposOrGroups {
+		res.reposOrGroups = append(res.reposOrGroups, cl.repoOrGroup(rog))
+	}
+	for _, uog := range gtl.usersOrGroups {
+		res.usersOrGroups = append(res.usersOrGroups, cl.userOrGroup(uog))
+	}
+	for _, config := range gtl.configs {
+		res.configs = append(res.configs, cl.config(config))
+	}
+	for _, subconf := range gtl.subconfs {
+		res.subconfs = append(res.subconfs, cl.subconf(subconf))
+	}
+	res.includedBy = gtl.includedBy
+	if res.parent != gtl.parent {
+		res.includedBy = cl.subconf(gtl.includedBy)
+	}
+	for _, elt := range gtl.elts {
+		switch e := elt.(type) {
+		case *Group:
+			res.elts = append(res.elts, cl.group(e))
+		case *Config:
+			res.elts = append(res.elts, cl.config(e))
+		default:
+			res.elts = append(res.elts, elt)
+		}
+	}
+	for _, grp := range gtl.parentGroups {
+		res.parentGroups = append(res.parentGroups, cl.group(grp))
+	}
+
+	res.groupIdx = make(map[string]int)
+	for name, i := range gtl.groupIdx {
+		res.groupIdx[name] = i
+	}
+	res.rogsByName = make(map[string]RepoOrGroup)
+	for name, rog := range gtl.rogsByName {
+		res.rogsByName[name] = cl.repoOrGroup(rog)
+	}
+	res.uogsByName = make(map[string]UserOrGroup)
+	for name, uog := range gtl.uogsByName {
+		res.uogsByName[name] = cl.userOrGroup(uog)
+	}
+	res.memberGroups = make(map[string][]*Group)
+	for member, grps := range gtl.memberGroups {
+		res.memberGroups[member] = cl.groupList(grps)
+	}
+	res.reposToConfigs = make(map[string][]int)
+	for name, idx := range gtl.reposToConfigs {
+		res.reposToConfigs[name] = append([]int{}, idx...)
+	}
+	res.groupConfigs = append([]int{}, gtl.groupConfigs...)
+
+	for _, child := range gtl.children {
+		cl.fill(child)
+		res.children = append(res.children, cl.gtls[child])
+	}
+}
+
+// gitolite returns the copy of a config, or the config itself if it isn't
+// copied (a config including the cloned one)
+func (cl *cloner) gitolite(gtl *Gitolite) *Gitolite {
+	if res, ok := cl.gtls[gtl]; ok {
+		return res
+	}
+	return gtl
+}
+
+func (cl *cloner) group(grp *Group) *Group {
+	if grp == nil {
+		return nil
+	}
+	if res, ok := cl.groups[grp]; ok {
+		return res
+	}
+	if gtl, ok := grp.container.(*Gitolite); ok && cl.gitolite(gtl) == gtl {
+		return grp
+	}
+	res := &Group{name: grp.name, kind: grp.kind, cmt: cl.comment(grp.cmt)}
+	cl.groups[grp] = res
+	res.members = append([]string{}, grp.members...)
+	res.container = grp.container
+	if gtl, ok := grp.container.(*Gitolite); ok {
+		res.container = cl.gitolite(gtl)
+	}
+	for _, uog := range grp.usersOrGroups {
+		res.usersOrGroups = append(res.usersOrGroups, cl.userOrGroup(uog))
+	}
+	for _, rog := range grp.reposOrGroups {
+		res.reposOrGroups = append(res.reposOrGroups, cl.repoOrGroup(rog))
+	}
+	// the index of members is built now, not when first needed, so that
+	// reading a copy (see Snapshot) doesn't modify it
+	res.memberIdx = make(map[string]bool)
+	for _, member := range res.members {
+		res.memberIdx[member] = true
+	}
+	if grp.uogsByName != nil {
+		res.uogsByName = make(map[string]UserOrGroup)
+		for name, uog := range grp.uogsByName {
+			res.uogsByName[name] = cl.userOrGroup(uog)
+		}
+	}
+	if grp.rogsByName != nil {
+		res.rogsByName = make(map[string]RepoOrGroup)
+		for name, rog := range grp.rogsByName {
+			res.rogsByName[name] = cl.repoOrGroup(rog)
+		}
+	}
+	res.repoGroups = cl.groupList(grp.repoGroups)
+	if grp.indexedBy != nil {
+		res.indexedBy = cl.gitolite(grp.indexedBy)
+	}
+	return res
+}
+
+func (cl *cloner) groupList(grps []*Group) []*Group {
+	if grps == nil {
+		return nil
+	}
+	res := []*Group{}
+	for _, grp := range grps {
+		res = append(res, cl.group(grp))
+	}
+	return res
+}
+
+func (cl *cloner) repoOrGroup(rog RepoOrGroup) RepoOrGroup {
+	switch r := rog.(type) {
+	case *Repo:
+		if res, ok := cl.repos[r]; ok {
+			return res
+		}
+		res := &Repo{name: r.name}
+		cl.repos[r] = res
+		return res
+	case *Group:
+		return cl.group(r)
+	}
+	return rog
+}
+
+func (cl *cloner) userOrGroup(uog UserOrGroup) UserOrGroup {
+	switch u := uog.(type) {
+	case *User:
+		if res, ok := cl.users[u]; ok {
+			return res
+		}
+		res := &User{name: u.name}
+		cl.users[u] = res
+		return res
+	case *Group:
+		return cl.group(u)
+	}
+	return uog
+}
+
+func (cl *cloner) config(config *Config) *Config {
+	if res, ok := cl.configs[config]; ok {
+		return res
+	}
+	res := &Config{desc: config.desc, descCmt: cl.comment(config.descCmt), cmt: cl.comment(config.cmt)}
+	cl.configs[config] = res
+	for _, rog := range config.reposOrGroups {
+		res.reposOrGroups = append(res.reposOrGroups, cl.repoOrGroup(rog))
+	}
+	for _, rule := range config.rules {
+		res.rules = append(res.rules, cl.rule(rule))
+	}
+	gcs := make(map[*GitConfig]*GitConfig)
+	for _, gc := range config.gitConfigs {
+		gcs[gc] = &GitConfig{option: gc.option, key: gc.key, value: gc.value, cmt: cl.comment(gc.cmt)}
+		res.gitConfigs = append(res.gitConfigs, gcs[gc])
+	}
+	for _, elt := range config.elts {
+		switch e := elt.(type) {
+		case *Rule:
+			res.elts = append(res.elts, cl.rule(e))
+		case *GitConfig:
+			res.elts = append(res.elts, gcs[e])
+		}
+	}
+	return res
+}
+
+func (cl *cloner) rule(rule *Rule) *Rule {
+	if res, ok := cl.rules[rule]; ok {
+		return res
+	}
+	res := &Rule{access: rule.access, param: rule.param, cmt: cl.comment(rule.cmt), vref: rule.vref}
+	cl.rules[rule] = res
+	for _, uog := range rule.usersOrGroups {
+		res.usersOrGroups = append(res.usersOrGroups, cl.userOrGroup(uog))
+	}
+	return res
+}
+
+func (cl *cloner) comment(cmt *Comment) *Comment {
+	if cmt == nil {
+		return nil
+	}
+	if res, ok := cl.cmts[cmt]; ok {
+		return res
+	}
+	res := &Comment{comments: append([]string{}, cmt.comments...), sameLine: cmt.sameLine}
+	cl.cmts[cmt] = res
+	return res
+}
+
+func (cl *cloner) subconf(subconf *Subconf) *Subconf {
+	if subconf == nil {
+		return nil
+	}
+	if res, ok := cl.subconfs[subconf]; ok {
+		return res
+	}
+	res := *subconf
+	cl.subconfs[subconf] = &res
+	return &res
+}
@@ -0,0 +1,65 @@
+package gitolite
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClone(t *testing.T) {
+
+	Convey("A clone is a deep copy of a config", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@leads", []string{"bob"}, &Comment{comments: []string{"# leads"}})
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice", "@leads"}, nil)
+		gtl.AddUserOrRepoGroup("@apps", []string{"foo", "bar"}, nil)
+		cfg, _ := gtl.AddConfig([]string{"@apps", "baz"}, nil)
+		addRule(gtl, cfg, "RW+", "", "@devs")
+		addRule(gtl, cfg, "R", "", "carol")
+		gtl.AddGitConfig(cfg, "deny-rules", "1", true, nil)
+		cfg.SetDesc("apps", nil)
+		gtl.AddSubconf("*.conf")
+		sub := NewSubconf(gtl, "foo")
+		subcfg, _ := sub.AddConfig([]string{"foo"}, nil)
+		addRule(sub, subcfg, "RW", "", "dave")
+		gtl.AddChild(sub, "conf/foo.conf", gtl.Subconfs()[0])
+
+		clone := gtl.Clone()
+		So(clone.Print(), ShouldEqual, gtl.Print())
+		So(clone.String(), ShouldEqual, gtl.String())
+		So(clone.Merged().Print(), ShouldEqual, gtl.Merged().Print())
+		So(clone.CheckAccess("alice", "foo", "refs/heads/master", "+"), ShouldBeNil)
+		So(clone.CheckAccess("dave", "foo", "refs/heads/master", "W"), ShouldBeNil)
+
+		Convey("It references its own elements", func() {
+			devs := clone.GetGroup("@devs")
+			So(devs, ShouldNotPointTo, gtl.GetGroup("@devs"))
+			So(clone.Configs()[0], ShouldNotPointTo, cfg)
+			So(clone.Configs()[0].Rules()[0].GetUsersOrGroups()[0], ShouldPointTo, clone.userOrGroupFromName("@devs"))
+			So(clone.Configs()[0].GetReposOrGroups()[0], ShouldPointTo, clone.GetRepoGroup("@apps"))
+			So(clone.GetGroup("@leads").cmt, ShouldNotPointTo, gtl.GetGroup("@leads").cmt)
+			So(clone.getGroupsForMember("@leads"), ShouldResemble, []*Group{devs})
+			So(clone.Children()[0], ShouldNotPointTo, sub)
+			So(clone.Children()[0].Parent(), ShouldPointTo, clone)
+			So(clone.Children()[0].IncludedBy(), ShouldPointTo, clone.Subconfs()[0])
+		})
+
+		Convey("It can be modified without changing the original", func() {
+			more, _ := clone.AddConfig([]string{"baz"}, nil)
+			addRule(clone, more, "RW", "", "eve")
+			clone.GetGroup("@devs").addMember("frank")
+			So(clone.CheckAccess("eve", "baz", "refs/heads/master", "W"), ShouldBeNil)
+			So(gtl.CheckAccess("eve", "baz", "refs/heads/master", "W"), ShouldNotBeNil)
+			So(gtl.GetGroup("@devs").GetMembers(), ShouldResemble, []string{"alice", "@leads"})
+			So(len(gtl.getGroupsForMember("frank")), ShouldEqual, 0)
+			So(len(clone.getGroupsForMember("frank")), ShouldEqual, 1)
+		})
+
+		Convey("A subconf clone shares the configs including it", func() {
+			subclone := sub.Clone()
+			So(subclone.Parent(), ShouldPointTo, gtl)
+			So(subclone.IncludedBy(), ShouldPointTo, gtl.Subconfs()[0])
+			So(subclone.Print(), ShouldEqual, sub.Print())
+		})
+	})
+}
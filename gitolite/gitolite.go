@@ -2,7 +2,7 @@ package gitolite
 
 import (
 	"fmt"
-	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -12,9 +12,27 @@ type Gitolite struct {
 	reposOrGroups []RepoOrGroup
 	usersOrGroups []UserOrGroup
 	configs       []*Config
-	subconfs      []*regexp.Regexp
+	subconfs      []*Subconf
 	parent        *Gitolite
+	children      []*Gitolite
+	path          string
+	includedBy    *Subconf
 	elts          []Printable
+	rc            *RC
+	subconf       string
+	localGroups   map[string]string
+	violations    []error
+	// parentGroups are the groups of the including configs to mark as repo groups
+	// (see MarkParentGroups)
+	parentGroups []*Group
+
+	// indexes, maintained by the add methods, for large configs
+	groupIdx       map[string]int
+	rogsByName     map[string]RepoOrGroup
+	uogsByName     map[string]UserOrGroup
+	memberGroups   map[string][]*Group
+	reposToConfigs map[string][]int
+	groupConfigs   []int
 }
 
 // Printable is an element which can be printed
@@ -25,7 +43,12 @@ type Printable interface {
 // NewGitolite creates an empty gitolite config
 func NewGitolite(parent *Gitolite) *Gitolite {
 	res := &Gitolite{
-		parent: parent,
+		parent:         parent,
+		groupIdx:       make(map[string]int),
+		rogsByName:     make(map[string]RepoOrGroup),
+		uogsByName:     make(map[string]UserOrGroup),
+		memberGroups:   make(map[string][]*Group),
+		reposToConfigs: make(map[string][]int),
 	}
 	return res
 }
@@ -44,33 +67,15 @@ type Group struct {
 	cmt           *Comment
 	usersOrGroups []UserOrGroup
 	reposOrGroups []RepoOrGroup
-}
 
-// AddSubconf adds a new subconf regexp to the gitolite configuration
-// Duplicate is ignored
-// If regexp doesn't compile (by replacing * with '.*'), return the error
-func (gtl *Gitolite) AddSubconf(subconf string) error {
-	subconf = strings.Replace(subconf, "*", ".*", -1)
-	r, err := regexp.Compile(subconf)
-	if err != nil {
-		return err
-	}
-	seen := false
-	for _, sc := range gtl.subconfs {
-		if sc.String() == r.String() {
-			seen = true
-			break
-		}
-	}
-	if !seen {
-		gtl.subconfs = append(gtl.subconfs, r)
-	}
-	return nil
-}
-
-// Subconfs returns the subconf regexps read in the gitolite.conf
-func (gtl *Gitolite) Subconfs() []*regexp.Regexp {
-	return gtl.subconfs
+	// indexes of members, users or groups, repos or groups, and sub repo
+	// groups, created when first needed (groups are created in many places)
+	memberIdx  map[string]bool
+	uogsByName map[string]UserOrGroup
+	rogsByName map[string]RepoOrGroup
+	repoGroups []*Group
+	// indexedBy is the config indexing the group members (see getGroupsForMember)
+	indexedBy *Gitolite
 }
 
 type kind int
@@ -95,6 +100,8 @@ func (grp *Group) IsUndefined() bool {
 type Container interface {
 	addRepoOrGroup(rog RepoOrGroup)
 	addUserOrGroup(uog UserOrGroup)
+	repoOrGroupFromName(rogname string) RepoOrGroup
+	userOrGroupFromName(uogname string) UserOrGroup
 	GetReposOrGroups() []RepoOrGroup
 	GetUsersOrGroups() []UserOrGroup
 }
@@ -108,7 +115,6 @@ type Repo struct {
 type Comment struct {
 	comments []string
 	sameLine string
-	space    string
 }
 
 // User (or group of users)
@@ -123,6 +129,17 @@ type Config struct {
 	descCmt       *Comment
 	desc          string
 	cmt           *Comment
+	gitConfigs    []*GitConfig
+	// elts are the rules and git configs, in reading order, to print them
+	elts []Printable
+}
+
+// GitConfig is a 'config key = value' (or 'option key = value') line of a Config
+type GitConfig struct {
+	option bool
+	key    string
+	value  string
+	cmt    *Comment
 }
 
 // Rule (of access to repo)
@@ -131,8 +148,7 @@ type Rule struct {
 	param         string
 	usersOrGroups []UserOrGroup
 	cmt           *Comment
-	space         int
-	pspace        int
+	vref          *VREF
 }
 
 func (rule *Rule) maxSpace() (int, int) {
@@ -240,30 +256,20 @@ func (grp *Group) GetUsersOrGroups() []UserOrGroup {
 	return []UserOrGroup{}
 }
 
-func addUser(users []*User, user *User) []*User {
+func addUser(users []*User, user *User, seen map[string]bool) []*User {
 	/*if user == nil {
 		return users
 	}*/
-	seen := false
-	for _, u := range users {
-		if u.GetName() == user.GetName() {
-			seen = true
-		}
-	}
-	if !seen {
+	if !seen[user.GetName()] {
+		seen[user.GetName()] = true
 		users = append(users, user)
 	}
 	return users
 }
 
-func addRepo(repos []*Repo, repo *Repo) []*Repo {
-	seen := false
-	for _, r := range repos {
-		if r.GetName() == repo.GetName() {
-			seen = true
-		}
-	}
-	if !seen {
+func addRepo(repos []*Repo, repo *Repo, seen map[string]bool) []*Repo {
+	if !seen[repo.GetName()] {
+		seen[repo.GetName()] = true
 		repos = append(repos, repo)
 	}
 	return repos
@@ -271,18 +277,18 @@ func addRepo(repos []*Repo, repo *Repo) []*Repo {
 
 // GetAllRepos returns the repos  of a Group (including the ones in a repo group including the Group)
 func (grp *Group) GetAllRepos() []*Repo {
-	res := []*Repo{}
+	return grp.allRepos([]*Repo{}, map[string]bool{})
+}
+
+func (grp *Group) allRepos(res []*Repo, seen map[string]bool) []*Repo {
 	for _, rog := range grp.GetReposOrGroups() {
 		if rog.Repo() != nil {
 			repo := rog.Repo()
-			res = addRepo(res, repo)
+			res = addRepo(res, repo, seen)
 		}
 		if rog.Group() != nil {
 			group := rog.Group()
-			repos := group.GetAllRepos()
-			for _, repo := range repos {
-				res = addRepo(res, repo)
-			}
+			res = group.allRepos(res, seen)
 		}
 	}
 	return res
@@ -290,18 +296,18 @@ func (grp *Group) GetAllRepos() []*Repo {
 
 // GetAllUsers returns the users of a Group (including the ones in a user group including the Group)
 func (grp *Group) GetAllUsers() []*User {
-	res := []*User{}
+	return grp.allUsers([]*User{}, map[string]bool{})
+}
+
+func (grp *Group) allUsers(res []*User, seen map[string]bool) []*User {
 	for _, uog := range grp.GetUsersOrGroups() {
 		if uog.User() != nil {
 			user := uog.User()
-			res = addUser(res, user)
+			res = addUser(res, user, seen)
 		}
 		if uog.Group() != nil {
 			group := uog.Group()
-			users := group.GetAllUsers()
-			for _, user := range users {
-				res = addUser(res, user)
-			}
+			res = group.allUsers(res, seen)
 		}
 	}
 	return res
@@ -310,9 +316,10 @@ func (grp *Group) GetAllUsers() []*User {
 // GetAllUsers returns the users of a rule (including the ones in a user group set for that rule)
 func (rule *Rule) GetAllUsers() []*User {
 	res := []*User{}
+	seen := map[string]bool{}
 	for _, uog := range rule.usersOrGroups {
 		if uog.User() != nil {
-			res = addUser(res, uog.User())
+			res = addUser(res, uog.User(), seen)
 			//fmt.Println(uog.User())
 		}
 		if uog.Group() != nil {
@@ -320,6 +327,7 @@ func (rule *Rule) GetAllUsers() []*User {
 			//fmt.Println(grp)
 			for _, usr := range grp.GetAllUsers() {
 				//fmt.Println(usr)
+				seen[usr.GetName()] = true
 				res = append(res, usr)
 			}
 		}
@@ -352,10 +360,12 @@ func (rule *Rule) GetUsersFirstOrGroups() []UserOrGroup {
 type repoContainer interface {
 	GetReposOrGroups() []RepoOrGroup
 	addRepoOrGroup(rog RepoOrGroup)
+	repoOrGroupFromName(rogname string) RepoOrGroup
 }
 type userContainer interface {
 	GetUsersOrGroups() []UserOrGroup
 	addUserOrGroup(uog UserOrGroup)
+	userOrGroupFromName(uogname string) UserOrGroup
 }
 
 // GetReposOrGroups returns the repos or groups of repos found in a gitolite conf
@@ -364,7 +374,120 @@ func (gtl *Gitolite) GetReposOrGroups() []RepoOrGroup {
 }
 func (grp *Group) addRepoOrGroup(rog RepoOrGroup) {
 	grp.reposOrGroups = append(grp.reposOrGroups, rog)
-	grp.members = addStringNoDup(grp.members, rog.GetName())
+	if grp.rogsByName == nil {
+		grp.rogsByName = make(map[string]RepoOrGroup)
+	}
+	if _, ok := grp.rogsByName[rog.GetName()]; !ok {
+		grp.rogsByName[rog.GetName()] = rog
+	}
+	if rog.Group() != nil {
+		grp.repoGroups = append(grp.repoGroups, rog.Group())
+	}
+	grp.addMember(rog.GetName())
+}
+
+// repoOrGroupFromName returns a repo or group listed in a repos group, nil if not found
+func (grp *Group) repoOrGroupFromName(rogname string) RepoOrGroup {
+	if grp.kind != repos {
+		return nil
+	}
+	return grp.rogsByName[rogname]
+}
+
+// hasMember checks if a name is a member of a group
+func (grp *Group) hasMember(name string) bool {
+	if grp.memberIdx == nil {
+		grp.memberIdx = make(map[string]bool)
+		for _, member := range grp.members {
+			grp.memberIdx[member] = true
+		}
+	}
+	return grp.memberIdx[name]
+}
+
+// addMember adds a name to the members of a group (unless already there),
+// and to the index of the config the group belongs to.
+func (grp *Group) addMember(name string) {
+	if grp.hasMember(name) {
+		return
+	}
+	grp.members = append(grp.members, name)
+	grp.memberIdx[name] = true
+	if grp.indexedBy != nil {
+		grp.indexedBy.indexMember(name, grp)
+	}
+}
+
+// AddMember adds a user (or user group) to a group which isn't a repos group.
+// The member is a user (or user group) of the config if the group is a users group.
+func (grp *Group) AddMember(name string) error {
+	if grp.kind == repos {
+		return fmt.Errorf("group '%v' is a repos group, not a user one", grp.name)
+	}
+	if grp.hasMember(name) {
+		return fmt.Errorf("'%v' is already a member of group '%v'", name, grp.name)
+	}
+	for _, g := range grp.copies() {
+		g.addMember(name)
+		if g.kind == users {
+			addUserOrGroupFromName(g, name, g.container)
+		}
+	}
+	return nil
+}
+
+// RemoveMember removes a user (or user group) from a group which isn't a repos group.
+// The member stays a user (or user group) of the config.
+func (grp *Group) RemoveMember(name string) error {
+	if grp.kind == repos {
+		return fmt.Errorf("group '%v' is a repos group, not a user one", grp.name)
+	}
+	if !grp.hasMember(name) {
+		return fmt.Errorf("'%v' isn't a member of group '%v'", name, grp.name)
+	}
+	for _, g := range grp.copies() {
+		g.removeMember(name)
+	}
+	return nil
+}
+
+// copies returns a group, and the group of the same name its config lists
+// as user group if it isn't the same (the one rules use).
+func (grp *Group) copies() []*Group {
+	res := []*Group{grp}
+	if grp.container == nil {
+		return res
+	}
+	if uog := grp.container.userOrGroupFromName(grp.name); uog != nil {
+		if g := uog.Group(); g != nil && g != grp {
+			res = append(res, g)
+		}
+	}
+	return res
+}
+
+func (grp *Group) removeMember(name string) {
+	members := []string{}
+	for _, member := range grp.members {
+		if member != name {
+			members = append(members, member)
+		}
+	}
+	grp.members = members
+	if grp.memberIdx != nil {
+		delete(grp.memberIdx, name)
+	}
+	uogs := []UserOrGroup{}
+	for _, uog := range grp.usersOrGroups {
+		if uog.GetName() != name {
+			uogs = append(uogs, uog)
+		}
+	}
+	grp.usersOrGroups = uogs
+	delete(grp.uogsByName, name)
+	if grp.indexedBy != nil {
+		grp.indexedBy.unindexMember(name, grp)
+	}
 }
 
 // GetReposOrGroups returns the repos or groups of repos listed in a repos group
@@ -385,9 +508,10 @@ func (gtl *Gitolite) GetUsersOrGroups() []UserOrGroup {
 	return gtl.usersOrGroups
 }
 func (gtl *Gitolite) addUserOrGroup(uog UserOrGroup) {
-	seen := isUserOrGroupSeen(uog.GetName(), gtl.usersOrGroups)
+	seen := gtl.userOrGroupFromName(uog.GetName()) != nil
 	if !seen {
 		gtl.usersOrGroups = append(gtl.usersOrGroups, uog)
+		gtl.uogsByName[uog.GetName()] = uog
 	}
 	grp := uog.Group()
 	if grp != nil {
@@ -409,10 +533,28 @@ func (cfg *Config) addRepoOrGroup(rog RepoOrGroup) {
 	cfg.reposOrGroups = append(cfg.reposOrGroups, rog)
 }
 
+func (cfg *Config) repoOrGroupFromName(rogname string) RepoOrGroup {
+	for _, rog := range cfg.reposOrGroups {
+		if rog.GetName() == rogname {
+			return rog
+		}
+	}
+	return nil
+}
+
 func (rule *Rule) addUserOrGroup(uog UserOrGroup) {
 	rule.usersOrGroups = append(rule.usersOrGroups, uog)
 }
 
+func (rule *Rule) userOrGroupFromName(uogname string) UserOrGroup {
+	for _, uog := range rule.usersOrGroups {
+		if uog.GetName() == uogname {
+			return uog
+		}
+	}
+	return nil
+}
+
 func (k kind) String() string {
 	if k == repos {
 		return "<repos>"
@@ -431,10 +573,8 @@ func (grp *Group) String() string {
 
 // GetGroup get group for a given group name
 func (gtl *Gitolite) GetGroup(groupname string) *Group {
-	for _, group := range gtl.groups {
-		if group.name == groupname {
-			return group
-		}
+	if i, ok := gtl.groupIdx[groupname]; ok {
+		return gtl.groups[i]
 	}
 	return nil
 }
@@ -445,26 +585,52 @@ func (gtl *Gitolite) GetConfigsForRepo(reponame string) []*Config {
 }
 
 func (grp *Group) hasRepoOrGroup(rogname string) bool {
-	for _, rog := range grp.reposOrGroups {
-		if rog.GetName() == rogname {
+	if _, ok := grp.rogsByName[rogname]; ok {
+		return true
+	}
+	for _, subgrp := range grp.repoGroups {
+		if subgrp.hasRepoOrGroup(rogname) {
 			return true
-		} else if rog.Group() != nil {
-			subgrp := rog.Group()
-			if subgrp.hasRepoOrGroup(rogname) {
-				return true
-			}
 		}
 	}
 	return false
 }
 
+// configsListing returns the configs which may apply to repos or groups:
+// the ones listing one of them by name, and the ones listing a group,
+// in the order they have been added.
+func (gtl *Gitolite) configsListing(rognames []string) []*Config {
+	seen := map[int]bool{}
+	idx := []int{}
+	for _, rogname := range rognames {
+		for _, i := range gtl.reposToConfigs[rogname] {
+			if !seen[i] {
+				seen[i] = true
+				idx = append(idx, i)
+			}
+		}
+	}
+	for _, i := range gtl.groupConfigs {
+		if !seen[i] {
+			seen[i] = true
+			idx = append(idx, i)
+		}
+	}
+	sort.Ints(idx)
+	res := []*Config{}
+	for _, i := range idx {
+		res = append(res, gtl.configs[i])
+	}
+	return res
+}
+
 // GetConfigsForRepos return config for a given list of repos
 func (gtl *Gitolite) GetConfigsForRepos(reponames []string) []*Config {
 	res := []*Config{}
 	if len(reponames) == 0 {
 		return res
 	}
-	for _, config := range gtl.configs {
+	for _, config := range gtl.configsListing(reponames) {
 		rpn := []string{}
 		for _, rog := range config.reposOrGroups {
 			for _, reponame := range reponames {
@@ -660,23 +826,21 @@ func (rule *Rule) AddGroup(group *Group) {
 }
 
 func (gtl *Gitolite) addGroup(grp *Group) {
-	seen := false
-	var gg *Group
-	for _, group := range gtl.groups {
-		if grp.GetName() == group.GetName() {
-			seen = true
-			gg = group
-			break
-		}
-	}
+	gg := gtl.GetGroup(grp.GetName())
+	seen := gg != nil
 	if !seen {
+		gtl.groupIdx[grp.GetName()] = len(gtl.groups)
 		gtl.groups = append(gtl.groups, grp)
+		if grp.indexedBy == nil {
+			grp.indexedBy = gtl
+		}
+		for _, member := range grp.GetMembers() {
+			gtl.indexMember(member, grp)
+		}
 	} else {
 		//fmt.Println("\nGRP: ", grp, ", GG: ", gg)
 		for _, member := range gg.GetMembers() {
-			if !isNameSeen(member, grp.GetMembers()) {
-				grp.members = append(grp.members, member)
-			}
+			grp.addMember(member)
 		}
 		if grp.kind != undefined {
 			gg.kind = grp.kind
@@ -684,10 +848,41 @@ func (gtl *Gitolite) addGroup(grp *Group) {
 	}
 }
 
+// indexMember records that a group of the config has a member,
+// keeping the groups of a member in the order they have been added.
+func (gtl *Gitolite) indexMember(member string, grp *Group) {
+	grps := gtl.memberGroups[member]
+	pos := gtl.groupIdx[grp.GetName()]
+	i := sort.Search(len(grps), func(i int) bool { return gtl.groupIdx[grps[i].GetName()] >= pos })
+	if i < len(grps) && grps[i] == grp {
+		return
+	}
+	grps = append(grps, nil)
+	copy(grps[i+1:], grps[i:])
+	grps[i] = grp
+	gtl.memberGroups[member] = grps
+}
+
+// unindexMember records that a group of the config no longer has a member
+func (gtl *Gitolite) unindexMember(member string, grp *Group) {
+	grps := []*Group{}
+	for _, g := range gtl.memberGroups[member] {
+		if g != grp {
+			grps = append(grps, g)
+		}
+	}
+	if len(grps) == 0 {
+		delete(gtl.memberGroups, member)
+		return
+	}
+	gtl.memberGroups[member] = grps
+}
+
 func (gtl *Gitolite) addRepoOrGroup(rog RepoOrGroup) {
-	seen := isRepoOrGroupSeen(rog.GetName(), gtl.reposOrGroups)
+	seen := gtl.repoOrGroupFromName(rog.GetName()) != nil
 	if !seen {
 		gtl.reposOrGroups = append(gtl.reposOrGroups, rog)
+		gtl.rogsByName[rog.GetName()] = rog
 	}
 	grp := rog.Group()
 	if grp != nil {
@@ -705,8 +900,8 @@ func (gtl *Gitolite) addRepoOrGroup(rog RepoOrGroup) {
 
 // MarkAsRepoGroup makes sure a group is a repo group
 func (grp *Group) MarkAsRepoGroup() error {
-	if grp.kind == users {
-		return fmt.Errorf("group '%v' is a users group, not a repo one", grp.name)
+	if err := grp.checkRepoGroup(); err != nil {
+		return err
 	}
 	if grp.kind == undefined {
 		grp.kind = repos
@@ -718,24 +913,25 @@ func (grp *Group) MarkAsRepoGroup() error {
 	return nil
 }
 
+func (grp *Group) checkRepoGroup() error {
+	if grp.kind == users {
+		return fmt.Errorf("group '%v' is a users group, not a repo one", grp.name)
+	}
+	return nil
+}
+
 // GetRepoGroup returns the repo group if found
 func (gtl *Gitolite) GetRepoGroup(name string) *Group {
-	for _, grp := range gtl.groups {
-		//fmt.Printf("group '%v' '%v'\n", grp.GetName(), grp.GetRepos() != nil)
-		if !grp.IsUsers() && grp.GetName() == name {
-			return grp
-		}
+	grp := gtl.GetGroup(name)
+	//fmt.Printf("group '%v' '%v'\n", grp.GetName(), grp.GetRepos() != nil)
+	if grp != nil && !grp.IsUsers() {
+		return grp
 	}
 	return nil
 }
 
 func addRepoOrGroupFromName(rc repoContainer, rogname string, allReposCtn repoContainer) {
-	var rog RepoOrGroup
-	for _, arog := range allReposCtn.GetReposOrGroups() {
-		if arog.GetName() == rogname {
-			rog = arog
-		}
-	}
+	rog := allReposCtn.repoOrGroupFromName(rogname)
 	//fmt.Println("addRepoOrGroupFromName ", rc, " => rog ", rog, " (", rogname, ")")
 	if rog == nil {
 		if !strings.HasPrefix(rogname, "@") {
@@ -747,30 +943,12 @@ func addRepoOrGroupFromName(rc repoContainer, rogname string, allReposCtn repoCo
 			allReposCtn.addRepoOrGroup(rog)
 		}
 	}
-	seen := isRepoOrGroupSeen(rog.GetName(), rc.GetReposOrGroups())
+	seen := rc.repoOrGroupFromName(rog.GetName()) != nil
 	if !seen {
 		rc.addRepoOrGroup(rog)
 	}
 }
 
-func isUserOrGroupSeen(uogName string, uogs []UserOrGroup) bool {
-	for _, uog := range uogs {
-		if uogName == uog.GetName() {
-			return true
-		}
-	}
-	return false
-}
-
-func isRepoOrGroupSeen(rogName string, rogs []RepoOrGroup) bool {
-	for _, rog := range rogs {
-		if rogName == rog.GetName() {
-			return true
-		}
-	}
-	return false
-}
-
 func isNameSeen(name string, names []string) bool {
 	for _, aname := range names {
 		if name == aname {
@@ -783,13 +961,8 @@ func isNameSeen(name string, names []string) bool {
 // AddUserFromName add a user to a user container.
 // If the user name doesn't match a user, creates the user
 func addUserOrGroupFromName(uc userContainer, uogname string, allUsersCtn userContainer) {
-	var uog UserOrGroup
 	//fmt.Println("addUserOrGroupFromName ", uogname, " ")
-	for _, auog := range allUsersCtn.GetUsersOrGroups() {
-		if auog.GetName() == uogname {
-			uog = auog
-		}
-	}
+	uog := allUsersCtn.userOrGroupFromName(uogname)
 	if uog == nil {
 		if !strings.HasPrefix(uogname, "@") {
 			uog = &User{name: uogname}
@@ -800,7 +973,7 @@ func addUserOrGroupFromName(uc userContainer, uogname string, allUsersCtn userCo
 			allUsersCtn.addUserOrGroup(uog)
 		}
 	}
-	seen := isUserOrGroupSeen(uog.GetName(), uc.GetUsersOrGroups())
+	seen := uc.userOrGroupFromName(uog.GetName()) != nil
 	if !seen {
 		uc.addUserOrGroup(uog)
 	}
@@ -833,7 +1006,21 @@ func addStringNoDup(list []string, s string) []string {
 
 func (grp *Group) addUserOrGroup(uog UserOrGroup) {
 	grp.usersOrGroups = append(grp.usersOrGroups, uog)
-	grp.members = addStringNoDup(grp.members, uog.GetName())
+	if grp.uogsByName == nil {
+		grp.uogsByName = make(map[string]UserOrGroup)
+	}
+	if _, ok := grp.uogsByName[uog.GetName()]; !ok {
+		grp.uogsByName[uog.GetName()] = uog
+	}
+	grp.addMember(uog.GetName())
+}
+
+// userOrGroupFromName returns a user or group listed in a users group, nil if not found
+func (grp *Group) userOrGroupFromName(uogname string) UserOrGroup {
+	if grp.kind != users {
+		return nil
+	}
+	return grp.uogsByName[uogname]
 }
 
 // NbUsersOrGroups returns the number of users (single or groups)
@@ -849,12 +1036,7 @@ func (gtl *Gitolite) Rules(rogname string) ([]*Rule, error) {
 }
 
 func (gtl *Gitolite) repoOrGroupFromName(rogname string) RepoOrGroup {
-	for _, rog := range gtl.reposOrGroups {
-		if rog.GetName() == rogname {
-			return rog
-		}
-	}
-	return nil
+	return gtl.rogsByName[rogname]
 }
 
 func (gtl *Gitolite) configsFromRepoOrGroup(rog RepoOrGroup) []*Config {
@@ -862,7 +1044,7 @@ func (gtl *Gitolite) configsFromRepoOrGroup(rog RepoOrGroup) []*Config {
 	if rog == nil {
 		return res
 	}
-	for _, config := range gtl.configs {
+	for _, config := range gtl.configsListing([]string{rog.GetName()}) {
 		for _, arog := range config.reposOrGroups {
 			if arog.GetName() == rog.GetName() {
 				res = append(res, config)
@@ -930,15 +1112,14 @@ func (rule *Rule) HasAnyUserOrGroup() bool {
 
 // AddUserOrRepoGroup adds a user or repo group to a gitolite config
 func (gtl *Gitolite) AddUserOrRepoGroup(grpname string, grpmembers []string, currentComment *Comment) error {
+	grpname = gtl.prefixGroupName(grpname)
 	grp := &Group{name: grpname, members: grpmembers, container: gtl, cmt: currentComment}
-	for _, g := range gtl.groups {
-		if g.GetName() == grpname {
-			if len(g.members) > 0 {
-				return fmt.Errorf("Duplicate group name '%v'", grpname)
-			}
-			g.cmt = grp.cmt
-			grp = g
+	if g := gtl.GetGroup(grpname); g != nil {
+		if len(g.members) > 0 {
+			return fmt.Errorf("Duplicate group name '%v'", grpname)
 		}
+		g.cmt = grp.cmt
+		grp = g
 	}
 	seen := map[string]bool{}
 	for _, val := range grpmembers {
@@ -956,15 +1137,7 @@ func (gtl *Gitolite) AddUserOrRepoGroup(grpname string, grpmembers []string, cur
 
 func (gtl *Gitolite) getGroupsForMember(memberName string) []*Group {
 	res := []*Group{}
-	for _, grp := range gtl.groups {
-		for _, mname := range grp.members {
-			if mname == memberName {
-				res = append(res, grp)
-				break
-			}
-		}
-	}
-	return res
+	return append(res, gtl.memberGroups[memberName]...)
 }
 
 // AddConfig adds a new config and returns it,
@@ -988,33 +1161,46 @@ func (gtl *Gitolite) AddConfig(rpmembers []string, comment *Comment) (*Config, e
 			}
 		}
 	}
+	gtl.indexConfig(config)
 	gtl.configs = append(gtl.configs, config)
 	gtl.elts = append(gtl.elts, config)
 	return config, nil
 }
 
-func (gtl *Gitolite) getGroup(rpname string) *Group {
-	var group *Group
-	for _, g := range gtl.groups {
-		if g.name == rpname {
-			group = g
-			break
-		}
-	}
-	if group == nil && gtl.parent != nil {
-		// fmt.Println("=> ", gtl.parent.groups)
-		for _, g := range gtl.parent.groups {
-			if g.name == rpname {
-				group = g
-				break
+// indexConfig records the repos listed by a config about to be added
+// (see configsListing)
+func (gtl *Gitolite) indexConfig(config *Config) {
+	i := len(gtl.configs)
+	grouped := false
+	for _, rog := range config.reposOrGroups {
+		if rog.Group() != nil {
+			if !grouped {
+				gtl.groupConfigs = append(gtl.groupConfigs, i)
+				grouped = true
 			}
+		} else {
+			gtl.reposToConfigs[rog.GetName()] = append(gtl.reposToConfigs[rog.GetName()], i)
 		}
 	}
-	return group
+}
+
+func (gtl *Gitolite) getGroup(rpname string) *Group {
+	if g := gtl.GetGroup(rpname); g != nil {
+		return g
+	}
+	if gtl.parent != nil {
+		return gtl.parent.getGroup(rpname)
+	}
+	return nil
 }
 
 func (gtl *Gitolite) addRepoGroupToConfig(config *Config, repogrpname string) error {
-	group := gtl.getGroup(repogrpname)
+	group := gtl.GetGroup(repogrpname)
+	inherited := false
+	if group == nil && gtl.parent != nil {
+		group = gtl.parent.getGroup(repogrpname)
+		inherited = group != nil
+	}
 	if group == nil {
 		if repogrpname == "@all" {
 			group = &Group{name: "@all", container: gtl}
@@ -1022,11 +1208,16 @@ func (gtl *Gitolite) addRepoGroupToConfig(config *Config, repogrpname string) er
 			return fmt.Errorf("repo group name '%v' undefined", repogrpname)
 		}
 	}
-	if !isRepoOrGroupSeen(repogrpname, config.reposOrGroups) {
+	if config.repoOrGroupFromName(repogrpname) == nil {
 		config.addRepoOrGroup(group)
 	}
 	//fmt.Printf("\n%v\n", group)
-	if err := group.MarkAsRepoGroup(); err != nil {
+	if inherited {
+		if err := group.checkRepoGroup(); err != nil {
+			return err
+		}
+		gtl.parentGroups = append(gtl.parentGroups, group)
+	} else if err := group.MarkAsRepoGroup(); err != nil {
 		return err
 	}
 	for _, rporgrpname := range group.GetMembers() {
@@ -1048,32 +1239,19 @@ func (cfg *Config) SetDesc(desc string, comment *Comment) error {
 }
 
 func (gtl *Gitolite) userOrGroupFromName(uogname string) UserOrGroup {
-	for _, uog := range gtl.usersOrGroups {
-		if uog.GetName() == uogname {
-			return uog
-		}
-	}
-	return nil
+	return gtl.uogsByName[uogname]
 }
 
 func (gtl *Gitolite) groupsFromUserOrGroup(uog UserOrGroup) []*Group {
-	res := []*Group{}
 	if uog == nil {
-		return res
+		return []*Group{}
 	}
-	for _, grp := range gtl.groups {
-		for _, member := range grp.members {
-			if member == uog.GetName() {
-				res = append(res, grp)
-			}
-		}
-	}
-	return res
+	return gtl.getGroupsForMember(uog.GetName())
 }
 
 // AddUserOrGroupToRule adds user to rule unless user name already used in a repo group
 func (gtl *Gitolite) AddUserOrGroupToRule(rule *Rule, uogname string) error {
-	if uogname != "@all" && isRepoOrGroupSeen(uogname, gtl.reposOrGroups) {
+	if uogname != "@all" && gtl.repoOrGroupFromName(uogname) != nil {
 		return fmt.Errorf("user or user group name '%v' already used in a repo group", uogname)
 	}
 	addUserOrGroupFromName(rule, uogname, gtl)
@@ -1091,6 +1269,67 @@ func (gtl *Gitolite) AddUserOrGroupToRule(rule *Rule, uogname string) error {
 	return nil
 }
 
+// AddGitConfig adds a 'config' (or, if option is true, an 'option') line to a config.
+// A 'config' key must be allowed by the GIT_CONFIG_KEYS of the rc, if there is one.
+func (gtl *Gitolite) AddGitConfig(cfg *Config, key, value string, option bool, comment *Comment) error {
+	rc := gtl.RC()
+	if !option && rc != nil && !rc.IsGitConfigKeyAllowed(key) {
+		return fmt.Errorf("git config '%v' not allowed, check GIT_CONFIG_KEYS in the rc file", key)
+	}
+	gc := &GitConfig{option: option, key: key, value: value, cmt: comment}
+	cfg.gitConfigs = append(cfg.gitConfigs, gc)
+	cfg.elts = append(cfg.elts, gc)
+	return nil
+}
+
+// GitConfigs returns the 'config' and 'option' lines of a config
+func (cfg *Config) GitConfigs() []*GitConfig {
+	return cfg.gitConfigs
+}
+
+// Option returns the value of an 'option' of a config, empty string if not set
+func (cfg *Config) Option(key string) string {
+	res := ""
+	for _, gc := range cfg.gitConfigs {
+		if gc.option && gc.key == key {
+			res = gc.value
+		}
+	}
+	return res
+}
+
+// Key returns the key of a 'config' or 'option' line
+func (gc *GitConfig) Key() string {
+	return gc.key
+}
+
+// Value returns the value of a 'config' or 'option' line
+func (gc *GitConfig) Value() string {
+	return gc.value
+}
+
+// IsOption checks if the line is an 'option' line (instead of a 'config' one)
+func (gc *GitConfig) IsOption() bool {
+	return gc.option
+}
+
+// Print prints a 'config' or 'option' line, with its comments
+func (gc *GitConfig) Print() string {
+	res := ""
+	if gc.cmt != nil {
+		res = gc.cmt.print("    ")
+	}
+	kind := "config"
+	if gc.option {
+		kind = "option"
+	}
+	res = res + "    " + kind + " " + gc.key + " = " + gc.value
+	if gc.cmt != nil && gc.cmt.sameLine != "" {
+		res = res + " # " + gc.cmt.sameLine
+	}
+	return res + "\n"
+}
+
 // Desc get description for a config, empty string if there is none.
 func (cfg *Config) Desc() string {
 	return cfg.desc
@@ -1099,6 +1338,9 @@ func (cfg *Config) Desc() string {
 // NewRule creates a new Rule with access, param and comment
 func NewRule(access, param string, comment *Comment) *Rule {
 	res := &Rule{access: access, param: param, cmt: comment}
+	if IsVREF(param) {
+		res.vref, _ = ParseVREF(param)
+	}
 	return res
 }
 
@@ -1112,6 +1354,7 @@ func (gtl *Gitolite) AddRuleToConfig(rule *Rule, config *Config) {
 	}
 	if !seen {
 		config.rules = append(config.rules, rule)
+		config.elts = append(config.elts, rule)
 	}
 }
 
@@ -1126,10 +1369,15 @@ func (gtl *Gitolite) Print() string {
 
 // Print prints the comments (empty string if no comments)
 func (cmt *Comment) Print() string {
+	return cmt.print("")
+}
+
+// print prints the comments, each line indented
+func (cmt *Comment) print(indent string) string {
 	res := ""
 	if cmt != nil {
 		for _, comment := range cmt.comments {
-			res = res + cmt.space
+			res = res + indent
 			if !strings.HasPrefix(comment, "#") && comment != "" {
 				res = res + "# "
 			}
@@ -1180,24 +1428,33 @@ func (cfg *Config) Print() string {
 			maxpspace = pspace
 		}
 	}
-	for _, rule := range cfg.Rules() {
-		rule.space = maxspace
-		rule.pspace = maxpspace
-		res = res + rule.Print()
+	for _, elt := range cfg.elts {
+		if rule, ok := elt.(*Rule); ok {
+			res = res + rule.print(maxspace, maxpspace)
+		} else {
+			res = res + elt.Print()
+		}
 	}
 	return res + "\n"
 }
 
 // Print prints the comments and access/params and user or groups of a rule
+// (unpadded, see Config.Print for rules aligned in a config)
 func (rule *Rule) Print() string {
+	return rule.print(0, 0)
+}
+
+// print prints a rule, its access and param padded to align the rules of
+// a config: computed by the config, not stored in the rule, so that
+// printing doesn't modify the rule.
+func (rule *Rule) print(space, pspace int) string {
 	res := ""
 	if rule.cmt != nil {
-		rule.cmt.space = "    "
-		res = rule.cmt.Print()
+		res = rule.cmt.print("    ")
 	}
-	f := "    %-" + fmt.Sprintf("%d", rule.space) + "s"
+	f := "    %-" + fmt.Sprintf("%d", space) + "s"
 	res = res + fmt.Sprintf(f, rule.Access())
-	f = "%-" + fmt.Sprintf("%d", rule.pspace) + "s"
+	f = "%-" + fmt.Sprintf("%d", pspace) + "s"
 	res = res + fmt.Sprintf(f, rule.Param())
 	res = res + " ="
 	for _, userOrGroup := range rule.usersOrGroups {
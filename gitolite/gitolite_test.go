@@ -98,18 +98,18 @@ func TestProject(t *testing.T) {
 			So(gtl.userOrGroupFromName("user1"), ShouldNotBeNil)
 			So(gtl.userOrGroupFromName("user1b"), ShouldBeNil)
 
-			err = gtl.AddUserOrRepoGroup("@grp1", []string{"u1", "u2"}, &Comment{[]string{"duplicate group"}, "", ""})
+			err = gtl.AddUserOrRepoGroup("@grp1", []string{"u1", "u2"}, &Comment{[]string{"duplicate group"}, ""})
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldEqual, "Duplicate group name '@grp1'")
 			So(gtl.NbUserGroups(), ShouldEqual, 1)
 			So(gtl.NbUsersOrGroups(), ShouldEqual, 3)
 
-			err = gtl.AddUserOrRepoGroup("@grp2", []string{"u1", "u2", "u1"}, &Comment{[]string{"duplicate user"}, "", ""})
+			err = gtl.AddUserOrRepoGroup("@grp2", []string{"u1", "u2", "u1"}, &Comment{[]string{"duplicate user"}, ""})
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldEqual, "Duplicate group element name 'u1'")
 			So(gtl.NbUserGroups(), ShouldEqual, 1)
 
-			err = gtl.AddUserOrRepoGroup("@grp2", []string{"u1", "u2", "@grp1"}, &Comment{[]string{"legit user group"}, "", ""})
+			err = gtl.AddUserOrRepoGroup("@grp2", []string{"u1", "u2", "@grp1"}, &Comment{[]string{"legit user group"}, ""})
 			So(err, ShouldBeNil)
 			grp = gtl.GetGroup("@grp2")
 			err = grp.markAsUserGroup()
@@ -201,7 +201,7 @@ test1
 		})
 
 		Convey("Rules can be added", func() {
-			cmt := &Comment{[]string{"rule comment"}, "", ""}
+			cmt := &Comment{[]string{"rule comment"}, ""}
 			rule := NewRule("RW", "test", cmt)
 			So(rule.Access(), ShouldEqual, "RW")
 			So(rule.Param(), ShouldEqual, "test")
@@ -215,8 +215,9 @@ test1
 			So(len(rule.GetUsersOrGroups()), ShouldEqual, 1)
 			So(rule.HasAnyUserOrGroup(), ShouldBeTrue)
 			So(len(rule.GetAllUsers()), ShouldEqual, 1)
+			So(rule.Print(), ShouldEqual, "    # rule comment\n    RWtest = u1\n")
 
-			grp := &Group{name: "@grp1", cmt: &Comment{[]string{"@grp1 comment"}, "", ""}}
+			grp := &Group{name: "@grp1", cmt: &Comment{[]string{"@grp1 comment"}, ""}}
 			usr = &User{"u21"}
 			grp.addUserOrGroup(usr)
 			So(grp.Comment().String(), ShouldEqual, `@grp1 comment
@@ -244,7 +245,7 @@ test1
 			So(len(rule.GetUsersFirstOrGroups()), ShouldEqual, 2)
 			So(len(rule.GetAllUsers()), ShouldEqual, 2)
 
-			grpp := &Group{name: "@grp1", cmt: &Comment{[]string{"@grp1 comment"}, "", ""}}
+			grpp := &Group{name: "@grp1", cmt: &Comment{[]string{"@grp1 comment"}, ""}}
 			//usr = &User{"u22"}
 			//grpp.addUserOrGroup(usr)
 			gtl.addGroup(grpp)
@@ -273,7 +274,7 @@ test1
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldStartWith, "user or user group name 'u4' already used in a repo group")
 
-			err = gtl.AddUserOrRepoGroup("@grp4", []string{"u41", "u42"}, &Comment{[]string{"legit user group4"}, "", ""})
+			err = gtl.AddUserOrRepoGroup("@grp4", []string{"u41", "u42"}, &Comment{[]string{"legit user group4"}, ""})
 			So(err, ShouldBeNil)
 
 			grp = gtl.GetGroup("@grp4")
@@ -306,7 +307,7 @@ test1
 			So(gtl.NbUserGroups(), ShouldEqual, 5)
 			So(gtl.NbUsers(), ShouldEqual, 5)
 
-			err = gtl.AddUserOrRepoGroup("@grpusers", []string{"u41", "u42"}, &Comment{[]string{"legit user @grpusers"}, "", ""})
+			err = gtl.AddUserOrRepoGroup("@grpusers", []string{"u41", "u42"}, &Comment{[]string{"legit user @grpusers"}, ""})
 			So(err, ShouldBeNil)
 			grp = gtl.GetGroup("@grp4")
 			So(len(grp.GetUsersOrGroups()), ShouldEqual, 2)
@@ -318,18 +319,18 @@ test1
 			So(gtl.NbConfigs(), ShouldEqual, 0)
 			//fmt.Println("\nCFG: ", gtl)
 
-			cfg, err := gtl.AddConfig([]string{"@grprepo"}, &Comment{[]string{"@grprepo comment"}, "", ""})
+			cfg, err := gtl.AddConfig([]string{"@grprepo"}, &Comment{[]string{"@grprepo comment"}, ""})
 			So(cfg, ShouldBeNil)
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldEqual, "repo group name '@grprepo' undefined")
 			//fmt.Println("\nCFG: ", gtl)
 
-			cfg, err = gtl.AddConfig([]string{"@all"}, &Comment{[]string{"@all comment"}, "", ""})
+			cfg, err = gtl.AddConfig([]string{"@all"}, &Comment{[]string{"@all comment"}, ""})
 			So(cfg, ShouldNotBeNil)
 			So(err, ShouldBeNil)
 			//fmt.Println("\nCFG: ", gtl)
 
-			gtl.AddConfig([]string{"repo1", "repo2"}, &Comment{[]string{"cfg1 comment"}, "", ""})
+			gtl.AddConfig([]string{"repo1", "repo2"}, &Comment{[]string{"cfg1 comment"}, ""})
 			So(gtl.NbConfigs(), ShouldEqual, 2)
 			So(fmt.Sprintf("%v", gtl.GetConfigsForRepo("repo1")), ShouldEqual, "[config [repo 'repo1' repo 'repo2'] => rules []]")
 			So(len(gtl.GetConfigsForRepos([]string{})), ShouldEqual, 0)
@@ -346,8 +347,8 @@ test1
 			So(len(gtl.configsFromRepoOrGroup(reposgrp)), ShouldEqual, 0)
 
 			//reposusr := &Group{name: "@usrgrp1", container: gtl, members: []string{"user11", "user12"}}
-			gtl.AddUserOrRepoGroup("@usrgrp1", []string{"user11", "user12"}, &Comment{[]string{"usrgrp1 comment"}, "", ""})
-			gtl.AddUserOrRepoGroup("@usrgrp2", []string{}, &Comment{[]string{"usrgrp2 comment"}, "", ""})
+			gtl.AddUserOrRepoGroup("@usrgrp1", []string{"user11", "user12"}, &Comment{[]string{"usrgrp1 comment"}, ""})
+			gtl.AddUserOrRepoGroup("@usrgrp2", []string{}, &Comment{[]string{"usrgrp2 comment"}, ""})
 			grp := gtl.GetGroup("@usrgrp1")
 			err = grp.markAsUserGroup()
 			//user11 := grp.GetAllUsers()[0]
@@ -358,49 +359,49 @@ test1
 			So(gtl.NbUsers(), ShouldEqual, 2)
 			So(gtl.NbRepos(), ShouldEqual, 4)
 
-			cfg2, err := gtl.AddConfig([]string{"@usrgrp1"}, &Comment{[]string{"cfg2 comment"}, "", ""})
+			cfg2, err := gtl.AddConfig([]string{"@usrgrp1"}, &Comment{[]string{"cfg2 comment"}, ""})
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldEqual, "group '@usrgrp1' is a users group, not a repo one")
 			So(cfg2, ShouldBeNil)
 			So(gtl.NbRepos(), ShouldEqual, 4)
 			So(len(gtl.Configs()), ShouldEqual, 2)
 
-			cfg2, err = gtl.AddConfig([]string{"@repounknown"}, &Comment{[]string{"cfg2 comment"}, "", ""})
+			cfg2, err = gtl.AddConfig([]string{"@repounknown"}, &Comment{[]string{"cfg2 comment"}, ""})
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldEqual, "repo group name '@repounknown' undefined")
 			So(cfg2, ShouldBeNil)
 
-			cfg2, err = gtl.AddConfig([]string{"user11"}, &Comment{[]string{"cfg2 comment"}, "", ""})
+			cfg2, err = gtl.AddConfig([]string{"user11"}, &Comment{[]string{"cfg2 comment"}, ""})
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldEqual, `repo name 'user11' already used in a user group
 group '@usrgrp1' is a users group, not a repo one`)
 			So(cfg2, ShouldBeNil)
 			So(gtl.NbRepos(), ShouldEqual, 4)
 
-			cfg2, err = gtl.AddConfig([]string{"@repogrp1"}, &Comment{[]string{"cfg2 comment"}, "", ""})
+			cfg2, err = gtl.AddConfig([]string{"@repogrp1"}, &Comment{[]string{"cfg2 comment"}, ""})
 			So(err, ShouldBeNil)
 			So(cfg2.Comment().String(), ShouldEqual, `cfg2 comment
 `)
-			cfg2b, err := gtl2.AddConfig([]string{"@repogrp1"}, &Comment{[]string{"cfg2b comment"}, "", ""})
+			cfg2b, err := gtl2.AddConfig([]string{"@repogrp1"}, &Comment{[]string{"cfg2b comment"}, ""})
 			So(err, ShouldBeNil)
 			So(cfg2b.Comment().String(), ShouldEqual, `cfg2b comment
 `)
 			So(len(gtl.configsFromRepoOrGroup(reposgrp)), ShouldEqual, 1)
 
-			cfga, err := gtl.AddConfig([]string{"gitolite-admin"}, &Comment{[]string{"ga comment"}, "", ""})
+			cfga, err := gtl.AddConfig([]string{"gitolite-admin"}, &Comment{[]string{"ga comment"}, ""})
 			So(err, ShouldBeNil)
 			So(cfga, ShouldNotBeNil)
 
-			err = cfg2.SetDesc("cfg2 desc", &Comment{[]string{"cfg2 desc comment"}, "", ""})
+			err = cfg2.SetDesc("cfg2 desc", &Comment{[]string{"cfg2 desc comment"}, ""})
 			So(err, ShouldBeNil)
 			So(cfg2.Desc(), ShouldEqual, "cfg2 desc")
-			err = cfg2.SetDesc("cfg2 desc", &Comment{[]string{"cfg2 desc comment"}, "", ""})
+			err = cfg2.SetDesc("cfg2 desc", &Comment{[]string{"cfg2 desc comment"}, ""})
 			So(err.Error(), ShouldEqual, "No more than one desc per config")
 
 			//fmt.Println("\nGTL ", gtl)
 			//os.Exit(0)
 			So(len(gtl.GetConfigsForRepo("repo11")), ShouldEqual, 1)
-			cmt := &Comment{[]string{"rule comment"}, "", ""}
+			cmt := &Comment{[]string{"rule comment"}, ""}
 			cmt.sameLine = "test"
 			rule := NewRule("RW", "test", cmt)
 			grp = gtl.GetGroup("@usrgrp2")
@@ -456,8 +457,8 @@ NbConfigs: 4 [config [group '@all'<repos>: []] => rules [], config [repo 'repo1'
 
 		Convey("Subconfs can be added", func() {
 			gtl := NewGitolite(nil)
-			err := gtl.AddSubconf("(invalid conf")
-			So(err, ShouldNotBeNil)
+			err := gtl.AddSubconf("[invalid conf")
+			So(err.Error(), ShouldEqual, "syntax error in pattern: '[invalid conf'")
 
 			err = gtl.AddSubconf("subs/*.conf")
 			So(err, ShouldBeNil)
@@ -471,7 +472,73 @@ NbConfigs: 4 [config [group '@all'<repos>: []] => rules [], config [repo 'repo1'
 			So(err, ShouldBeNil)
 			So(len(gtl.Subconfs()), ShouldEqual, 2)
 
+			err = gtl.AddNamedSubconf("foo", "subs2/*.conf", 3)
+			So(err, ShouldBeNil)
+			So(len(gtl.Subconfs()), ShouldEqual, 3)
+			sc := gtl.Subconfs()[2]
+			So(sc.Name(), ShouldEqual, "foo")
+			So(sc.Pattern(), ShouldEqual, "subs2/*.conf")
+			So(sc.Line(), ShouldEqual, 3)
+			So(sc.MatchString("subs2/x.conf"), ShouldBeTrue)
+			So(sc.MatchString("subs/x.conf"), ShouldBeFalse)
+			So(sc.MatchString("subs2/sub/x.conf"), ShouldBeFalse)
+			So(sc.MatchString("a/subs2/x.conf"), ShouldBeFalse)
+			So(sc.String(), ShouldEqual, `subconf foo = "subs2/*.conf"`)
+			So(gtl.Subconfs()[0].String(), ShouldEqual, `subconf "subs/*.conf"`)
+
+		})
+
+		Convey("Names are indexed", func() {
+			gtl := NewGitolite(nil)
+			So(gtl.AddUserOrRepoGroup("@grp1", []string{"repo1"}, nil), ShouldBeNil)
+			So(gtl.AddUserOrRepoGroup("@grp2", []string{"repo2", "@grp1"}, nil), ShouldBeNil)
+			So(gtl.GetGroup("@grp2").GetName(), ShouldEqual, "@grp2")
+			So(gtl.GetGroup("@grp3"), ShouldBeNil)
+
+			grps := gtl.getGroupsForMember("repo1")
+			So(len(grps), ShouldEqual, 1)
+			gtl.GetGroup("@grp2").addMember("repo1")
+			gtl.GetGroup("@grp2").addMember("repo1")
+			So(gtl.GetGroup("@grp2").GetMembers(), ShouldResemble, []string{"repo2", "@grp1", "repo1"})
+			grps = gtl.getGroupsForMember("repo1")
+			So(len(grps), ShouldEqual, 2)
+			So(grps[0].GetName(), ShouldEqual, "@grp1")
+			So(grps[1].GetName(), ShouldEqual, "@grp2")
+
+			_, err := gtl.AddConfig([]string{"repo1"}, nil)
+			So(err, ShouldBeNil)
+			_, err = gtl.AddConfig([]string{"repo3"}, nil)
+			So(err, ShouldBeNil)
+			_, err = gtl.AddConfig([]string{"@grp2"}, nil)
+			So(err, ShouldBeNil)
+			So(gtl.repoOrGroupFromName("repo3").GetName(), ShouldEqual, "repo3")
+			So(len(gtl.configsListing([]string{"repo3"})), ShouldEqual, 2)
+			So(len(gtl.GetConfigsForRepo("repo1")), ShouldEqual, 2)
+			So(len(gtl.GetConfigsForRepo("repo3")), ShouldEqual, 1)
+			So(gtl.GetGroup("@grp2").hasRepoOrGroup("repo1"), ShouldBeTrue)
+			So(gtl.GetGroup("@grp2").hasRepoOrGroup("repo3"), ShouldBeFalse)
 		})
 	})
 
+	Convey("Users can be added to and removed from a group", t, func() {
+		gtl := NewGitolite(nil)
+		So(gtl.AddUserOrRepoGroup("@devs", []string{"alice", "bob"}, nil), ShouldBeNil)
+		So(gtl.AddUserOrRepoGroup("@repos", []string{"repo1"}, nil), ShouldBeNil)
+		cfg, _ := gtl.AddConfig([]string{"@repos"}, nil)
+		addRule(gtl, cfg, "RW", "", "@devs")
+		devs := gtl.GetGroup("@devs")
+
+		So(devs.RemoveMember("bob"), ShouldBeNil)
+		So(devs.AddMember("carol"), ShouldBeNil)
+		So(devs.GetMembers(), ShouldResemble, []string{"alice", "carol"})
+		So(len(gtl.getGroupsForMember("bob")), ShouldEqual, 0)
+		So(gtl.getGroupsForMember("carol"), ShouldResemble, []*Group{devs})
+		So(gtl.userOrGroupFromName("carol").User(), ShouldNotBeNil)
+		So(gtl.CheckAccess("carol", "repo1", "", "W"), ShouldBeNil)
+		So(gtl.CheckAccess("bob", "repo1", "", "W"), ShouldNotBeNil)
+
+		So(devs.AddMember("alice").Error(), ShouldEqual, "'alice' is already a member of group '@devs'")
+		So(devs.RemoveMember("bob").Error(), ShouldEqual, "'bob' isn't a member of group '@devs'")
+		So(gtl.GetGroup("@repos").AddMember("dave").Error(), ShouldEqual, "group '@repos' is a repos group, not a user one")
+	})
 }
@@ -0,0 +1,127 @@
+package gitolite
+
+import "strings"
+
+// Merged returns the config gitolite sees: the config with its subconfs
+// (see AddChild) inlined at their subconf line, nested subconfs included.
+// Its configs are in the order gitolite reads them, so RulesForRepo,
+// CheckAccess and CheckPush apply the rules of all files in the right order,
+// and a group used by a subconf without being defined there is the group
+// of that name of the including configs (see RuleUsers).
+// The merged config shares its groups, configs and rules with the configs
+// it merges: it isn't updated when they change.
+func (gtl *Gitolite) Merged() *Gitolite {
+	res := NewGitolite(nil)
+	res.rc = gtl.RC()
+	res.merge(gtl)
+	return res
+}
+
+func (gtl *Gitolite) merge(from *Gitolite) {
+	for _, grp := range from.groups {
+		if gtl.GetGroup(grp.name) == nil {
+			gtl.groupIdx[grp.name] = len(gtl.groups)
+			gtl.groups = append(gtl.groups, grp)
+			for _, member := range grp.members {
+				gtl.indexMember(member, grp)
+			}
+		}
+	}
+	for _, rog := range from.reposOrGroups {
+		if gtl.repoOrGroupFromName(rog.GetName()) == nil {
+			gtl.reposOrGroups = append(gtl.reposOrGroups, rog)
+			gtl.rogsByName[rog.GetName()] = rog
+		}
+	}
+	for _, uog := range from.usersOrGroups {
+		if gtl.userOrGroupFromName(uog.GetName()) == nil {
+			gtl.usersOrGroups = append(gtl.usersOrGroups, uog)
+			gtl.uogsByName[uog.GetName()] = uog
+		}
+	}
+	children := from.children
+	for i, elt := range from.elts {
+		children = gtl.mergeChildren(children, i)
+		gtl.elts = append(gtl.elts, elt)
+		if config, ok := elt.(*Config); ok {
+			gtl.indexConfig(config)
+			gtl.configs = append(gtl.configs, config)
+		}
+	}
+	// children included after the last group or config, or not by a subconf line
+	for _, child := range children {
+		gtl.merge(child)
+	}
+}
+
+// mergeChildren merges the children included by subconf lines read
+// before the elt'th group or config of their parent, and returns the
+// children left.
+func (gtl *Gitolite) mergeChildren(children []*Gitolite, elt int) []*Gitolite {
+	for len(children) > 0 && children[0].includedBy != nil && children[0].includedBy.elt <= elt {
+		gtl.merge(children[0])
+		children = children[1:]
+	}
+	return children
+}
+
+// RuleUsers returns the users of a rule, or its user groups without users,
+// like Rule.GetUsersFirstOrGroups, except for a group a subconf uses
+// without defining it: the users are the members of the group of that
+// name in the config, for a merged config (see Merged).
+func (gtl *Gitolite) RuleUsers(rule *Rule) []UserOrGroup {
+	res := []UserOrGroup{}
+	for _, uog := range rule.usersOrGroups {
+		grp := uog.Group()
+		if grp == nil {
+			res = append(res, uog)
+			continue
+		}
+		users := gtl.GroupUsers(grp)
+		for _, usr := range users {
+			res = append(res, usr)
+		}
+		if len(users) == 0 && len(grp.GetUsersOrGroups()) == 0 {
+			res = append(res, grp)
+		}
+	}
+	return res
+}
+
+// GroupUsers returns the users of a group of a rule, nested groups included:
+// the users of the group of that name in the config if the group is only
+// used by a subconf (see RuleUsers). Members are resolved by name: the
+// users of a group only used in another group aren't marked as users.
+func (gtl *Gitolite) GroupUsers(grp *Group) []*User {
+	if len(grp.members) > 0 {
+		return gtl.usersByName(grp, []*User{}, map[string]bool{grp.name: true})
+	}
+	defined := gtl.GetGroup(grp.name)
+	if defined == nil || defined == grp {
+		return grp.GetAllUsers()
+	}
+	return gtl.usersByName(defined, []*User{}, map[string]bool{grp.name: true})
+}
+
+// usersByName returns the users of a group, resolving its members by name:
+// the group may not have been marked as a users group.
+func (gtl *Gitolite) usersByName(grp *Group, res []*User, seen map[string]bool) []*User {
+	for _, member := range grp.members {
+		if seen[member] {
+			continue
+		}
+		seen[member] = true
+		if strings.HasPrefix(member, "@") {
+			if subgrp := gtl.GetGroup(member); subgrp != nil {
+				res = gtl.usersByName(subgrp, res, seen)
+			}
+			continue
+		}
+		usr := &User{name: member}
+		if uog := gtl.userOrGroupFromName(member); uog != nil && uog.User() != nil {
+			usr = uog.User()
+		}
+		res = append(res, usr)
+	}
+	return res
+}
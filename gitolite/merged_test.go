@@ -0,0 +1,83 @@
+package gitolite
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMerged(t *testing.T) {
+
+	Convey("Subconfs are inlined at their subconf line", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice", "bob"}, nil)
+		cfg, _ := gtl.AddConfig([]string{"foo"}, nil)
+		addRule(gtl, cfg, "-", "master", "bob")
+		gtl.AddNamedSubconf("foo", "foo.conf", 4)
+		last, _ := gtl.AddConfig([]string{"foo"}, nil)
+		addRule(gtl, last, "-", "dev/", "alice")
+		gtl.AddSubconf("bar.conf")
+
+		foo := NewSubconf(gtl, "foo")
+		foocfg, _ := foo.AddConfig([]string{"foo"}, nil)
+		addRule(foo, foocfg, "RW+", "", "@devs")
+		gtl.AddChild(foo, "conf/foo.conf", gtl.Subconfs()[0])
+		bar := NewSubconf(gtl, "bar")
+		barcfg, _ := bar.AddConfig([]string{"foo"}, nil)
+		addRule(bar, barcfg, "R", "", "carol")
+		gtl.AddChild(bar, "conf/bar.conf", gtl.Subconfs()[1])
+
+		merged := gtl.Merged()
+		So(merged.Configs(), ShouldResemble, []*Config{cfg, foocfg, last, barcfg})
+		So(len(merged.Children()), ShouldEqual, 0)
+		So(merged.GetGroup("@devs"), ShouldEqual, gtl.GetGroup("@devs"))
+		So(merged.RulesForRepo("foo")[1], ShouldEqual, foocfg.Rules()[0])
+		So(merged.GetConfigsForRepo("foo"), ShouldResemble, []*Config{cfg, foocfg, last, barcfg})
+
+		So(gtl.CheckAccess("alice", "foo", "refs/heads/dev/x", "+"), ShouldNotBeNil)
+		So(merged.CheckAccess("alice", "foo", "refs/heads/dev/x", "+"), ShouldBeNil)
+		So(merged.CheckAccess("bob", "foo", "refs/heads/master", "W").Error(), ShouldEqual, "W refs/heads/master foo bob DENIED by rule '- master'")
+		So(merged.CheckAccess("carol", "foo", "", "R"), ShouldBeNil)
+	})
+
+	Convey("Groups a subconf uses are the groups of the main config", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice", "@leads"}, nil)
+		gtl.AddUserOrRepoGroup("@leads", []string{"bob"}, nil)
+		gtl.AddSubconf("*.conf")
+		sub := NewSubconf(gtl, "foo")
+		cfg, _ := sub.AddConfig([]string{"foo"}, nil)
+		addRule(sub, cfg, "RW", "", "@devs", "carol", "@ops")
+		gtl.AddChild(sub, "conf/foo.conf", gtl.Subconfs()[0])
+
+		names := func(uogs []UserOrGroup) []string {
+			res := []string{}
+			for _, uog := range uogs {
+				res = append(res, uog.GetName())
+			}
+			return res
+		}
+		rule := cfg.Rules()[0]
+		So(names(sub.RuleUsers(rule)), ShouldResemble, []string{"@devs", "carol", "@ops"})
+		So(names(rule.GetUsersFirstOrGroups()), ShouldResemble, []string{"@devs", "carol", "@ops"})
+		So(names(gtl.Merged().RuleUsers(rule)), ShouldResemble, []string{"alice", "bob", "carol", "@ops"})
+		So(sub.CheckAccess("bob", "foo", "refs/heads/master", "W"), ShouldNotBeNil)
+		So(gtl.Merged().CheckAccess("bob", "foo", "refs/heads/master", "W"), ShouldBeNil)
+	})
+
+	Convey("Users of nested groups are resolved by name", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@leads", []string{"bob"}, nil)
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice", "@leads"}, nil)
+		cfg, _ := gtl.AddConfig([]string{"foo"}, nil)
+		addRule(gtl, cfg, "RW+", "", "@devs")
+
+		devs := cfg.Rules()[0].GetUsersOrGroups()[0].Group()
+		users := []string{}
+		for _, usr := range gtl.GroupUsers(devs) {
+			users = append(users, usr.GetName())
+		}
+		So(users, ShouldResemble, []string{"alice", "bob"})
+		So(gtl.CheckAccess("bob", "foo", "refs/heads/master", "+"), ShouldBeNil)
+	})
+}
@@ -0,0 +1,142 @@
+package gitolite
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RC is the part of a gitolite.rc file (a Perl hash) understood by gogitolite
+type RC struct {
+	umask         int
+	gitConfigKeys string
+	configKeysRx  []*regexp.Regexp
+	roles         []string
+	enable        []string
+	values        map[string]string
+}
+
+// NewRC creates an empty rc: no umask, no git config key allowed, no role.
+func NewRC() *RC {
+	return &RC{values: make(map[string]string)}
+}
+
+// SetUMask sets the UMASK of the rc
+func (rc *RC) SetUMask(umask int) {
+	rc.umask = umask
+}
+
+// UMask returns the UMASK of the rc
+func (rc *RC) UMask() int {
+	return rc.umask
+}
+
+// SetGitConfigKeys sets the space separated list of regexps
+// a 'config' key must match to be allowed (GIT_CONFIG_KEYS)
+func (rc *RC) SetGitConfigKeys(keys string) error {
+	rxs := []*regexp.Regexp{}
+	for _, key := range strings.Fields(keys) {
+		rx, err := regexp.Compile(`(?i)^(?:` + key + `)$`)
+		if err != nil {
+			return fmt.Errorf("invalid GIT_CONFIG_KEYS regexp '%v': %v", key, err.Error())
+		}
+		rxs = append(rxs, rx)
+	}
+	rc.gitConfigKeys = keys
+	rc.configKeysRx = rxs
+	return nil
+}
+
+// GitConfigKeys returns the GIT_CONFIG_KEYS of the rc
+func (rc *RC) GitConfigKeys() string {
+	return rc.gitConfigKeys
+}
+
+// IsGitConfigKeyAllowed checks if a 'config' key matches GIT_CONFIG_KEYS.
+// Options keys ('gitolite-options.xxx') are always allowed.
+func (rc *RC) IsGitConfigKeyAllowed(key string) bool {
+	if strings.HasPrefix(key, "gitolite-options.") {
+		return true
+	}
+	for _, rx := range rc.configKeysRx {
+		if rx.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRole adds a role name (ROLES), like READERS or WRITERS
+func (rc *RC) AddRole(role string) {
+	rc.roles = addStringNoDup(rc.roles, role)
+}
+
+// Roles returns the role names of the rc
+func (rc *RC) Roles() []string {
+	return rc.roles
+}
+
+// IsRole checks if a name is a role name of the rc
+func (rc *RC) IsRole(name string) bool {
+	return isNameSeen(name, rc.roles)
+}
+
+// Enable adds a feature to the list of enabled features (ENABLE)
+func (rc *RC) Enable(feature string) {
+	rc.enable = addStringNoDup(rc.enable, feature)
+}
+
+// Enabled returns the enabled features of the rc
+func (rc *RC) Enabled() []string {
+	return rc.enable
+}
+
+// IsEnabled checks if a feature is enabled in the rc
+func (rc *RC) IsEnabled(feature string) bool {
+	return isNameSeen(feature, rc.enable)
+}
+
+// SetValue sets any other (scalar) rc value
+func (rc *RC) SetValue(key, value string) {
+	rc.values[key] = value
+}
+
+// Value returns any other (scalar) rc value, empty string if not set
+func (rc *RC) Value(key string) string {
+	return rc.values[key]
+}
+
+// String exposes RC internals
+func (rc *RC) String() string {
+	keys := []string{}
+	for key := range rc.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := []string{}
+	for _, key := range keys {
+		values = append(values, key+"="+rc.values[key])
+	}
+	return fmt.Sprintf("UMASK: %04o, GIT_CONFIG_KEYS: '%v', ROLES: %v, ENABLE: %v, values: %v",
+		rc.umask, rc.gitConfigKeys, rc.roles, rc.enable, values)
+}
+
+// SetRC sets the rc a gitolite config (and its subconfs) is read with
+func (gtl *Gitolite) SetRC(rc *RC) {
+	gtl.rc = rc
+}
+
+// RC returns the rc of a gitolite config (or of its parent), nil if none.
+func (gtl *Gitolite) RC() *RC {
+	if gtl.rc == nil && gtl.parent != nil {
+		return gtl.parent.RC()
+	}
+	return gtl.rc
+}
+
+// IsRole checks if a name is a role name of the gitolite config rc
+func (gtl *Gitolite) IsRole(name string) bool {
+	rc := gtl.RC()
+	return rc != nil && rc.IsRole(name)
+}
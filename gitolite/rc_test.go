@@ -0,0 +1,81 @@
+package gitolite
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRC(t *testing.T) {
+
+	Convey("An RC holds gitolite.rc settings", t, func() {
+		rc := NewRC()
+		So(rc.UMask(), ShouldEqual, 0)
+		So(rc.IsGitConfigKeyAllowed("core.sharedRepository"), ShouldBeFalse)
+		So(rc.IsGitConfigKeyAllowed("gitolite-options.deny-rules"), ShouldBeTrue)
+
+		rc.SetUMask(0077)
+		So(rc.UMask(), ShouldEqual, 63)
+
+		err := rc.SetGitConfigKeys("core\\.sharedRepository hooks\\..*")
+		So(err, ShouldBeNil)
+		So(rc.GitConfigKeys(), ShouldEqual, "core\\.sharedRepository hooks\\..*")
+		So(rc.IsGitConfigKeyAllowed("core.sharedRepository"), ShouldBeTrue)
+		So(rc.IsGitConfigKeyAllowed("core.sharedrepository"), ShouldBeTrue)
+		So(rc.IsGitConfigKeyAllowed("core.sharedRepository2"), ShouldBeFalse)
+		So(rc.IsGitConfigKeyAllowed("hooks.mailinglist"), ShouldBeTrue)
+		err = rc.SetGitConfigKeys("core(")
+		So(err.Error(), ShouldStartWith, "invalid GIT_CONFIG_KEYS regexp 'core('")
+		So(rc.IsGitConfigKeyAllowed("hooks.mailinglist"), ShouldBeTrue)
+
+		rc.AddRole("READERS")
+		rc.AddRole("MANAGERS")
+		rc.AddRole("READERS")
+		So(rc.Roles(), ShouldResemble, []string{"READERS", "MANAGERS"})
+		So(rc.IsRole("MANAGERS"), ShouldBeTrue)
+		So(rc.IsRole("WRITERS"), ShouldBeFalse)
+
+		rc.Enable("help")
+		rc.Enable("desc")
+		So(rc.Enabled(), ShouldResemble, []string{"help", "desc"})
+		So(rc.IsEnabled("desc"), ShouldBeTrue)
+		So(rc.IsEnabled("mirror"), ShouldBeFalse)
+
+		rc.SetValue("LOG_EXTRA", "1")
+		So(rc.Value("LOG_EXTRA"), ShouldEqual, "1")
+		So(rc.Value("UNKNOWN"), ShouldEqual, "")
+		So(rc.String(), ShouldEqual, "UMASK: 0077, GIT_CONFIG_KEYS: 'core\\.sharedRepository hooks\\..*', ROLES: [READERS MANAGERS], ENABLE: [help desc], values: [LOG_EXTRA=1]")
+	})
+
+	Convey("A Gitolite honors its rc (or its parent's)", t, func() {
+		gtl := NewGitolite(nil)
+		sub := NewGitolite(gtl)
+		So(sub.RC(), ShouldBeNil)
+		So(sub.IsRole("WRITERS"), ShouldBeFalse)
+		cfg, _ := sub.AddConfig([]string{"repo1"}, nil)
+		So(sub.AddGitConfig(cfg, "core.bare", "false", false, nil), ShouldBeNil)
+
+		rc := NewRC()
+		rc.AddRole("WRITERS")
+		gtl.SetRC(rc)
+		So(sub.RC(), ShouldEqual, rc)
+		So(sub.IsRole("WRITERS"), ShouldBeTrue)
+		err := sub.AddGitConfig(cfg, "core.bare", "true", false, nil)
+		So(err.Error(), ShouldEqual, "git config 'core.bare' not allowed, check GIT_CONFIG_KEYS in the rc file")
+		So(sub.AddGitConfig(cfg, "deny-rules", "1", true, &Comment{[]string{"deny"}, "same line"}), ShouldBeNil)
+
+		So(len(cfg.GitConfigs()), ShouldEqual, 2)
+		So(cfg.GitConfigs()[0].Key(), ShouldEqual, "core.bare")
+		So(cfg.GitConfigs()[0].Value(), ShouldEqual, "false")
+		So(cfg.GitConfigs()[0].IsOption(), ShouldBeFalse)
+		So(cfg.GitConfigs()[1].IsOption(), ShouldBeTrue)
+		So(cfg.Option("deny-rules"), ShouldEqual, "1")
+		So(cfg.Option("core.bare"), ShouldEqual, "")
+		So(cfg.Print(), ShouldEqual, `repo repo1
+    config core.bare = false
+    # deny
+    option deny-rules = 1 # same line
+
+`)
+	})
+}
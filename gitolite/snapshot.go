@@ -0,0 +1,147 @@
+package gitolite
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Snapshot is a read-only config, which can be read from several goroutines.
+// It is a copy of the config it is built from (see Clone), which can be
+// modified afterwards.
+type Snapshot struct {
+	gtl *Gitolite
+}
+
+// RuleView is a read-only copy of a rule: its access, param, and the
+// names of its users or groups.
+type RuleView struct {
+	Access        string
+	Param         string
+	UsersOrGroups []string
+}
+
+func (rv RuleView) String() string {
+	return strings.TrimSpace(rv.Access+" "+rv.Param) + " = " + strings.Join(rv.UsersOrGroups, " ")
+}
+
+// ConfigView is a read-only copy of a config: the names of its repos or
+// groups, its desc, its rules, and its 'config' or 'option' lines.
+type ConfigView struct {
+	ReposOrGroups []string
+	Desc          string
+	Rules         []RuleView
+	GitConfigs    []string
+}
+
+// Freeze returns a snapshot of a loaded config, its subconfs inlined
+// (see Merged).
+func Freeze(gtl *Gitolite) *Snapshot {
+	return &Snapshot{gtl: gtl.Clone().Merged()}
+}
+
+func ruleView(rule *Rule) RuleView {
+	res := RuleView{Access: rule.access, Param: rule.param, UsersOrGroups: []string{}}
+	for _, uog := range rule.usersOrGroups {
+		res.UsersOrGroups = append(res.UsersOrGroups, uog.GetName())
+	}
+	return res
+}
+
+// RulesForRepo returns the rules applying to a repo, in order
+// (see Gitolite.RulesForRepo), as read-only copies.
+func (snap *Snapshot) RulesForRepo(reponame string) []RuleView {
+	res := []RuleView{}
+	for _, rule := range snap.gtl.RulesForRepo(reponame) {
+		res = append(res, ruleView(rule))
+	}
+	return res
+}
+
+// GetConfigsForRepo returns the configs of a repo (see
+// Gitolite.GetConfigsForRepo), as read-only copies.
+func (snap *Snapshot) GetConfigsForRepo(reponame string) []ConfigView {
+	res := []ConfigView{}
+	for _, cfg := range snap.gtl.GetConfigsForRepo(reponame) {
+		cv := ConfigView{ReposOrGroups: []string{}, Desc: cfg.desc, Rules: []RuleView{}, GitConfigs: []string{}}
+		for _, rog := range cfg.reposOrGroups {
+			cv.ReposOrGroups = append(cv.ReposOrGroups, rog.GetName())
+		}
+		for _, rule := range cfg.rules {
+			cv.Rules = append(cv.Rules, ruleView(rule))
+		}
+		for _, gc := range cfg.gitConfigs {
+			kind := "config"
+			if gc.option {
+				kind = "option"
+			}
+			cv.GitConfigs = append(cv.GitConfigs, fmt.Sprintf("%v %v = %v", kind, gc.key, gc.value))
+		}
+		res = append(res, cv)
+	}
+	return res
+}
+
+// CheckAccess checks if a user has a permission on a ref of a repo (see Gitolite.CheckAccess)
+func (snap *Snapshot) CheckAccess(username, reponame, ref, perm string) error {
+	return snap.gtl.CheckAccess(username, reponame, ref, perm)
+}
+
+// CheckPush checks if a user can push to a repo (see Gitolite.CheckPush)
+func (snap *Snapshot) CheckPush(username, reponame string, push *Push) error {
+	return snap.gtl.CheckPush(username, reponame, push)
+}
+
+// GroupMembers returns the members of a group, nil if the group doesn't exist
+func (snap *Snapshot) GroupMembers(groupname string) []string {
+	grp := snap.gtl.GetGroup(groupname)
+	if grp == nil {
+		return nil
+	}
+	return append([]string{}, grp.GetMembers()...)
+}
+
+// Users returns the names of the users, in reading order
+func (snap *Snapshot) Users() []string {
+	res := []string{}
+	for _, uog := range snap.gtl.GetUsersOrGroups() {
+		if uog.User() != nil {
+			res = append(res, uog.GetName())
+		}
+	}
+	return res
+}
+
+// Repos returns the names of the repos, in reading order
+func (snap *Snapshot) Repos() []string {
+	res := []string{}
+	for _, rog := range snap.gtl.GetReposOrGroups() {
+		if rog.Repo() != nil {
+			res = append(res, rog.GetName())
+		}
+	}
+	return res
+}
+
+// Print prints the config, its subconfs inlined
+func (snap *Snapshot) Print() string {
+	return snap.gtl.Print()
+}
+
+// Holder holds a snapshot, replaced atomically: readers get the snapshot
+// before or after a reload, never a config being loaded.
+// The zero Holder holds no snapshot.
+type Holder struct {
+	v atomic.Value
+}
+
+// Load returns the current snapshot, nil if none has been stored yet
+func (h *Holder) Load() *Snapshot {
+	snap, _ := h.v.Load().(*Snapshot)
+	return snap
+}
+
+// Store replaces the current snapshot
+func (h *Holder) Store(snap *Snapshot) {
+	h.v.Store(snap)
+}
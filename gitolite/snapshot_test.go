@@ -0,0 +1,139 @@
+package gitolite
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSnapshot(t *testing.T) {
+
+	Convey("A snapshot is a read-only config", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice", "bob"}, nil)
+		cfg, _ := gtl.AddConfig([]string{"foo"}, nil)
+		addRule(gtl, cfg, "RW", "", "@devs")
+		gtl.AddSubconf("*.conf")
+		sub := NewSubconf(gtl, "bar")
+		subcfg, _ := sub.AddConfig([]string{"bar"}, nil)
+		addRule(sub, subcfg, "R", "", "carol")
+		gtl.AddChild(sub, "conf/bar.conf", gtl.Subconfs()[0])
+
+		snap := Freeze(gtl)
+		So(snap.CheckAccess("alice", "foo", "refs/heads/master", "W"), ShouldBeNil)
+		So(snap.CheckAccess("carol", "bar", "", "R"), ShouldBeNil)
+		So(snap.CheckPush("bob", "foo", &Push{Ref: "refs/heads/master"}), ShouldBeNil)
+		So(len(snap.RulesForRepo("foo")), ShouldEqual, 1)
+		So(len(snap.GetConfigsForRepo("bar")), ShouldEqual, 1)
+		So(snap.GroupMembers("@devs"), ShouldResemble, []string{"alice", "bob"})
+		So(snap.GroupMembers("@ops"), ShouldBeNil)
+		So(snap.Users(), ShouldResemble, []string{"alice", "bob", "carol"})
+		So(snap.Repos(), ShouldResemble, []string{"foo", "bar"})
+		So(snap.Print(), ShouldEqual, "@devs = alice bob\n\nrepo foo\n    RW    = @devs\n\nrepo bar\n    R     = carol\n\n")
+
+		Convey("It isn't changed by configs added afterwards", func() {
+			more, _ := gtl.AddConfig([]string{"foo"}, nil)
+			addRule(gtl, more, "RW+", "", "dave")
+			So(len(gtl.RulesForRepo("foo")), ShouldEqual, 2)
+			So(len(snap.RulesForRepo("foo")), ShouldEqual, 1)
+			So(snap.CheckAccess("dave", "foo", "", "R"), ShouldNotBeNil)
+		})
+
+		Convey("It isn't changed by groups modified afterwards", func() {
+			gtl.GetGroup("@devs").addMember("carol")
+			So(gtl.GetGroup("@devs").GetMembers(), ShouldResemble, []string{"alice", "bob", "carol"})
+			So(snap.GroupMembers("@devs"), ShouldResemble, []string{"alice", "bob"})
+		})
+
+		Convey("The rules and configs it returns are read-only copies", func() {
+			rules := snap.RulesForRepo("foo")
+			So(rules, ShouldResemble, []RuleView{{Access: "RW", Param: "", UsersOrGroups: []string{"@devs"}}})
+			So(rules[0].String(), ShouldEqual, "RW = @devs")
+			rules[0].UsersOrGroups[0] = "dave"
+			So(snap.RulesForRepo("foo")[0].UsersOrGroups, ShouldResemble, []string{"@devs"})
+			So(snap.CheckAccess("dave", "foo", "", "R"), ShouldNotBeNil)
+			gtl.AddGitConfig(subcfg, "deny-rules", "1", true, nil)
+			cfgs := Freeze(gtl).GetConfigsForRepo("bar")
+			So(cfgs, ShouldResemble, []ConfigView{{ReposOrGroups: []string{"bar"}, Desc: "",
+				Rules: []RuleView{{Access: "R", Param: "", UsersOrGroups: []string{"carol"}}}, GitConfigs: []string{"option deny-rules = 1"}}})
+		})
+	})
+
+	Convey("A holder swaps snapshots while they are read", t, func() {
+		h := &Holder{}
+		So(h.Load(), ShouldBeNil)
+		snapFor := func(user string) *Snapshot {
+			gtl := NewGitolite(nil)
+			cfg, _ := gtl.AddConfig([]string{"foo"}, nil)
+			addRule(gtl, cfg, "R", "", user)
+			return Freeze(gtl)
+		}
+		alice, bob := snapFor("alice"), snapFor("bob")
+		h.Store(alice)
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					snap := h.Load()
+					if snap.CheckAccess("alice", "foo", "", "R") != nil && snap.CheckAccess("bob", "foo", "", "R") != nil {
+						errs <- snap.CheckAccess("alice", "foo", "", "R")
+						return
+					}
+				}
+			}()
+		}
+		for j := 0; j < 200; j++ {
+			if j%2 == 0 {
+				h.Store(bob)
+			} else {
+				h.Store(alice)
+			}
+		}
+		wg.Wait()
+		close(errs)
+		So(len(errs), ShouldEqual, 0)
+		So(h.Load(), ShouldEqual, alice)
+	})
+
+	Convey("A snapshot is printed and read concurrently", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice", "bob"}, nil)
+		cfg, _ := gtl.AddConfig([]string{"foo"}, nil)
+		addRule(gtl, cfg, "RW+", "master", "@devs")
+		addRule(gtl, cfg, "R", "", "carol")
+		h := &Holder{}
+		h.Store(Freeze(gtl))
+		expected := h.Load().Print()
+		var wg sync.WaitGroup
+		reads := make(chan string, 8*50)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					snap := h.Load()
+					if i%2 == 0 {
+						reads <- snap.Print()
+					} else if snap.CheckAccess("alice", "foo", "refs/heads/master", "W") == nil {
+						rules := []string{}
+						for _, rule := range snap.RulesForRepo("foo") {
+							rules = append(rules, rule.String())
+						}
+						reads <- strings.Join(rules, ", ")
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(reads)
+		So(len(reads), ShouldEqual, 8*50)
+		for r := range reads {
+			So(r, ShouldBeIn, expected, "RW+ master = @devs, R = carol")
+		}
+	})
+}
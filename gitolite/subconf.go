@@ -0,0 +1,215 @@
+package gitolite
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Subconf is a 'subconf' line of a gitolite config: a glob pattern of files
+// to include, with an optional explicit subconf name ('subconf name = "path"')
+type Subconf struct {
+	name    string
+	pattern string
+	line    int
+	// elt is the number of groups and configs read before the subconf line
+	elt int
+}
+
+// AddSubconf adds a new subconf glob pattern to the gitolite configuration
+// Duplicate is ignored
+// If the pattern is malformed, return the error
+func (gtl *Gitolite) AddSubconf(subconf string) error {
+	return gtl.AddNamedSubconf("", subconf, 0)
+}
+
+// AddNamedSubconf adds a subconf read at a given line, with an explicit name:
+// files included by that subconf line are named 'name' instead of after their
+// file name (an empty name means no explicit name).
+// Duplicate is ignored.
+func (gtl *Gitolite) AddNamedSubconf(name, subconf string, line int) error {
+	if _, err := path.Match(subconf, ""); err != nil {
+		return fmt.Errorf("%v: '%v'", err.Error(), subconf)
+	}
+	for _, sc := range gtl.subconfs {
+		if sc.pattern == subconf && sc.name == name {
+			return nil
+		}
+	}
+	gtl.subconfs = append(gtl.subconfs, &Subconf{name: name, pattern: subconf, line: line, elt: len(gtl.elts)})
+	return nil
+}
+
+// Subconfs returns the subconf lines read in the gitolite.conf
+func (gtl *Gitolite) Subconfs() []*Subconf {
+	return gtl.subconfs
+}
+
+// Name returns the explicit name of a subconf line, empty if none
+func (sc *Subconf) Name() string {
+	return sc.name
+}
+
+// Pattern returns the file pattern of a subconf line
+func (sc *Subconf) Pattern() string {
+	return sc.pattern
+}
+
+// Line returns the line number of a subconf line (0 if unknown)
+func (sc *Subconf) Line() int {
+	return sc.line
+}
+
+// MatchString checks if a file name (relative to the directory of the file
+// declaring the subconf line) is included by a subconf line.
+// Like a shell glob, '*' doesn't match '/'.
+func (sc *Subconf) MatchString(relname string) bool {
+	matched, _ := path.Match(sc.pattern, relname)
+	return matched
+}
+
+// String returns the subconf line
+func (sc *Subconf) String() string {
+	if sc.name != "" {
+		return fmt.Sprintf("subconf %v = \"%v\"", sc.name, sc.pattern)
+	}
+	return fmt.Sprintf("subconf \"%v\"", sc.pattern)
+}
+
+// NewSubconf creates an empty gitolite config for the subconf 'name'
+// included by parent.
+func NewSubconf(parent *Gitolite, name string) *Gitolite {
+	res := NewGitolite(parent)
+	res.subconf = name
+	return res
+}
+
+// SubconfName returns the name of a subconf, empty for the main config
+func (gtl *Gitolite) SubconfName() string {
+	return gtl.subconf
+}
+
+// Parent returns the config including a subconf, nil for the main config
+func (gtl *Gitolite) Parent() *Gitolite {
+	return gtl.parent
+}
+
+// AddChild records a subconf read from a file included by a subconf line
+// of the config
+func (gtl *Gitolite) AddChild(child *Gitolite, path string, includedBy *Subconf) {
+	child.path = path
+	child.includedBy = includedBy
+	gtl.children = append(gtl.children, child)
+}
+
+// MarkParentGroups marks the groups of the including configs used in the
+// 'repo' lines of a subconf as repo groups.
+// Reading a subconf doesn't modify the configs including it, so that
+// subconfs can be read concurrently: their groups are marked afterwards,
+// in reading order.
+func (gtl *Gitolite) MarkParentGroups() {
+	for _, grp := range gtl.parentGroups {
+		// can't fail: checked when read, and subconfs don't mark
+		// groups of their parent as users groups
+		grp.MarkAsRepoGroup()
+	}
+	gtl.parentGroups = nil
+}
+
+// Children returns the subconfs included by the config, in reading order
+func (gtl *Gitolite) Children() []*Gitolite {
+	return gtl.children
+}
+
+// Path returns the file a subconf has been read from (see AddChild)
+func (gtl *Gitolite) Path() string {
+	return gtl.path
+}
+
+// IncludedBy returns the subconf line of the parent config which included
+// a subconf, nil for the main config
+func (gtl *Gitolite) IncludedBy() *Subconf {
+	return gtl.includedBy
+}
+
+// prefixGroupName prefixes the name of a group defined in subconf 'foo'
+// with 'foo.', like gitolite does: '@bar' becomes '@foo.bar'.
+// The prefixed name is remembered, for LocalGroupName to use.
+func (gtl *Gitolite) prefixGroupName(grpname string) string {
+	if gtl.subconf == "" || grpname == "@all" || strings.HasPrefix(grpname, "@"+gtl.subconf+".") {
+		return grpname
+	}
+	if gtl.localGroups == nil {
+		gtl.localGroups = make(map[string]string)
+	}
+	prefixed := "@" + gtl.subconf + "." + grpname[1:]
+	gtl.localGroups[grpname] = prefixed
+	return prefixed
+}
+
+// LocalGroupName returns the (prefixed) name of a group defined earlier
+// in the subconf, or the name unchanged.
+func (gtl *Gitolite) LocalGroupName(name string) string {
+	if prefixed, ok := gtl.localGroups[name]; ok {
+		return prefixed
+	}
+	return name
+}
+
+// IsRepoAllowed checks if a subconf can set access for a repo or repo group.
+// Like gitolite, subconf 'foo' can only set access for 'foo', '@foo', or
+// members of '@foo' as defined by the parent config (members are patterns).
+// A group defined in the subconf (see LocalGroupName) is allowed if all
+// its members are.
+// The main config can set access for any repo.
+func (gtl *Gitolite) IsRepoAllowed(rpname string) bool {
+	if gtl.subconf == "" || rpname == gtl.subconf || rpname == "@"+gtl.subconf {
+		return true
+	}
+	if gtl.isLocalGroup(rpname) {
+		for _, member := range gtl.GetGroup(rpname).GetMembers() {
+			if !gtl.IsRepoAllowed(member) {
+				return false
+			}
+		}
+		return true
+	}
+	if gtl.parent == nil {
+		return false
+	}
+	grp := gtl.parent.getGroup("@" + gtl.subconf)
+	if grp == nil {
+		return false
+	}
+	for _, member := range grp.GetMembers() {
+		if member == rpname {
+			return true
+		}
+		if rx, err := regexp.Compile("^(?:" + member + ")$"); err == nil && rx.MatchString(rpname) {
+			return true
+		}
+	}
+	return false
+}
+
+func (gtl *Gitolite) isLocalGroup(name string) bool {
+	for _, prefixed := range gtl.localGroups {
+		if prefixed == name {
+			return gtl.GetGroup(name) != nil
+		}
+	}
+	return false
+}
+
+// AddScopeViolation records an attempt of a subconf to set access
+// for a repo it isn't allowed to (see IsRepoAllowed)
+func (gtl *Gitolite) AddScopeViolation(err error) {
+	gtl.violations = append(gtl.violations, err)
+}
+
+// ScopeViolations returns the repos a subconf tried to set access for,
+// and which have been ignored.
+func (gtl *Gitolite) ScopeViolations() []error {
+	return gtl.violations
+}
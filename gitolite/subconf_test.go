@@ -0,0 +1,86 @@
+package gitolite
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubconf(t *testing.T) {
+
+	Convey("A subconf knows its name", t, func() {
+		gtl := NewGitolite(nil)
+		So(gtl.SubconfName(), ShouldEqual, "")
+		sub := NewSubconf(gtl, "foo")
+		So(sub.SubconfName(), ShouldEqual, "foo")
+	})
+
+	Convey("Subconfs form a tree", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice"}, nil)
+		sub := NewSubconf(gtl, "foo")
+		subsub := NewSubconf(sub, "bar")
+		gtl.AddSubconf("*.conf")
+		gtl.AddChild(sub, "conf/foo.conf", gtl.Subconfs()[0])
+		sub.AddChild(subsub, "conf/foo/bar.conf", nil)
+		So(gtl.Parent(), ShouldBeNil)
+		So(gtl.Path(), ShouldEqual, "")
+		So(gtl.IncludedBy(), ShouldBeNil)
+		So(sub.IncludedBy().Pattern(), ShouldEqual, "*.conf")
+		So(gtl.Children(), ShouldResemble, []*Gitolite{sub})
+		So(subsub.Parent(), ShouldEqual, sub)
+		So(subsub.Path(), ShouldEqual, "conf/foo/bar.conf")
+		So(len(subsub.Children()), ShouldEqual, 0)
+		So(subsub.getGroup("@devs"), ShouldEqual, gtl.GetGroup("@devs"))
+		So(subsub.getGroup("@ops"), ShouldBeNil)
+	})
+
+	Convey("Groups defined in a subconf are prefixed", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@devs", []string{"alice"}, nil)
+		So(gtl.LocalGroupName("@devs"), ShouldEqual, "@devs")
+
+		sub := NewSubconf(gtl, "foo")
+		So(sub.AddUserOrRepoGroup("@devs", []string{"bob"}, nil), ShouldBeNil)
+		So(sub.AddUserOrRepoGroup("@foo.qa", []string{"carol"}, nil), ShouldBeNil)
+		So(sub.GetGroup("@foo.devs").GetMembers(), ShouldResemble, []string{"bob"})
+		So(sub.GetGroup("@devs"), ShouldBeNil)
+		So(sub.GetGroup("@foo.qa"), ShouldNotBeNil)
+		So(sub.LocalGroupName("@devs"), ShouldEqual, "@foo.devs")
+		So(sub.LocalGroupName("@all"), ShouldEqual, "@all")
+		So(sub.LocalGroupName("@ops"), ShouldEqual, "@ops")
+		So(gtl.GetGroup("@devs").GetMembers(), ShouldResemble, []string{"alice"})
+	})
+
+	Convey("A subconf can only set access for repos in its scope", t, func() {
+		gtl := NewGitolite(nil)
+		gtl.AddUserOrRepoGroup("@foo", []string{"foo-app", "foo-lib", "foo/tools/.*"}, nil)
+		So(gtl.IsRepoAllowed("bar"), ShouldBeTrue)
+
+		sub := NewSubconf(gtl, "foo")
+		So(sub.IsRepoAllowed("foo"), ShouldBeTrue)
+		So(sub.IsRepoAllowed("@foo"), ShouldBeTrue)
+		So(sub.IsRepoAllowed("foo-app"), ShouldBeTrue)
+		So(sub.IsRepoAllowed("foo/tools/x"), ShouldBeTrue)
+		So(sub.IsRepoAllowed("foo-app2"), ShouldBeFalse)
+		So(sub.IsRepoAllowed("gitolite-admin"), ShouldBeFalse)
+		So(sub.IsRepoAllowed("@foo.local"), ShouldBeFalse)
+
+		Convey("A group of the subconf is allowed if all its members are", func() {
+			So(sub.AddUserOrRepoGroup("@libs", []string{"foo-lib", "foo/tools/y"}, nil), ShouldBeNil)
+			So(sub.AddUserOrRepoGroup("@mixed", []string{"foo-lib", "bar"}, nil), ShouldBeNil)
+			So(sub.IsRepoAllowed("@foo.libs"), ShouldBeTrue)
+			So(sub.IsRepoAllowed("@foo.mixed"), ShouldBeFalse)
+		})
+
+		sub = NewSubconf(gtl, "bar")
+		So(sub.IsRepoAllowed("bar"), ShouldBeTrue)
+		So(sub.IsRepoAllowed("foo-app"), ShouldBeFalse)
+		So(NewSubconf(nil, "bar").IsRepoAllowed("baz"), ShouldBeFalse)
+
+		So(len(sub.ScopeViolations()), ShouldEqual, 0)
+		sub.AddScopeViolation(fmt.Errorf("violation"))
+		So(sub.ScopeViolations()[0].Error(), ShouldEqual, "violation")
+	})
+}
@@ -0,0 +1,156 @@
+package gitolite
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VREFKind is the kind of a VREF rule: NAME, COUNT, MAX_NEWBIN_SIZE or custom
+type VREFKind int
+
+const (
+	// VREFCustom is a VREF gogitolite cannot evaluate (custom VREF helper)
+	VREFCustom VREFKind = iota
+	// VREFName restricts the files a push can change (VREF/NAME/path)
+	VREFName
+	// VREFCount limits the number of files a push can change (VREF/COUNT/n[/NEWFILES])
+	VREFCount
+	// VREFMaxNewBinSize limits the size of new binary files (VREF/MAX_NEWBIN_SIZE/n)
+	VREFMaxNewBinSize
+)
+
+const vrefPrefix = "VREF/"
+
+// VREF is the typed parameter of a rule starting with 'VREF/'
+type VREF struct {
+	kind     VREFKind
+	name     string
+	args     []string
+	path     string
+	pathRx   *regexp.Regexp
+	count    int
+	newFiles bool
+	size     int64
+}
+
+// IsVREF checks if a rule parameter is a VREF
+func IsVREF(param string) bool {
+	return strings.HasPrefix(param, vrefPrefix)
+}
+
+// ParseVREF decodes a VREF rule parameter, like 'VREF/NAME/conf/subs/',
+// 'VREF/COUNT/5/NEWFILES' or 'VREF/MAX_NEWBIN_SIZE/1000'.
+// Any other VREF name is a custom VREF, kept with its arguments.
+func ParseVREF(param string) (*VREF, error) {
+	if !IsVREF(param) {
+		return nil, fmt.Errorf("'%v' is not a VREF", param)
+	}
+	parts := strings.Split(param[len(vrefPrefix):], "/")
+	res := &VREF{name: parts[0], args: parts[1:]}
+	switch res.name {
+	case "":
+		return nil, fmt.Errorf("VREF '%v' without name", param)
+	case "NAME":
+		res.kind = VREFName
+		res.path = strings.Join(res.args, "/")
+		rx, err := regexp.Compile("^" + res.path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VREF NAME path '%v': %v", res.path, err.Error())
+		}
+		res.pathRx = rx
+	case "COUNT":
+		res.kind = VREFCount
+		if len(res.args) == 0 || len(res.args) > 2 || (len(res.args) == 2 && res.args[1] != "NEWFILES") {
+			return nil, fmt.Errorf("VREF COUNT expects 'VREF/COUNT/n[/NEWFILES]', not '%v'", param)
+		}
+		count, err := strconv.Atoi(res.args[0])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid VREF COUNT limit '%v'", res.args[0])
+		}
+		res.count = count
+		res.newFiles = len(res.args) == 2
+	case "MAX_NEWBIN_SIZE":
+		res.kind = VREFMaxNewBinSize
+		if len(res.args) != 1 {
+			return nil, fmt.Errorf("VREF MAX_NEWBIN_SIZE expects 'VREF/MAX_NEWBIN_SIZE/n', not '%v'", param)
+		}
+		size, err := strconv.ParseInt(res.args[0], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid VREF MAX_NEWBIN_SIZE limit '%v'", res.args[0])
+		}
+		res.size = size
+	}
+	return res, nil
+}
+
+// Kind returns the kind of VREF
+func (vref *VREF) Kind() VREFKind {
+	return vref.kind
+}
+
+// Name returns the VREF name: NAME, COUNT, MAX_NEWBIN_SIZE or a custom name
+func (vref *VREF) Name() string {
+	return vref.name
+}
+
+// Args returns the VREF arguments (the '/' separated elements after its name)
+func (vref *VREF) Args() []string {
+	return vref.args
+}
+
+// Path returns the path pattern of a NAME VREF (a regexp anchored at the start)
+func (vref *VREF) Path() string {
+	return vref.path
+}
+
+// Count returns the limit of a COUNT VREF
+func (vref *VREF) Count() int {
+	return vref.count
+}
+
+// NewFiles checks if a COUNT VREF only counts new files
+func (vref *VREF) NewFiles() bool {
+	return vref.newFiles
+}
+
+// Size returns the limit (in bytes) of a MAX_NEWBIN_SIZE VREF
+func (vref *VREF) Size() int64 {
+	return vref.size
+}
+
+// String returns the VREF as a rule parameter
+func (vref *VREF) String() string {
+	return vrefPrefix + strings.Join(append([]string{vref.name}, vref.args...), "/")
+}
+
+// MatchesPath checks if a file path is covered by a NAME VREF
+func (vref *VREF) MatchesPath(path string) bool {
+	return vref.kind == VREFName && vref.pathRx.MatchString(path)
+}
+
+// Triggered checks if a push triggers a COUNT or MAX_NEWBIN_SIZE VREF,
+// meaning the rule applies to that push (NAME VREFs apply per file, see MatchesPath).
+// Custom VREFs are never triggered, since their helper cannot be run.
+func (vref *VREF) Triggered(push *Push) bool {
+	switch vref.kind {
+	case VREFCount:
+		if vref.newFiles {
+			return len(push.NewFiles) > vref.count
+		}
+		return len(push.Files) > vref.count
+	case VREFMaxNewBinSize:
+		for _, size := range push.BinSizes {
+			if size > vref.size {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VREF returns the VREF of a rule, nil if the rule parameter isn't a valid VREF.
+func (rule *Rule) VREF() *VREF {
+	return rule.vref
+}
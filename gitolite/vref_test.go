@@ -0,0 +1,85 @@
+package gitolite
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVREF(t *testing.T) {
+
+	Convey("VREFs are typed", t, func() {
+		So(IsVREF("VREF/NAME/conf"), ShouldBeTrue)
+		So(IsVREF("master"), ShouldBeFalse)
+
+		vref, err := ParseVREF("VREF/NAME/conf/subs/")
+		So(err, ShouldBeNil)
+		So(vref.Kind(), ShouldEqual, VREFName)
+		So(vref.Name(), ShouldEqual, "NAME")
+		So(vref.Path(), ShouldEqual, "conf/subs/")
+		So(vref.MatchesPath("conf/subs/project.conf"), ShouldBeTrue)
+		So(vref.MatchesPath("conf/gitolite.conf"), ShouldBeFalse)
+		So(vref.String(), ShouldEqual, "VREF/NAME/conf/subs/")
+
+		vref, _ = ParseVREF("VREF/NAME/")
+		So(vref.MatchesPath("any/file"), ShouldBeTrue)
+
+		vref, err = ParseVREF("VREF/COUNT/5/NEWFILES")
+		So(err, ShouldBeNil)
+		So(vref.Kind(), ShouldEqual, VREFCount)
+		So(vref.Count(), ShouldEqual, 5)
+		So(vref.NewFiles(), ShouldBeTrue)
+		So(vref.MatchesPath("any/file"), ShouldBeFalse)
+		vref, _ = ParseVREF("VREF/COUNT/1")
+		So(vref.NewFiles(), ShouldBeFalse)
+
+		vref, err = ParseVREF("VREF/MAX_NEWBIN_SIZE/1000")
+		So(err, ShouldBeNil)
+		So(vref.Kind(), ShouldEqual, VREFMaxNewBinSize)
+		So(vref.Size(), ShouldEqual, 1000)
+
+		vref, err = ParseVREF("VREF/EMAIL-CHECK/a/b")
+		So(err, ShouldBeNil)
+		So(vref.Kind(), ShouldEqual, VREFCustom)
+		So(vref.Name(), ShouldEqual, "EMAIL-CHECK")
+		So(vref.Args(), ShouldResemble, []string{"a", "b"})
+		So(vref.String(), ShouldEqual, "VREF/EMAIL-CHECK/a/b")
+		So(vref.Triggered(&Push{Files: []string{"a"}}), ShouldBeFalse)
+	})
+
+	Convey("Invalid VREFs are detected", t, func() {
+		for _, test := range []struct{ param, msg string }{
+			{"master", "'master' is not a VREF"},
+			{"VREF/", "VREF 'VREF/' without name"},
+			{"VREF/NAME/a(", "invalid VREF NAME path 'a(': error parsing regexp: missing closing ): `^a(`"},
+			{"VREF/COUNT", "VREF COUNT expects 'VREF/COUNT/n[/NEWFILES]', not 'VREF/COUNT'"},
+			{"VREF/COUNT/1/OLDFILES", "VREF COUNT expects 'VREF/COUNT/n[/NEWFILES]', not 'VREF/COUNT/1/OLDFILES'"},
+			{"VREF/COUNT/a", "invalid VREF COUNT limit 'a'"},
+			{"VREF/MAX_NEWBIN_SIZE", "VREF MAX_NEWBIN_SIZE expects 'VREF/MAX_NEWBIN_SIZE/n', not 'VREF/MAX_NEWBIN_SIZE'"},
+			{"VREF/MAX_NEWBIN_SIZE/-1", "invalid VREF MAX_NEWBIN_SIZE limit '-1'"},
+		} {
+			vref, err := ParseVREF(test.param)
+			So(vref, ShouldBeNil)
+			So(err.Error(), ShouldEqual, test.msg)
+		}
+		So(NewRule("-", "VREF/COUNT/a", nil).VREF(), ShouldBeNil)
+		So(NewRule("-", "master", nil).VREF(), ShouldBeNil)
+		So(NewRule("-", "VREF/COUNT/2", nil).VREF().Count(), ShouldEqual, 2)
+	})
+
+	Convey("COUNT and MAX_NEWBIN_SIZE VREFs are triggered by pushes", t, func() {
+		push := &Push{Files: []string{"a", "b", "c"}, NewFiles: []string{"c"}, BinSizes: map[string]int64{"c": 2000}}
+		vref, _ := ParseVREF("VREF/COUNT/2")
+		So(vref.Triggered(push), ShouldBeTrue)
+		vref, _ = ParseVREF("VREF/COUNT/3")
+		So(vref.Triggered(push), ShouldBeFalse)
+		vref, _ = ParseVREF("VREF/COUNT/1/NEWFILES")
+		So(vref.Triggered(push), ShouldBeFalse)
+		vref, _ = ParseVREF("VREF/COUNT/0/NEWFILES")
+		So(vref.Triggered(push), ShouldBeTrue)
+		vref, _ = ParseVREF("VREF/MAX_NEWBIN_SIZE/1000")
+		So(vref.Triggered(push), ShouldBeTrue)
+		vref, _ = ParseVREF("VREF/MAX_NEWBIN_SIZE/2000")
+		So(vref.Triggered(push), ShouldBeFalse)
+	})
+}
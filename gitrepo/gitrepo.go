@@ -0,0 +1,157 @@
+package gitrepo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Repo is a local git repository (bare or not), read through the git command
+type Repo struct {
+	path string
+}
+
+// Tree is the list of files of a given commit, whose content can be read
+// without any checkout
+type Tree struct {
+	repo   *Repo
+	commit string
+	files  []string
+}
+
+// Commit is a commit of a git repository log
+type Commit struct {
+	ID      string
+	Date    time.Time
+	Author  string
+	Subject string
+}
+
+// Open checks path is a git repository and returns it
+func Open(path string) (*Repo, error) {
+	repo := &Repo{path: path}
+	if _, err := repo.git("rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("'%v' is not a git repository: %v", path, err)
+	}
+	return repo, nil
+}
+
+// Path returns the path the repository has been opened with
+func (repo *Repo) Path() string {
+	return repo.path
+}
+
+func (repo *Repo) git(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", repo.path}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("git %v: %v", strings.Join(args, " "), msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Resolve returns the commit id a revision (branch, tag, sha1, ...) refers to
+func (repo *Repo) Resolve(rev string) (string, error) {
+	out, err := repo.git("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown revision '%v' in '%v'", rev, repo.path)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Log returns the commits reachable from rev through their first parent,
+// oldest first: a merge stands for the commits it merges, each commit
+// comes after its parent.
+// If paths are given, only the commits modifying those paths (compared to
+// their first parent) are returned.
+func (repo *Repo) Log(rev string, paths ...string) ([]*Commit, error) {
+	commit, err := repo.Resolve(rev)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"log", "--first-parent", "--reverse", "-z", "--format=%H%x01%ct%x01%an%x01%s", commit, "--"}, paths...)
+	out, err := repo.git(args...)
+	if err != nil {
+		return nil, err
+	}
+	res := []*Commit{}
+	for _, line := range strings.Split(string(out), "\x00") {
+		fields := strings.SplitN(strings.TrimSpace(line), "\x01", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		ts, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date '%v' for commit %v", fields[1], fields[0])
+		}
+		res = append(res, &Commit{ID: fields[0], Date: time.Unix(ts, 0).UTC(), Author: fields[2], Subject: fields[3]})
+	}
+	return res, nil
+}
+
+// Tree returns the files of the commit a revision refers to
+func (repo *Repo) Tree(rev string) (*Tree, error) {
+	commit, err := repo.Resolve(rev)
+	if err != nil {
+		return nil, err
+	}
+	out, err := repo.git("ls-tree", "-r", "-z", "--name-only", commit)
+	if err != nil {
+		return nil, err
+	}
+	tree := &Tree{repo: repo, commit: commit}
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			tree.files = append(tree.files, name)
+		}
+	}
+	sort.Strings(tree.files)
+	return tree, nil
+}
+
+// Commit returns the commit id of the tree
+func (tree *Tree) Commit() string {
+	return tree.commit
+}
+
+// Files returns the sorted paths ('/' separated) of all files under dir.
+// An empty dir means all the files of the tree.
+func (tree *Tree) Files(dir string) []string {
+	res := []string{}
+	dir = strings.Trim(dir, "/")
+	for _, name := range tree.files {
+		if dir == "" || strings.HasPrefix(name, dir+"/") {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// HasFile checks if name is a file of the tree
+func (tree *Tree) HasFile(name string) bool {
+	i := sort.SearchStrings(tree.files, name)
+	return i < len(tree.files) && tree.files[i] == name
+}
+
+// Open returns a reader on the content of the file name in the tree
+func (tree *Tree) Open(name string) (io.Reader, error) {
+	if !tree.HasFile(name) {
+		return nil, fmt.Errorf("open %v: no such file in commit %v", name, tree.commit)
+	}
+	out, err := tree.repo.git("cat-file", "blob", tree.commit+":"+name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
@@ -0,0 +1,141 @@
+package gitrepo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func run(dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@test"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		panic(string(out))
+	}
+}
+
+func write(dir, name, content string) {
+	name = filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		panic(err)
+	}
+}
+
+func TestGitRepo(t *testing.T) {
+
+	Convey("A git repository can be read without checkout", t, func() {
+		tmp, err := ioutil.TempDir("", "gitrepo")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		wk := filepath.Join(tmp, "wk")
+		run(tmp, "init", "-q", "-b", "master", wk)
+		write(wk, "conf/gitolite.conf", "repo gitolite-admin\n  RW+ = admin\n")
+		write(wk, "conf/subs/project.conf", "repo @project\n  RW = u1\n")
+		write(wk, "keydir/admin.pub", "ssh-rsa AAAA admin\n")
+		run(wk, "add", "-A")
+		run(wk, "commit", "-q", "-m", "first")
+		run(wk, "tag", "v1")
+		write(wk, "conf/gitolite.conf", "repo gitolite-admin\n  RW+ = admin2\n")
+		run(wk, "commit", "-q", "-a", "-m", "second")
+		bare := filepath.Join(tmp, "gitolite-admin.git")
+		run(tmp, "clone", "-q", "--bare", wk, bare)
+
+		Convey("Opening a non git directory fails", func() {
+			repo, err := Open(tmp)
+			So(repo, ShouldBeNil)
+			So(err.Error(), ShouldStartWith, "'"+tmp+"' is not a git repository")
+		})
+
+		Convey("Unknown revisions are reported", func() {
+			repo, err := Open(bare)
+			So(err, ShouldBeNil)
+			So(repo.Path(), ShouldEqual, bare)
+			tree, err := repo.Tree("unknown")
+			So(tree, ShouldBeNil)
+			So(err.Error(), ShouldEqual, "unknown revision 'unknown' in '"+bare+"'")
+		})
+
+		Convey("Files of a commit are listed and read", func() {
+			repo, err := Open(bare)
+			So(err, ShouldBeNil)
+			tree, err := repo.Tree("v1")
+			So(err, ShouldBeNil)
+			So(len(tree.Commit()), ShouldEqual, 40)
+			So(tree.Files(""), ShouldResemble, []string{"conf/gitolite.conf", "conf/subs/project.conf", "keydir/admin.pub"})
+			So(tree.Files("conf"), ShouldResemble, []string{"conf/gitolite.conf", "conf/subs/project.conf"})
+			So(tree.Files("conf/subs/"), ShouldResemble, []string{"conf/subs/project.conf"})
+			So(tree.Files("con"), ShouldResemble, []string{})
+			So(tree.HasFile("keydir/admin.pub"), ShouldBeTrue)
+			So(tree.HasFile("keydir"), ShouldBeFalse)
+
+			r, err := tree.Open("conf/gitolite.conf")
+			So(err, ShouldBeNil)
+			b, _ := ioutil.ReadAll(r)
+			So(string(b), ShouldEqual, "repo gitolite-admin\n  RW+ = admin\n")
+
+			tree, err = repo.Tree("HEAD")
+			So(err, ShouldBeNil)
+			r, err = tree.Open("conf/gitolite.conf")
+			So(err, ShouldBeNil)
+			b, _ = ioutil.ReadAll(r)
+			So(string(b), ShouldEqual, "repo gitolite-admin\n  RW+ = admin2\n")
+
+			r, err = tree.Open("conf/unknown.conf")
+			So(r, ShouldBeNil)
+			So(err.Error(), ShouldEqual, "open conf/unknown.conf: no such file in commit "+tree.Commit())
+		})
+
+		Convey("Commits are listed oldest first", func() {
+			repo, err := Open(bare)
+			So(err, ShouldBeNil)
+			commits, err := repo.Log("HEAD")
+			So(err, ShouldBeNil)
+			So(len(commits), ShouldEqual, 2)
+			So(commits[0].Subject, ShouldEqual, "first")
+			So(commits[0].Author, ShouldEqual, "test")
+			So(commits[1].Subject, ShouldEqual, "second")
+			So(commits[1].Date.Before(commits[0].Date), ShouldBeFalse)
+			tree, _ := repo.Tree("HEAD")
+			So(commits[1].ID, ShouldEqual, tree.Commit())
+
+			commits, err = repo.Log("HEAD", "keydir")
+			So(err, ShouldBeNil)
+			So(len(commits), ShouldEqual, 1)
+			So(commits[0].Subject, ShouldEqual, "first")
+
+			_, err = repo.Log("unknown")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Merged commits are listed as their merge", func() {
+			run(wk, "checkout", "-q", "-b", "feature")
+			write(wk, "conf/gitolite.conf", "repo gitolite-admin\n  RW+ = admin3\n")
+			run(wk, "commit", "-q", "-a", "-m", "feature")
+			run(wk, "checkout", "-q", "-")
+			write(wk, "keydir/admin.pub", "ssh-rsa BBBB admin\n")
+			run(wk, "commit", "-q", "-a", "-m", "third")
+			run(wk, "merge", "-q", "--no-ff", "-m", "merge", "feature")
+			repo, err := Open(wk)
+			So(err, ShouldBeNil)
+			subjects := func(commits []*Commit) []string {
+				res := []string{}
+				for _, commit := range commits {
+					res = append(res, commit.Subject)
+				}
+				return res
+			}
+			commits, err := repo.Log("HEAD")
+			So(err, ShouldBeNil)
+			So(subjects(commits), ShouldResemble, []string{"first", "second", "third", "merge"})
+			commits, err = repo.Log("HEAD", "conf")
+			So(err, ShouldBeNil)
+			So(subjects(commits), ShouldResemble, []string{"first", "second", "merge"})
+		})
+	})
+}
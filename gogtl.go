@@ -6,47 +6,96 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
-	"sort"
-	"strings"
 
 	"github.com/VonC/gogitolite/gitolite"
+	"github.com/VonC/gogitolite/gitrepo"
+	"github.com/VonC/gogitolite/loader"
 	"github.com/VonC/gogitolite/project"
 	"github.com/VonC/gogitolite/reader"
 )
 
-type rdr struct {
-	usersToReposOrGroup map[string][]gitolite.RepoOrGroup
-	gtl                 *gitolite.Gitolite
-	verbose             bool
-	subconfs            map[string]*gitolite.Gitolite
-	filename            string
+// command is a gogitolite subcommand, run with the arguments following its name
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(a []string) error
+}
+
+// exitError is an error ending a command with a specific exit code
+type exitError struct {
+	error
+	code int
+}
+
+// Exit codes of the commands
+const (
+	// exitFailure is the exit code of any other error (git repository, rc file, keydir, ...)
+	exitFailure = 1
+	// exitUsage is the exit code for invalid arguments
+	exitUsage = 2
+	// exitConf is the exit code when the main config can't be read
+	exitConf = 3
+	// exitSubconf is the exit code when a subconf, or some of its rules, are ignored (with -strict)
+	exitSubconf = 4
+	// exitLint is the exit code when a project declaration is ignored (with -strict)
+	exitLint = 5
+	// exitPolicy is the exit code when a policy is violated
+	exitPolicy = 6
+)
+
+// confFlags are the flags of the commands reading a config
+type confFlags struct {
+	verbose *bool
+	repo    *string
+	rev     *string
+	rc      *string
+	strict  *bool
 }
 
 var (
-	args        []string
-	r           *rdr
-	fauditPtr   = flag.Bool("audit", false, "print user access audit")
-	flistPtr    = flag.Bool("list", false, "list projects")
-	fverbosePtr = flag.Bool("v", false, "verbose, display filenames read")
-	fprintPtr   = flag.Bool("print", false, "print config")
+	commands []*command
 
+	sin  io.Reader
 	sout *bufio.Writer
 	serr *bufio.Writer
 )
 
 func init() {
-	flag.Usage = func() {
-		fmt.Fprintf(oerr(),
-			"Usage: gogitolite.exe [opts] gitolite.conf\n")
-		fmt.Fprintf(oerr(), "Options:\n")
-		flag.VisitAll(func(flag *flag.Flag) {
-			format := "  -%s=%s: %s\n"
-			if !strings.HasPrefix(flag.Name, "test.") && !strings.HasPrefix(flag.Name, "json") && !strings.HasPrefix(flag.Name, "story") && !strings.HasPrefix(flag.Name, "silent") {
-				fmt.Fprintf(oerr(), format, flag.Name, flag.DefValue, flag.Usage)
-			}
-		})
+	commands = []*command{
+		{"audit", "[opts] [conf/gitolite.conf]", "print user access audit", audit},
+		{"matrix", "[opts] [-format csv|xlsx] [-collapse repo|group|project] [-users u1,u2] [-repos r1,r2] [-o file] [conf/gitolite.conf]", "print the permission of each user on each repo", matrix},
+		{"graph", "[opts] [-format dot|graphml] [-o file] [conf/gitolite.conf]", "print users, groups, repos and projects, linked by memberships and rules, as a graph", graph},
+		{"privs", "[opts] [-refs master,release/] [conf/gitolite.conf]", "print who can rewind or delete protected refs", privs},
+		{"policy", "[opts] -policies file [conf/gitolite.conf]", "check the config and its subconfs against a policy file", policy},
+		{"list", "[opts] [conf/gitolite.conf]", "list projects", list},
+		{"print", "[opts] [conf/gitolite.conf]", "print config", printConf},
+		{"check", "[opts] [conf/gitolite.conf]", "check the config and its subconfs", check},
+		{"sync", "[opts] -from file [-format csv|ldif] -groups @g1,@g2 [-apply] [conf/gitolite.conf]", "synchronise groups with their members imported from a CSV or LDIF file", syncGroups},
+		{"keys", "[opts] [-keydir dir] [conf/gitolite.conf]", "check users against the public keys of keydir", keys},
+		{"authkeys", "[opts] [-keydir dir] [-glshell path] [conf/gitolite.conf]", "print the authorized_keys block generated from keydir", authkeys},
+		{"watch", "[-v] [-rc gitolite.rc] [-poll 2s] [conf/gitolite.conf]", "re-read the config on each change of its files or rc file, print lint findings and access changes", watch},
+		{"hook", "[-repo gitolite-admin.git] [-policies file] [conf/gitolite.conf] < pre-receive input", "check the configs pushed to a gitolite-admin repository (pre-receive hook)", func(a []string) error { return hook(a, in()) }},
+		{"history", "[-repo gitolite-admin.git] [-rev rev] [-user user] [-reponame repo] [conf/gitolite.conf]", "print access grants and revocations of each gitolite-admin commit", history},
+		{"serve", "[opts] [-addr :8080] [-poll 2s] [conf/gitolite.conf]", "serve access data as JSON over HTTP", serve},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(oerr(), "Usage: gogitolite.exe <command> [opts] [conf/gitolite.conf]\n")
+	fmt.Fprintf(oerr(), "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(oerr(), "  %-9s%s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(oerr(), "Run 'gogitolite.exe <command> -h' for the options of a command.\n")
+	fmt.Fprintf(oerr(), "Exit codes: 1 failure, 2 usage, 3 unreadable config, 4 ignored subconf, 5 ignored project (4 and 5: with -strict, or check), 6 policy violation\n")
+}
+
+func in() io.Reader {
+	if sin == nil {
+		return os.Stdin
 	}
+	return sin
 }
 
 func out() io.Writer {
@@ -64,186 +113,274 @@ func oerr() io.Writer {
 }
 
 func main() {
-	a := os.Args[1:]
-	if args != nil {
-		a = args
-		if len(a) == 1 && a[0] == "-h" {
-			flag.Usage()
-			return
-		}
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command named by the first argument, and returns the exit code:
+// 0 on success, or one of the exitXxx codes.
+func run(a []string) int {
+	if len(a) == 0 {
+		usage()
+		return exitUsage
 	}
-	flag.CommandLine.Parse(a)
-	filenames := flag.Args()
-	var filename string
-	var err error
-	if len(filenames) != 1 {
-		fmt.Fprintf(oerr(), "%s", "One gitolite.conf file expected")
-		goto eop
+	if a[0] == "-h" || a[0] == "help" {
+		usage()
+		return 0
 	}
-	filename = filenames[0]
-	r = &rdr{usersToReposOrGroup: make(map[string][]gitolite.RepoOrGroup),
-		verbose:  *fverbosePtr,
-		filename: filename,
-		subconfs: make(map[string]*gitolite.Gitolite),
+	for _, cmd := range commands {
+		if cmd.name == a[0] {
+			return exitCode(cmd.run(a[1:]))
+		}
 	}
-	if r.verbose {
-		fmt.Fprintf(out(), "Read file '%v'\n", filename)
+	fmt.Fprintf(oerr(), "Unknown command '%v'\n", a[0])
+	usage()
+	return exitUsage
+}
+
+func exitCode(err error) int {
+	if err == nil || err == flag.ErrHelp {
+		return 0
 	}
-	r.gtl, err = r.process(filename, nil)
-	if err == nil {
-		r.processSubconfs()
-		if *fauditPtr {
-			r.printAudit()
-			
-		}
-		if *flistPtr {
-			r.listProjects()
-		}
-		if *fprintPtr {
-			fmt.Fprintf(out(), "%v", r.gtl.Print())
+	if eerr, ok := err.(*exitError); ok {
+		return eerr.code
+	}
+	return exitFailure
+}
+
+// newFlagSet creates the flags of a command, printing its usage on error
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(oerr())
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(oerr(), "Usage: gogitolite.exe %v %v\n", name, cmd.args)
+			}
 		}
-		
-	} else {
-		    os.Exit(1)
+		fmt.Fprintf(oerr(), "Options:\n")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the arguments of a command, and returns the config file
+// they name (conf/gitolite.conf if none)
+func parse(fs *flag.FlagSet, a []string) (string, error) {
+	if err := fs.Parse(a); err != nil {
+		if err == flag.ErrHelp {
+			return "", err
 		}
-eop:
+		return "", &exitError{err, exitUsage}
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintf(oerr(), "%s\n", "One gitolite.conf file expected")
+		return "", &exitError{fmt.Errorf("%v files", fs.NArg()), exitUsage}
+	}
+	if fs.NArg() == 0 {
+		return "conf/gitolite.conf", nil
+	}
+	return fs.Arg(0), nil
 }
 
-func getGtlFromFile(filename string, gtl *gitolite.Gitolite) (*gitolite.Gitolite, error) {
-	f, err := os.Open(filename)
-	if err != nil {
-		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
-		return nil, err
+func addConfFlags(fs *flag.FlagSet) *confFlags {
+	return &confFlags{
+		verbose: fs.Bool("v", false, "verbose, display filenames read"),
+		repo:    fs.String("repo", "", "read gitolite-admin from a local git repository"),
+		rev:     fs.String("rev", "HEAD", "commit of the -repo git repository to read"),
+		rc:      fs.String("rc", "", "gitolite.rc file (UMASK, GIT_CONFIG_KEYS, ROLES, ...)"),
+		strict:  fs.Bool("strict", false, "fail if a subconf, or a project declaration, is ignored"),
 	}
-	defer f.Close()
-	fr := bufio.NewReader(f)
-	return getGtl2(fr, gtl)
 }
 
-func getGtl2(r io.Reader, gtl *gitolite.Gitolite) (*gitolite.Gitolite, error) {
-	var err error
-	if gtl == nil {
-		gtl, err = reader.Read(r)
-	} else {
-		gtl, err = reader.Update(r, gtl)
-		fmt.Printf("%v\n", err)
+// parseConf parses the arguments of a command reading a config, then reads it.
+// With -strict, anything ignored while reading it is an error.
+func parseConf(fs *flag.FlagSet, cf *confFlags, a []string) (*loader.Conf, error) {
+	filename, err := parse(fs, a)
+	if err != nil {
+		return nil, err
 	}
+	conf, err := cf.load(filename)
 	if err != nil {
-		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
 		return nil, err
 	}
-	return gtl, nil
+	if *cf.strict {
+		if err = checkError(conf, conf.Check()); err != nil {
+			fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+			return nil, err
+		}
+	}
+	return conf, nil
 }
 
-func addRogNoDup(rog gitolite.RepoOrGroup, rogs []gitolite.RepoOrGroup) []gitolite.RepoOrGroup {
-	res := rogs
-	seen := false
-	for _, arog := range rogs {
-		if arog.GetName() == rog.GetName() {
-			seen = true
-			break
-		}
+// checkError returns the error ending a command when errs (the result of
+// conf.Check) isn't empty: exitSubconf if a subconf, or some of its rules,
+// have been ignored, exitLint if only project declarations have been ignored.
+func checkError(conf *loader.Conf, errs []error) error {
+	if len(errs) == 0 {
+		return nil
 	}
-	if !seen {
-		res = append(rogs, rog)
+	code := exitLint
+	for _, err := range errs {
+		if _, ok := err.(*project.Diagnostic); !ok {
+			code = exitSubconf
+		}
 	}
-	return res
+	return &exitError{fmt.Errorf("%v error(s) in '%v'", len(errs), conf.Filename()), code}
 }
 
-func (rdr *rdr) updateUsersToRepos(uog gitolite.UserOrGroup, config *gitolite.Config) {
-	var rogs []gitolite.RepoOrGroup
-	var ok bool
-	if rogs, ok = rdr.usersToReposOrGroup[uog.GetName()]; !ok {
-		rogs = []gitolite.RepoOrGroup{}
+// load reads a config (from the -repo git repository if any) and its subconfs
+func (cf *confFlags) load(filename string) (*loader.Conf, error) {
+	var tree *gitrepo.Tree
+	var rc *gitolite.RC
+	var err error
+	if *cf.repo != "" {
+		if tree, err = getTree(*cf.repo, *cf.rev); err != nil {
+			return nil, err
+		}
 	}
-	for _, cfgrog := range config.GetReposOrGroups() {
-		rogs = addRogNoDup(cfgrog, rogs)
-		if cfgrog.Group() != nil {
-			cfggrp := cfgrog.Group()
-			repos := cfggrp.GetAllRepos()
-			for _, repo := range repos {
-				rogs = addRogNoDup(repo, rogs)
-			}
+	if *cf.rc != "" {
+		if rc, err = getRC(*cf.rc); err != nil {
+			return nil, err
 		}
 	}
-	rdr.usersToReposOrGroup[uog.GetName()] = rogs
+	if *cf.verbose && tree != nil {
+		fmt.Fprintf(out(), "Read commit '%v' of '%v'\n", tree.Commit(), *cf.repo)
+	}
+	ld := newLoader(tree, rc)
+	ld.SetVerbose(*cf.verbose)
+	conf, err := ld.Load(filename)
+	if err != nil {
+		return nil, &exitError{err, exitConf}
+	}
+	return conf, nil
 }
 
-func (rdr *rdr) process(filename string, parent *gitolite.Gitolite) (*gitolite.Gitolite, error) {
-	gtl, err := getGtlFromFile(filename, parent)
+// writeOutput writes the output of a command to a file, or to stdout if
+// filename is empty
+func writeOutput(filename string, write func(w io.Writer) error) error {
+	w := out()
+	if filename != "" {
+		f, err := os.Create(filename)
+		if err != nil {
+			fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	err := write(w)
 	if err != nil {
-		return nil, err
+		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
 	}
-	// fmt.Println(gtl.String())
-	for _, config := range gtl.Configs() {
-		for _, rule := range config.Rules() {
-			if strings.Contains(rule.Access(), "R") {
-				for _, uog := range rule.GetUsersFirstOrGroups() {
-					rdr.updateUsersToRepos(uog, config)
-				}
-			}
+	return err
+}
+
+// newLoader creates a loader displaying files read and errors on the command outputs
+func newLoader(tree *gitrepo.Tree, rc *gitolite.RC) *loader.Loader {
+	ld := loader.New(tree, rc)
+	ld.SetOutput(out(), oerr())
+	return ld
+}
+
+func getTree(repopath, rev string) (*gitrepo.Tree, error) {
+	repo, err := gitrepo.Open(repopath)
+	if err == nil {
+		var tree *gitrepo.Tree
+		if tree, err = repo.Tree(rev); err == nil {
+			return tree, nil
 		}
 	}
-	return gtl, nil
-}
-
-func (rdr *rdr) processSubconfs() {
-	root := filepath.Dir(rdr.filename)
-	//fmt.Println(root)
-	filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
-		if !f.IsDir() {
-			relname := strings.Replace(path, root+string(filepath.Separator), "", 1)
-			relname = strings.Replace(relname, string(filepath.Separator), "/", -1)
-			for _, subconfrx := range rdr.gtl.Subconfs() {
-				//fmt.Printf("%v %v\n", subconfrx.String(), relname)
-				if subconfrx.MatchString(relname) {
-					if rdr.verbose {
-						fmt.Fprintf(out(), "Visited: %s %s\n", relname, path)
-					}
-					subgtl, err := rdr.process(path, rdr.gtl)
-					if err != nil {
-						fmt.Fprintf(oerr(), "Ignore subconf file: %s %s because of err '%v'\n", relname, path, err)
-					} else {
-						rdr.subconfs[path] = subgtl
-					}
-				}
-			}
-		}
-		return nil
-	})
-}
-
-func (rdr *rdr) printAudit() {
-	names := make([]string, 0, len(rdr.usersToReposOrGroup))
-	for username := range rdr.usersToReposOrGroup {
-		names = append(names, username)
-	}
-	sort.Strings(names)
-	for _, username := range names {
-		repos := rdr.usersToReposOrGroup[username]
-		for _, repo := range repos {
-			typeuser := "user"
-			if strings.HasPrefix(username, "@") {
-				typeuser = "system"
-			} else if strings.HasPrefix(username, "proj") {
-				typeuser = "system"
-			} else if strings.HasPrefix(username, "HB") {
-				typeuser = "system"
-			} else if strings.Contains(username, "dmin") {
-				typeuser = "system"
-			}
-			if username != "" {
-				fmt.Fprintf(out(), "%v,,%v,%v\n", username, repo.GetName(), typeuser)
-			}
+	fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+	return nil, err
+}
+
+func getRC(filename string) (*gitolite.RC, error) {
+	f, err := os.Open(filename)
+	if err == nil {
+		defer f.Close()
+		var rc *gitolite.RC
+		if rc, err = reader.ReadRC(bufio.NewReader(f)); err == nil {
+			return rc, nil
 		}
 	}
+	fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+	return nil, err
+}
+
+// audit prints who has read access to what, as 'user,,repo,type' lines
+func audit(a []string) error {
+	fs := newFlagSet("audit")
+	cf := addConfFlags(fs)
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	printAudit(conf)
+	return nil
+}
 
+func printAudit(conf *loader.Conf) {
+	for _, access := range conf.Audit() {
+		fmt.Fprintf(out(), "%v,,%v,%v\n", access.User, access.Repo, access.Type)
+	}
 }
 
-func (rdr *rdr) listProjects() {
-	pm := project.NewManager(rdr.gtl, rdr.subconfs)
+// list prints the projects declared by the config and its subconfs
+func list(a []string) error {
+	fs := newFlagSet("list")
+	cf := addConfFlags(fs)
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	pm := conf.ProjectManager()
+	for _, d := range pm.Diagnostics() {
+		fmt.Fprintf(oerr(), "%v\n", diagnostic(d))
+	}
 	fmt.Fprintf(out(), "NbProjects: %v\n", pm.NbProjects())
 	for _, project := range pm.Projects() {
 		fmt.Fprintf(out(), "%v\n", project)
 	}
+	return nil
+}
+
+// printConf prints the config and its subconfs
+func printConf(a []string) error {
+	fs := newFlagSet("print")
+	cf := addConfFlags(fs)
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out(), "%v", conf.Gitolite().Print())
+	return nil
+}
+
+// check prints the inconsistencies of the config and its subconfs
+// (see loader.Conf.Check) on stderr, and fails if there is any, as with -strict.
+func check(a []string) error {
+	fs := newFlagSet("check")
+	cf := addConfFlags(fs)
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	errs := conf.Check()
+	for _, err := range errs {
+		fmt.Fprintf(oerr(), "%v\n", diagnostic(err))
+	}
+	return checkError(conf, errs)
+}
+
+// diagnostic renders an inconsistency returned by conf.Check, with the
+// reason code of ignored project declarations, or a policy violation
+// returned by conf.CheckPolicies, with the policy
+func diagnostic(err error) string {
+	if d, ok := err.(*project.Diagnostic); ok {
+		return fmt.Sprintf("%v [%v]", d.Error(), d.Code)
+	}
+	if v, ok := err.(*loader.Violation); ok {
+		return fmt.Sprintf("%v [%v]", v.Error(), v.Policy)
+	}
+	return err.Error()
 }
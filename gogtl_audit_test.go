@@ -5,8 +5,11 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -81,182 +84,162 @@ func flushStds() {
 	serr.Flush()
 }
 
-/*
-   subconf "subs/*.conf"
+// fp converts the '/' of a path to the OS separator, as printed when visiting subconfs
+func fp(path string) string {
+	return filepath.FromSlash(path)
+}
 
-   more subs/project.conf
+const p1audit = `@alm2,,gitolite-admin,system
+HBu1,,@project,system
+HBu1,,module1,system
+HBu1,,module2,system
+admin1,,gitolite-admin,system
+admin2,,gitolite-admin,system
+gitoliteadm,,gitolite-admin,user
+projectowner1,,gitolite-admin,system
+projectowner2,,gitolite-admin,system
+pu1,,@project,user
+pu1,,module1,user
+pu1,,module2,user
+user1,,module1,user
+user11,,module1,user
+user2,,module1,user
+user2,,module2,user
+user21,,module2,user
+user3,,@project,user
+user3,,module1,user
+user3,,module2,user
+`
+
+func p1err() string {
+	return `ERR Parse Error: group or repo expected after line 2 ('repo')
+Ignore subconf file: subs/projectbad.conf ` + fp("_tests/p1/conf/subs/projectbad.conf") + ` because of err 'Parse Error: group or repo expected after line 2 ('repo')'
+`
+}
 
-   repo @project
-     RW = projectowner @almadmins
-     RW = otheruser1 otheruser2...
-*/
 func TestProject(t *testing.T) {
-	Convey("Detects projects", t, func() {
+	Convey("Runs commands", t, func() {
 
 		Convey("Default usage", func() {
-			args = []string{"-h"}
-			main()
+			So(run([]string{"-h"}), ShouldEqual, 0)
 			flushStds()
-			So(r, ShouldBeNil)
 			So(bout.String(), ShouldEqual, "")
-			So(berr.String(), ShouldEqual, `Usage: gogitolite.exe [opts] gitolite.conf
-Options:
-  -audit=false: print user access audit
-  -list=false: list projects
-  -print=false: print config
-  -v=false: verbose, display filenames read
+			So(berr.String(), ShouldEqual, `Usage: gogitolite.exe <command> [opts] [conf/gitolite.conf]
+Commands:
+  audit    print user access audit
+  matrix   print the permission of each user on each repo
+  graph    print users, groups, repos and projects, linked by memberships and rules, as a graph
+  privs    print who can rewind or delete protected refs
+  policy   check the config and its subconfs against a policy file
+  list     list projects
+  print    print config
+  check    check the config and its subconfs
+  sync     synchronise groups with their members imported from a CSV or LDIF file
+  keys     check users against the public keys of keydir
+  authkeys print the authorized_keys block generated from keydir
+  watch    re-read the config on each change of its files or rc file, print lint findings and access changes
+  hook     check the configs pushed to a gitolite-admin repository (pre-receive hook)
+  history  print access grants and revocations of each gitolite-admin commit
+  serve    serve access data as JSON over HTTP
+Run 'gogitolite.exe <command> -h' for the options of a command.
+Exit codes: 1 failure, 2 usage, 3 unreadable config, 4 ignored subconf, 5 ignored project (4 and 5: with -strict, or check), 6 policy violation
 `)
 			resetStds()
 		})
-		Convey("Error if no file", func() {
-			args = []string{"-v", "-audit"}
-			main()
+		Convey("Usage error if no or unknown command", func() {
+			So(run(nil), ShouldEqual, 2)
+			flushStds()
+			So(berr.String(), ShouldStartWith, "Usage: gogitolite.exe <command>")
+			resetStds()
+			So(run([]string{"-audit"}), ShouldEqual, 2)
+			flushStds()
+			So(berr.String(), ShouldStartWith, "Unknown command '-audit'\nUsage: gogitolite.exe <command>")
+			resetStds()
+		})
+		Convey("Command usage", func() {
+			So(run([]string{"audit", "-h"}), ShouldEqual, 0)
+			flushStds()
+			So(berr.String(), ShouldStartWith, "Usage: gogitolite.exe audit [opts] [conf/gitolite.conf]\nOptions:\n")
+			So(berr.String(), ShouldContainSubstring, "gitolite.rc file (UMASK, GIT_CONFIG_KEYS, ROLES, ...)")
+			resetStds()
+			So(run([]string{"keys", "-unknown"}), ShouldEqual, 2)
+			flushStds()
+			So(berr.String(), ShouldStartWith, "flag provided but not defined: -unknown\nUsage: gogitolite.exe keys [opts] [-keydir dir] [conf/gitolite.conf]\n")
+			resetStds()
+		})
+		Convey("Usage error if several files", func() {
+			So(run([]string{"audit", "-v", "a.conf", "b.conf"}), ShouldEqual, 2)
 			flushStds()
-			So(r, ShouldBeNil)
 			So(bout.String(), ShouldEqual, "")
-			So(berr.String(), ShouldEqual, "One gitolite.conf file expected")
+			So(berr.String(), ShouldEqual, "One gitolite.conf file expected\n")
 			resetStds()
 		})
 		Convey("Error if unknown file", func() {
-
-			args = []string{"-audit", "unknownFile"}
-			main()
+			So(run([]string{"audit", "-v", "unknownFile"}), ShouldEqual, exitConf)
 			flushStds()
-			So(r.gtl, ShouldBeNil)
 			So(bout.String(), ShouldEqual, `Read file 'unknownFile'
 `)
-			So(berr.String(), ShouldEqual, `ERR open unknownFile: The system cannot find the file specified.
-`)
+			So(berr.String(), ShouldStartWith, `ERR open unknownFile: `)
 			resetStds()
 		})
-		Convey("Error if bad gitolite-admin config file content", func() {
 
-			r := strings.NewReader(gitoliteconfBad)
-			gtl, err := getGtl2(r, nil)
+		Convey("Audits one project with several admins and users", func() {
+			So(run([]string{"audit", "-v", "_tests/p1/conf/gitolite.conf"}), ShouldEqual, 0)
 			flushStds()
-			So(err, ShouldNotBeNil)
-			So(gtl, ShouldBeNil)
-			So(bout.String(), ShouldEqual, ``)
-			So(berr.String(), ShouldEqual, `ERR Parse Error: group or repo expected after line 1 ('test')
-`)
+			So(bout.String(), ShouldEqual, `Read file '_tests/p1/conf/gitolite.conf'
+Visited: subs/project.conf `+fp("_tests/p1/conf/subs/project.conf")+`
+Visited: subs/projectbad.conf `+fp("_tests/p1/conf/subs/projectbad.conf")+`
+`+p1audit)
+			So(berr.String(), ShouldEqual, p1err())
 			resetStds()
 		})
 
-		Convey("Detects one project with several admins and users", func() {
-
-			args = []string{"-v", "-audit", "_tests/p1/conf/gitolite.conf"}
-			main()
-			So(r, ShouldNotBeNil)
-			gtl, err := getGtlFromFile("_tests/p1/conf/gitolite.conf", r.gtl)
+		Convey("List one project with several admins and users", func() {
+			So(run([]string{"list", "_tests/p1/conf/gitolite.conf"}), ShouldEqual, 0)
 			flushStds()
-			So(err, ShouldBeNil)
-			So(gtl, ShouldNotBeNil)
-			So(bout.String(), ShouldEqual, `Read file '_tests/p1/conf/gitolite.conf'
-Visited: subs/project.conf _tests\p1\conf\subs\project.conf
-Visited: subs/projectbad.conf _tests\p1\conf\subs\projectbad.conf
-@alm2,,gitolite-admin,system
-HBu1,,@project,system
-HBu1,,module1,system
-HBu1,,module2,system
-admin1,,gitolite-admin,system
-admin2,,gitolite-admin,system
-gitoliteadm,,gitolite-admin,user
-projectowner1,,gitolite-admin,system
-projectowner2,,gitolite-admin,system
-pu1,,@project,user
-pu1,,module1,user
-pu1,,module2,user
-user1,,module1,user
-user11,,module1,user
-user2,,module1,user
-user2,,module2,user
-user21,,module2,user
-user3,,@project,user
-user3,,module1,user
-user3,,module2,user
+			So(bout.String(), ShouldEqual, `NbProjects: 1
+project project, admins: projectowner1, projectowner2, members: user1, user11, user2, pu1, user21
 `)
-			So(berr.String(), ShouldEqual, `ERR Parse Error: group or repo expected after line 2 ('repo')
-Ignore subconf file: subs/projectbad.conf _tests\p1\conf\subs\projectbad.conf because of err 'Parse Error: group or repo expected after line 2 ('repo')'
+			So(berr.String(), ShouldEqual, p1err())
+			resetStds()
+		})
+
+		Convey("Checks a config and its subconfs", func() {
+			So(run([]string{"check", "_tests/p1/conf/gitolite.conf"}), ShouldEqual, exitSubconf)
+			flushStds()
+			So(bout.String(), ShouldEqual, "")
+			So(berr.String(), ShouldEqual, p1err()+`subconf file 'subs/projectbad.conf': Parse Error: group or repo expected after line 2 ('repo')
 `)
 			resetStds()
 		})
 
-		Convey("List one project with several admins and users", func() {
+		Convey("Fails on ignored subconfs or projects in strict mode", func() {
+			So(run([]string{"audit", "-strict", "_tests/p1/conf/gitolite.conf"}), ShouldEqual, exitSubconf)
+			flushStds()
+			So(bout.String(), ShouldEqual, "")
+			So(berr.String(), ShouldEqual, p1err()+"ERR 1 error(s) in '_tests/p1/conf/gitolite.conf'\n")
+			resetStds()
 
-			args = []string{"-v", "-list", "_tests/p1/conf/gitolite.conf"}
-			main()
+			tmp, err := ioutil.TempDir("", "gogtl")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(tmp)
+			conffile := filepath.Join(tmp, "gitolite.conf")
+			ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+			So(run([]string{"list", conffile}), ShouldEqual, 0)
+			So(run([]string{"list", "-strict", conffile}), ShouldEqual, exitLint)
+			So(run([]string{"check", conffile}), ShouldEqual, exitLint)
 			flushStds()
-			So(r, ShouldNotBeNil)
-			So(bout.String(), ShouldEqual, `Read file '_tests/p1/conf/gitolite.conf'
-Visited: subs/project.conf _tests\p1\conf\subs\project.conf
-Visited: subs/projectbad.conf _tests\p1\conf\subs\projectbad.conf
-@alm2,,gitolite-admin,system
-HBu1,,@project,system
-HBu1,,module1,system
-HBu1,,module2,system
-admin1,,gitolite-admin,system
-admin2,,gitolite-admin,system
-gitoliteadm,,gitolite-admin,user
-projectowner1,,gitolite-admin,system
-projectowner2,,gitolite-admin,system
-pu1,,@project,user
-pu1,,module1,user
-pu1,,module2,user
-user1,,module1,user
-user11,,module1,user
-user2,,module1,user
-user2,,module2,user
-user21,,module2,user
-user3,,@project,user
-user3,,module1,user
-user3,,module2,user
-NbProjects: 1
-project project, admins: projectowner1, projectowner2, members: user1, user11, user2, pu1, user21
-`)
-			So(berr.String(), ShouldEqual, `ERR Parse Error: group or repo expected after line 2 ('repo')
-Ignore subconf file: subs/projectbad.conf _tests\p1\conf\subs\projectbad.conf because of err 'Parse Error: group or repo expected after line 2 ('repo')'
-`)
+			So(berr.String(), ShouldEqual, "Ignore project name 'project': no subconf found [NoSubconf]\n"+
+				"ERR 1 error(s) in '"+conffile+"'\nIgnore project name 'project': no subconf found [NoSubconf]\n")
 			resetStds()
 		})
 	})
 
 	Convey("Prints configs", t, func() {
 		Convey("Print a gitolite config", func() {
-
-			args = []string{"-print", "_tests/p1/conf/gitolite.conf"}
-			main()
-			So(r, ShouldNotBeNil)
-			gtl, err := getGtlFromFile("_tests/p1/conf/gitolite.conf", r.gtl)
+			So(run([]string{"print", "_tests/p1/conf/gitolite.conf"}), ShouldEqual, 0)
 			flushStds()
-			So(err, ShouldBeNil)
-			So(gtl, ShouldNotBeNil)
-			So(bout.String(), ShouldEqual, `Read file '_tests/p1/conf/gitolite.conf'
-Visited: subs/project.conf _tests\p1\conf\subs\project.conf
-Visited: subs/projectbad.conf _tests\p1\conf\subs\projectbad.conf
-@alm2,,gitolite-admin,system
-HBu1,,@project,system
-HBu1,,module1,system
-HBu1,,module2,system
-admin1,,gitolite-admin,system
-admin2,,gitolite-admin,system
-gitoliteadm,,gitolite-admin,user
-projectowner1,,gitolite-admin,system
-projectowner2,,gitolite-admin,system
-pu1,,@project,user
-pu1,,module1,user
-pu1,,module2,user
-user1,,module1,user
-user11,,module1,user
-user2,,module1,user
-user2,,module2,user
-user21,,module2,user
-user3,,@project,user
-user3,,module1,user
-user3,,module2,user
-NbProjects: 1
-project project, admins: projectowner1, projectowner2, members: user1, user11, user2, pu1, user21
-
-
+			So(bout.String(), ShouldEqual, `
 @project = module1 module2
 
 @almadmins = admin1 admin2
@@ -269,7 +252,6 @@ repo gitolite-admin
     -    VREF/NAME/                  = projectowner1 projectowner2
 
 
-
 @project = module1 module2
 
 
@@ -283,9 +265,120 @@ repo @project
     RW    = pu1
 
 `)
-			So(berr.String(), ShouldEqual, `ERR Parse Error: group or repo expected after line 2 ('repo')
-Ignore subconf file: subs/projectbad.conf _tests\p1\conf\subs\projectbad.conf because of err 'Parse Error: group or repo expected after line 2 ('repo')'
+			So(berr.String(), ShouldEqual, p1err())
+			resetStds()
+		})
+	})
+}
+
+func git(dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@test"}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		panic(string(out))
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestGitRepo(t *testing.T) {
+	Convey("Reads gitolite-admin from a git repository", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		wk := filepath.Join(tmp, "wk")
+		git(tmp, "init", "-q", "-b", "master", wk)
+		os.MkdirAll(filepath.Join(wk, "conf", "subs"), 0755)
+		ioutil.WriteFile(filepath.Join(wk, "conf", "gitolite.conf"), []byte(gitoliteconf), 0644)
+		ioutil.WriteFile(filepath.Join(wk, "conf", "subs", "project.conf"), []byte("repo @project\n  RW = user3\n"), 0644)
+		git(wk, "add", "-A")
+		git(wk, "commit", "-q", "-m", "conf")
+		bare := filepath.Join(tmp, "gitolite-admin.git")
+		git(tmp, "clone", "-q", "--bare", wk, bare)
+
+		Convey("Error if not a git repository", func() {
+			tree, err := getTree(tmp, "HEAD")
+			flushStds()
+			So(tree, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldStartWith, "ERR '"+tmp+"' is not a git repository")
+			resetStds()
+		})
+
+		Convey("Error if unknown revision", func() {
+			tree, err := getTree(bare, "unknown")
+			flushStds()
+			So(tree, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldEqual, "ERR unknown revision 'unknown' in '"+bare+"'\n")
+			resetStds()
+		})
+
+		Convey("Reads conf and subconfs from a commit", func() {
+			So(run([]string{"audit", "-v", "-repo", bare, "-rev", "master"}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, "Read commit '"+git(bare, "rev-parse", "master")+"' of '"+bare+`'
+Read file 'conf/gitolite.conf'
+Visited: subs/project.conf conf/subs/project.conf
+@alm2,,gitolite-admin,system
+admin1,,gitolite-admin,system
+admin2,,gitolite-admin,system
+gitoliteadm,,gitolite-admin,user
+projectowner1,,gitolite-admin,system
+projectowner2,,gitolite-admin,system
+pu1,,@project,user
+pu1,,module1,user
+pu1,,module2,user
+user1,,module1,user
+user11,,module1,user
+user2,,module1,user
+user2,,module2,user
+user21,,module2,user
+user3,,@project,user
+user3,,module1,user
+user3,,module2,user
 `)
+			So(berr.String(), ShouldEqual, "")
+			resetStds()
+
+			So(run([]string{"audit", "-repo", bare, "-rev", "unknown"}), ShouldEqual, 1)
+			resetStds()
+		})
+	})
+}
+
+func TestRC(t *testing.T) {
+	Convey("Reads a config with its gitolite.rc", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		rcfile := filepath.Join(tmp, "gitolite.rc")
+		conffile := filepath.Join(tmp, "gitolite.conf")
+		ioutil.WriteFile(rcfile, []byte("%RC = (\n  GIT_CONFIG_KEYS => 'hooks\\..*',\n  ROLES => { READERS => 1, },\n);\n"), 0644)
+		ioutil.WriteFile(conffile, []byte("repo gitolite-admin\n  RW+ = admin\nrepo foo\n  RW = READERS alice\n  config hooks.mailinglist = foo@example.com\n"), 0644)
+
+		Convey("Error if unknown rc file", func() {
+			rc, err := getRC(filepath.Join(tmp, "unknown.rc"))
+			flushStds()
+			So(rc, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldStartWith, "ERR open ")
+			resetStds()
+		})
+
+		Convey("Roles are audited as roles", func() {
+			So(run([]string{"audit", "-rc", rcfile, conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, "READERS,,foo,role\nadmin,,gitolite-admin,system\nalice,,foo,user\n")
+			resetStds()
+		})
+
+		Convey("Error if a config key isn't allowed by the rc", func() {
+			ioutil.WriteFile(rcfile, []byte("%RC = ( UMASK => 0077 );\n"), 0644)
+			So(run([]string{"audit", "-rc", rcfile, conffile}), ShouldEqual, exitConf)
+			flushStds()
+			So(berr.String(), ShouldEqual, "ERR Parse Error: git config 'hooks.mailinglist' not allowed, check GIT_CONFIG_KEYS in the rc file, line 5 ('config hooks.mailinglist = foo@example.com')\n")
+			resetStds()
+			So(run([]string{"audit", "-rc", filepath.Join(tmp, "unknown.rc"), conffile}), ShouldEqual, 1)
 			resetStds()
 		})
 	})
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/VonC/gogitolite/loader"
+)
+
+// graph prints the model of the config as a Graphviz DOT or GraphML graph
+func graph(a []string) error {
+	fs := newFlagSet("graph")
+	cf := addConfFlags(fs)
+	format := fs.String("format", "dot", "output format: dot or graphml")
+	output := fs.String("o", "", "output file (default: stdout)")
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	if *format != "dot" && *format != "graphml" {
+		fmt.Fprintf(oerr(), "Unknown format '%v' (dot or graphml expected)\n", *format)
+		return &exitError{fmt.Errorf("format '%v'", *format), exitUsage}
+	}
+	g := conf.Graph()
+	return writeOutput(*output, func(w io.Writer) error {
+		if *format == "graphml" {
+			return writeGraphML(w, g)
+		}
+		return writeDOT(w, g)
+	})
+}
+
+var dotShapes = map[string]string{
+	loader.UserNode:      "ellipse",
+	loader.UserGroupNode: "box",
+	loader.RepoNode:      "note",
+	loader.RepoGroupNode: "folder",
+	loader.ProjectNode:   "tab",
+}
+
+// dotQuote quotes a DOT identifier
+func dotQuote(s string) string {
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+// writeDOT writes a graph in the Graphviz DOT language: memberships are
+// dashed edges, rules are edges labelled with their permission and refex.
+func writeDOT(w io.Writer, g *loader.Graph) error {
+	if _, err := fmt.Fprintf(w, "digraph gitolite {\n"); err != nil {
+		return err
+	}
+	for _, node := range g.Nodes {
+		if _, err := fmt.Fprintf(w, "  %v [label=%v, shape=%v];\n", dotQuote(node.ID), dotQuote(node.Name), dotShapes[node.Kind]); err != nil {
+			return err
+		}
+	}
+	for _, edge := range g.Edges {
+		attrs := "style=dashed"
+		switch edge.Kind {
+		case loader.AdminEdge:
+			attrs = "style=dashed, label=admin"
+		case loader.RuleEdge:
+			attrs = "label=" + dotQuote(strings.TrimSpace(edge.Perm+" "+edge.Refex))
+		}
+		if _, err := fmt.Fprintf(w, "  %v -> %v [%v];\n", dotQuote(edge.From), dotQuote(edge.To), attrs); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "}\n")
+	return err
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeGraphML writes a graph in GraphML, with the kind and name of nodes,
+// and the kind, permission and refex of edges as data.
+func writeGraphML(w io.Writer, g *loader.Graph) error {
+	doc := &graphML{XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{"kind", "node", "kind", "string"},
+			{"name", "node", "name", "string"},
+			{"type", "edge", "type", "string"},
+			{"perm", "edge", "perm", "string"},
+			{"refex", "edge", "refex", "string"},
+		},
+		Graph: graphMLGraph{ID: "gitolite", EdgeDefault: "directed"},
+	}
+	for _, node := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node.ID, Data: []graphMLData{{"kind", node.Kind}, {"name", node.Name}}})
+	}
+	for _, edge := range g.Edges {
+		data := []graphMLData{{"type", edge.Kind}}
+		if edge.Kind == loader.RuleEdge {
+			data = append(data, graphMLData{"perm", edge.Perm}, graphMLData{"refex", edge.Refex})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: edge.From, Target: edge.To, Data: data})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGraph(t *testing.T) {
+	Convey("Prints the config as a graph", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte("@devs = alice bob\n@apps = foo\nrepo gitolite-admin\n  RW+ = admin\nrepo @apps\n  RW+ dev/ = @devs\n"), 0644)
+
+		Convey("As DOT", func() {
+			So(run([]string{"graph", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, `digraph gitolite {
+  "user:admin" [label="admin", shape=ellipse];
+  "user:alice" [label="alice", shape=ellipse];
+  "user:bob" [label="bob", shape=ellipse];
+  "repo:gitolite-admin" [label="gitolite-admin", shape=note];
+  "repo:foo" [label="foo", shape=note];
+  "usergroup:@devs" [label="@devs", shape=box];
+  "repogroup:@apps" [label="@apps", shape=folder];
+  "user:alice" -> "usergroup:@devs" [style=dashed];
+  "user:bob" -> "usergroup:@devs" [style=dashed];
+  "repo:foo" -> "repogroup:@apps" [style=dashed];
+  "user:admin" -> "repo:gitolite-admin" [label="RW+"];
+  "usergroup:@devs" -> "repogroup:@apps" [label="RW+ dev/"];
+}
+`)
+			resetStds()
+		})
+
+		Convey("As GraphML", func() {
+			out := filepath.Join(tmp, "graph.graphml")
+			So(run([]string{"graph", "-format", "graphml", "-o", out, conffile}), ShouldEqual, 0)
+			b, err := ioutil.ReadFile(out)
+			So(err, ShouldBeNil)
+			var doc graphML
+			So(xml.Unmarshal(b, &doc), ShouldBeNil)
+			So(len(doc.Keys), ShouldEqual, 5)
+			So(len(doc.Graph.Nodes), ShouldEqual, 7)
+			So(doc.Graph.Nodes[5].ID, ShouldEqual, "usergroup:@devs")
+			So(doc.Graph.Nodes[5].Data, ShouldResemble, []graphMLData{{"kind", "usergroup"}, {"name", "@devs"}})
+			So(len(doc.Graph.Edges), ShouldEqual, 5)
+			So(doc.Graph.Edges[4], ShouldResemble, graphMLEdge{Source: "usergroup:@devs", Target: "repogroup:@apps",
+				Data: []graphMLData{{"type", "rule"}, {"perm", "RW+"}, {"refex", "dev/"}}})
+			resetStds()
+		})
+
+		Convey("Usage error if unknown format", func() {
+			So(run([]string{"graph", "-format", "svg", conffile}), ShouldEqual, 2)
+			flushStds()
+			So(berr.String(), ShouldEqual, "Unknown format 'svg' (dot or graphml expected)\n")
+			resetStds()
+		})
+	})
+
+	Convey("Quotes DOT identifiers", t, func() {
+		So(dotQuote(`a"b\c`), ShouldEqual, `"a\"b\\c"`)
+	})
+}
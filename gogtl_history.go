@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/VonC/gogitolite/gitrepo"
+)
+
+// accessChange is a grant (or revocation) of access to a repo for a user
+type accessChange struct {
+	granted  bool
+	username string
+	reponame string
+}
+
+func (ac *accessChange) String() string {
+	sign := "-"
+	if ac.granted {
+		sign = "+"
+	}
+	return fmt.Sprintf("%v %v %v", sign, ac.username, ac.reponame)
+}
+
+// diffAccesses lists grants and revocations between two access sets,
+// sorted by user and repo.
+func diffAccesses(prev, cur map[string]map[string]bool) []*accessChange {
+	res := []*accessChange{}
+	for username, reponames := range cur {
+		for reponame := range reponames {
+			if !prev[username][reponame] {
+				res = append(res, &accessChange{granted: true, username: username, reponame: reponame})
+			}
+		}
+	}
+	for username, reponames := range prev {
+		for reponame := range reponames {
+			if !cur[username][reponame] {
+				res = append(res, &accessChange{granted: false, username: username, reponame: reponame})
+			}
+		}
+	}
+	sort.Sort(byUserAndRepo(res))
+	return res
+}
+
+type byUserAndRepo []*accessChange
+
+func (acs byUserAndRepo) Len() int      { return len(acs) }
+func (acs byUserAndRepo) Swap(i, j int) { acs[i], acs[j] = acs[j], acs[i] }
+func (acs byUserAndRepo) Less(i, j int) bool {
+	if acs[i].username != acs[j].username {
+		return acs[i].username < acs[j].username
+	}
+	if acs[i].reponame != acs[j].reponame {
+		return acs[i].reponame < acs[j].reponame
+	}
+	return !acs[i].granted && acs[j].granted
+}
+
+// history prints, for each commit modifying the conf directory of a
+// gitolite-admin repository, the access grants and revocations it introduced,
+// optionally filtered for one user and/or one repo.
+func history(a []string) error {
+	fs := newFlagSet("history")
+	repopath := fs.String("repo", ".", "gitolite-admin git repository")
+	rev := fs.String("rev", "HEAD", "last commit of the history")
+	username := fs.String("user", "", "only display accesses of this user")
+	reponame := fs.String("reponame", "", "only display accesses to this repo")
+	filename, err := parse(fs, a)
+	if err != nil {
+		return err
+	}
+	repo, err := gitrepo.Open(*repopath)
+	var commits []*gitrepo.Commit
+	if err == nil {
+		commits, err = repo.Log(*rev, path.Dir(filename))
+	}
+	if err != nil {
+		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+		return err
+	}
+	prev := make(map[string]map[string]bool)
+	for _, commit := range commits {
+		tree, err := repo.Tree(commit.ID)
+		if err != nil {
+			fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+			return err
+		}
+		conf, err := newLoader(tree, nil).Load(filename)
+		if err != nil {
+			fmt.Fprintf(oerr(), "Ignore commit %v: unreadable config\n", commit.ID)
+			continue
+		}
+		cur := conf.Accesses()
+		for _, ac := range diffAccesses(prev, cur) {
+			if (*username == "" || ac.username == *username) && (*reponame == "" || ac.reponame == *reponame) {
+				fmt.Fprintf(out(), "%v %v %v\n", commit.Date.Format("2006-01-02 15:04:05"), commit.ID[:7], ac)
+			}
+		}
+		prev = cur
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func commitAt(wk, date, msg string) {
+	os.Setenv("GIT_COMMITTER_DATE", date)
+	defer os.Unsetenv("GIT_COMMITTER_DATE")
+	git(wk, "add", "-A")
+	git(wk, "commit", "-q", "-m", msg)
+}
+
+func TestHistory(t *testing.T) {
+	Convey("Displays access history", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		wk := filepath.Join(tmp, "wk")
+		git(tmp, "init", "-q", "-b", "master", wk)
+		conf := filepath.Join(wk, "conf", "gitolite.conf")
+		os.MkdirAll(filepath.Dir(conf), 0755)
+		ioutil.WriteFile(conf, []byte(`
+repo gitolite-admin
+  RW+ = admin
+repo repo1
+  RW = user1 user2
+`), 0644)
+		commitAt(wk, "2015-03-01T10:00:00Z", "init")
+		ioutil.WriteFile(conf, []byte(`
+repo gitolite-admin
+  RW+ = admin
+repo repo1
+  RW = user1
+repo repo2
+  R = user2
+`), 0644)
+		commitAt(wk, "2015-03-15T10:00:00Z", "move user2")
+		ioutil.WriteFile(filepath.Join(wk, "README"), []byte("readme"), 0644)
+		commitAt(wk, "2015-03-20T10:00:00Z", "not a conf change")
+		ioutil.WriteFile(conf, []byte(`repo`), 0644)
+		commitAt(wk, "2015-04-01T10:00:00Z", "broken conf")
+		broken := git(wk, "rev-parse", "HEAD")
+		ioutil.WriteFile(conf, []byte(`
+repo gitolite-admin
+  RW+ = admin
+repo repo2
+  R = user2
+`), 0644)
+		commitAt(wk, "2015-04-02T10:00:00Z", "remove repo1")
+		c1 := git(wk, "rev-parse", "--short=7", "HEAD~4")
+		c2 := git(wk, "rev-parse", "--short=7", "HEAD~3")
+		c5 := git(wk, "rev-parse", "--short=7", "HEAD")
+
+		Convey("Error if not a git repository", func() {
+			err := history([]string{"-repo", tmp})
+			flushStds()
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldStartWith, "ERR '"+tmp+"' is not a git repository")
+			resetStds()
+		})
+
+		Convey("Lists all grants and revocations", func() {
+			err := history([]string{"-repo", wk})
+			flushStds()
+			So(err, ShouldBeNil)
+			So(bout.String(), ShouldEqual, `2015-03-01 10:00:00 `+c1+` + admin gitolite-admin
+2015-03-01 10:00:00 `+c1+` + user1 repo1
+2015-03-01 10:00:00 `+c1+` + user2 repo1
+2015-03-15 10:00:00 `+c2+` - user2 repo1
+2015-03-15 10:00:00 `+c2+` + user2 repo2
+2015-04-02 10:00:00 `+c5+` - user1 repo1
+`)
+			So(berr.String(), ShouldEqual, `ERR Parse Error: group or repo expected after line 1 ('repo')
+Ignore commit `+broken+`: unreadable config
+`)
+			resetStds()
+		})
+
+		Convey("Lists grants and revocations for a user or a repo", func() {
+			err := history([]string{"-repo", wk, "-user", "user2"})
+			flushStds()
+			So(err, ShouldBeNil)
+			So(bout.String(), ShouldEqual, `2015-03-01 10:00:00 `+c1+` + user2 repo1
+2015-03-15 10:00:00 `+c2+` - user2 repo1
+2015-03-15 10:00:00 `+c2+` + user2 repo2
+`)
+			resetStds()
+			err = history([]string{"-repo", wk, "-reponame", "repo1", "-rev", "HEAD~1"})
+			flushStds()
+			So(err, ShouldBeNil)
+			So(bout.String(), ShouldEqual, `2015-03-01 10:00:00 `+c1+` + user1 repo1
+2015-03-01 10:00:00 `+c1+` + user2 repo1
+2015-03-15 10:00:00 `+c2+` - user2 repo1
+`)
+			resetStds()
+		})
+	})
+}
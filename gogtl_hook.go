@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/VonC/gogitolite/gitrepo"
+	"github.com/VonC/gogitolite/loader"
+)
+
+// hook runs as a git pre-receive hook of a gitolite-admin repository:
+// it reads '<old-sha> <new-sha> <ref>' lines, and checks the conf
+// (and its subconfs) of each pushed commit, against the -policies file
+// if any (read from the server, not from the pushed commits).
+// It returns an error (meaning the push must be rejected) if any check fails.
+func hook(a []string, stdin io.Reader) error {
+	fs := newFlagSet("hook")
+	repopath := fs.String("repo", ".", "gitolite-admin git repository receiving the push")
+	policyfile := fs.String("policies", "", "policy file the pushed configs must follow")
+	filename, err := parse(fs, a)
+	if err != nil {
+		return err
+	}
+	var policies []*loader.Policy
+	if *policyfile != "" {
+		if policies, err = getPolicies(*policyfile); err != nil {
+			return err
+		}
+	}
+	repo, err := gitrepo.Open(*repopath)
+	if err != nil {
+		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+		return err
+	}
+	nbrejected := 0
+	s := bufio.NewScanner(stdin)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			err = fmt.Errorf("invalid pre-receive line '%v'", s.Text())
+			fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+			return err
+		}
+		newrev, ref := fields[1], fields[2]
+		if strings.Trim(newrev, "0") == "" {
+			// ref deletion: nothing to check
+			continue
+		}
+		if errs := checkCommit(repo, newrev, filename, policies); len(errs) > 0 {
+			fmt.Fprintf(oerr(), "Rejected '%v' (%v): %v error(s) in gitolite-admin config\n", ref, newrev, len(errs))
+			nbrejected = nbrejected + 1
+		}
+	}
+	if nbrejected > 0 {
+		return fmt.Errorf("%v ref(s) rejected", nbrejected)
+	}
+	return nil
+}
+
+// checkCommit reads the conf and subconfs of a commit, and returns read
+// errors, inconsistencies and policy violations.
+// Read errors are already displayed on stderr when detected,
+// inconsistencies and violations are displayed here.
+func checkCommit(repo *gitrepo.Repo, rev, filename string, policies []*loader.Policy) []error {
+	tree, err := repo.Tree(rev)
+	if err != nil {
+		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+		return []error{err}
+	}
+	conf, err := newLoader(tree, nil).Load(filename)
+	if err != nil {
+		return []error{err}
+	}
+	errs := append(conf.Check(), conf.CheckPolicies(policies)...)
+	for _, err := range errs {
+		fmt.Fprintf(oerr(), "%v\n", diagnostic(err))
+	}
+	return errs
+}
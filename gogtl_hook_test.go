@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const zeros = "0000000000000000000000000000000000000000"
+
+func TestHook(t *testing.T) {
+	Convey("Validates pushes to gitolite-admin", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		wk := filepath.Join(tmp, "wk")
+		git(tmp, "init", "-q", "-b", "master", wk)
+		os.MkdirAll(filepath.Join(wk, "conf", "subs"), 0755)
+		ioutil.WriteFile(filepath.Join(wk, "conf", "gitolite.conf"), []byte(gitoliteconf), 0644)
+		ioutil.WriteFile(filepath.Join(wk, "conf", "subs", "project.conf"), []byte("repo @project\n  RW = user3\n"), 0644)
+		git(wk, "add", "-A")
+		git(wk, "commit", "-q", "-m", "good")
+		good := git(wk, "rev-parse", "HEAD")
+
+		ioutil.WriteFile(filepath.Join(wk, "conf", "subs", "projectbad.conf"), []byte("repo\n  RW = user3bad\n"), 0644)
+		git(wk, "add", "-A")
+		git(wk, "commit", "-q", "-m", "bad subconf")
+		badsub := git(wk, "rev-parse", "HEAD")
+
+		ioutil.WriteFile(filepath.Join(wk, "conf", "gitolite.conf"), []byte(strings.Replace(gitoliteconf, "RW+     =   gitoliteadm", "RW =   gitoliteadm", 1)), 0644)
+		git(wk, "commit", "-q", "-a", "-m", "bad conf")
+		badconf := git(wk, "rev-parse", "HEAD")
+
+		git(wk, "rm", "-q", "-r", "conf")
+		git(wk, "commit", "-q", "-m", "no conf")
+		noconf := git(wk, "rev-parse", "HEAD")
+
+		Convey("A valid push is accepted", func() {
+			err := hook([]string{"-repo", wk}, strings.NewReader(zeros+" "+good+" refs/heads/master\n"))
+			flushStds()
+			So(err, ShouldBeNil)
+			So(berr.String(), ShouldEqual, "")
+			resetStds()
+		})
+
+		Convey("A ref deletion is accepted", func() {
+			err := hook([]string{"-repo", wk}, strings.NewReader(good+" "+zeros+" refs/heads/old\n"))
+			flushStds()
+			So(err, ShouldBeNil)
+			resetStds()
+		})
+
+		Convey("Invalid hook input is rejected", func() {
+			err := hook([]string{"-repo", wk}, strings.NewReader("refs/heads/master\n"))
+			flushStds()
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldEqual, "ERR invalid pre-receive line 'refs/heads/master'\n")
+			resetStds()
+		})
+
+		Convey("A push with an invalid subconf is rejected", func() {
+			err := hook([]string{"-repo", wk}, strings.NewReader(zeros+" "+good+" refs/heads/master\n"+good+" "+badsub+" refs/heads/dev\n"))
+			flushStds()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "1 ref(s) rejected")
+			So(berr.String(), ShouldEqual, `ERR Parse Error: group or repo expected after line 1 ('repo')
+Ignore subconf file: subs/projectbad.conf conf/subs/projectbad.conf because of err 'Parse Error: group or repo expected after line 1 ('repo')'
+subconf file 'subs/projectbad.conf': Parse Error: group or repo expected after line 1 ('repo')
+Rejected 'refs/heads/dev' (`+badsub+`): 1 error(s) in gitolite-admin config
+`)
+			resetStds()
+		})
+
+		Convey("A push with an invalid conf is rejected", func() {
+			err := hook([]string{"-repo", wk}, strings.NewReader(badsub+" "+badconf+" refs/heads/master\n"))
+			flushStds()
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldEqual, `ERR First rule for gitolite-admin repo config must be 'RW+', empty param, instead of 'RW'-''
+Rejected 'refs/heads/master' (`+badconf+`): 1 error(s) in gitolite-admin config
+`)
+			resetStds()
+		})
+
+		Convey("A push with an ignored project is rejected, with the reason", func() {
+			os.MkdirAll(filepath.Join(wk, "conf"), 0755)
+			ioutil.WriteFile(filepath.Join(wk, "conf", "gitolite.conf"), []byte(gitoliteconf), 0644)
+			git(wk, "add", "-A")
+			git(wk, "commit", "-q", "-m", "no subconf")
+			nosub := git(wk, "rev-parse", "HEAD")
+			err := hook([]string{"-repo", wk}, strings.NewReader(noconf+" "+nosub+" refs/heads/master\n"))
+			flushStds()
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldEqual, `Ignore project name 'project': no subconf found [NoSubconf]
+Rejected 'refs/heads/master' (`+nosub+`): 1 error(s) in gitolite-admin config
+`)
+			resetStds()
+		})
+
+		Convey("A push violating a policy is rejected", func() {
+			policies := filepath.Join(tmp, "policies")
+			ioutil.WriteFile(policies, []byte("deny user3 RW\n"), 0644)
+			err := hook([]string{"-repo", wk, "-policies", policies}, strings.NewReader(zeros+" "+good+" refs/heads/master\n"))
+			flushStds()
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldEqual, `'user3' has 'RW' on repo 'module1' (rule 'RW') [deny user3 RW]
+'user3' has 'RW' on repo 'module2' (rule 'RW') [deny user3 RW]
+Rejected 'refs/heads/master' (`+good+`): 2 error(s) in gitolite-admin config
+`)
+			resetStds()
+		})
+
+		Convey("A push without conf is rejected", func() {
+			err := hook([]string{"-repo", wk}, strings.NewReader(badconf+" "+noconf+" refs/heads/master\n"))
+			flushStds()
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldEqual, `ERR open conf/gitolite.conf: no such file in commit `+noconf+`
+Rejected 'refs/heads/master' (`+noconf+`): 1 error(s) in gitolite-admin config
+`)
+			resetStds()
+		})
+	})
+}
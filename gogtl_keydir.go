@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VonC/gogitolite/loader"
+)
+
+// keys checks the users of the config against the public keys of keydir
+func keys(a []string) error {
+	fs := newFlagSet("keys")
+	cf := addConfFlags(fs)
+	dir := fs.String("keydir", "", "keydir directory (default: keydir next to the conf directory)")
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	return printKeys(conf, *dir)
+}
+
+// authkeys prints the authorized_keys block generated from keydir
+func authkeys(a []string) error {
+	fs := newFlagSet("authkeys")
+	cf := addConfFlags(fs)
+	dir := fs.String("keydir", "", "keydir directory (default: keydir next to the conf directory)")
+	glshell := fs.String("glshell", "gitolite-shell", "gitolite-shell path used in authorized_keys commands")
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	return printAuthorizedKeys(conf, *dir, *glshell)
+}
+
+func printKeys(conf *loader.Conf, dir string) error {
+	kd, err := conf.Keydir(dir)
+	if err != nil {
+		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+		return err
+	}
+	rpt := kd.Check(conf.Users())
+	for _, username := range rpt.UsersWithoutKey {
+		fmt.Fprintf(out(), "User without key: %v\n", username)
+	}
+	for _, key := range rpt.KeysWithoutUser {
+		fmt.Fprintf(out(), "Key without rule: %v (%v)\n", key.Filename(), key.User())
+	}
+	for _, keys := range rpt.Duplicates {
+		files := []string{}
+		for _, key := range keys {
+			files = append(files, fmt.Sprintf("%v (%v)", key.Filename(), key.User()))
+		}
+		fmt.Fprintf(out(), "Duplicate key %v: %v\n", keys[0].Fingerprint(), strings.Join(files, ", "))
+	}
+	return nil
+}
+
+func printAuthorizedKeys(conf *loader.Conf, dir, glshell string) error {
+	kd, err := conf.Keydir(dir)
+	if err != nil {
+		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+		return err
+	}
+	fmt.Fprintf(out(), "%v", kd.AuthorizedKeys(glshell))
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeydir(t *testing.T) {
+	Convey("Checks users against keydir", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		os.MkdirAll(filepath.Join(tmp, "keydir", "old"), 0755)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "gitolite.conf"), []byte(gitoliteconf), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "project.conf"), []byte("repo @project\n  RW = user3\n"), 0644)
+		for _, user := range []string{"gitoliteadm", "admin1", "admin2", "projectowner1", "projectowner2", "user1", "user11", "user2", "pu1", "user3"} {
+			ioutil.WriteFile(filepath.Join(tmp, "keydir", user+"@host.pub"), []byte("ssh-rsa "+base64.StdEncoding.EncodeToString([]byte(user))+" "+user), 0644)
+		}
+		ioutil.WriteFile(filepath.Join(tmp, "keydir", "old", "user1.pub"), []byte("ssh-rsa "+base64.StdEncoding.EncodeToString([]byte("user1"))+" old"), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "keydir", "old", "olduser.pub"), []byte("ssh-rsa "+base64.StdEncoding.EncodeToString([]byte("olduser"))+" olduser"), 0644)
+
+		Convey("Reports users without keys, keys without rules and duplicate keys", func() {
+			So(run([]string{"keys", filepath.Join(tmp, "conf", "gitolite.conf")}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, `User without key: user21
+Key without rule: old/olduser.pub (olduser)
+Duplicate key SHA256:CgQblGLKpKMbrDVn4Lbm/ZEAeH2yq0M9lvbReMq/zpA: old/user1.pub (user1), user1@host.pub (user1)
+`)
+			resetStds()
+		})
+
+		Convey("Reads keydir from a git repository", func() {
+			git(tmp, "init", "-q", "-b", "master")
+			git(tmp, "add", "-A")
+			git(tmp, "commit", "-q", "-m", "conf")
+			So(run([]string{"keys", "-repo", tmp}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldStartWith, `User without key: user21
+Key without rule: old/olduser.pub (olduser)
+`)
+			resetStds()
+
+			So(run([]string{"keys", "-repo", tmp, "-keydir", "keydir/old"}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldStartWith, `User without key: admin1
+`)
+			resetStds()
+		})
+
+		Convey("Generates authorized_keys from keydir", func() {
+			conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+			So(run([]string{"authkeys", "-keydir", filepath.Join(tmp, "keydir", "old"), "-glshell", "/usr/share/gitolite3/gitolite-shell", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, `# gitolite start
+command="/usr/share/gitolite3/gitolite-shell olduser",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa b2xkdXNlcg== olduser
+command="/usr/share/gitolite3/gitolite-shell user1",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa dXNlcjE= old
+# gitolite end
+`)
+			resetStds()
+
+			So(run([]string{"authkeys", "-keydir", filepath.Join(tmp, "unknown"), conffile}), ShouldEqual, 1)
+			flushStds()
+			So(berr.String(), ShouldStartWith, "ERR ")
+			resetStds()
+		})
+
+		Convey("Error if keydir cannot be read", func() {
+			So(run([]string{"keys", "-keydir", filepath.Join(tmp, "unknown"), filepath.Join(tmp, "conf", "gitolite.conf")}), ShouldEqual, 1)
+			flushStds()
+			So(berr.String(), ShouldStartWith, "ERR ")
+			resetStds()
+		})
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/VonC/gogitolite/loader"
+)
+
+var collapses = map[string]loader.Collapse{"repo": loader.ByRepo, "group": loader.ByRepoGroup, "project": loader.ByProject}
+
+// matrix prints the permission of each user on each repo, as CSV or XLSX
+func matrix(a []string) error {
+	fs := newFlagSet("matrix")
+	cf := addConfFlags(fs)
+	format := fs.String("format", "csv", "output format: csv or xlsx")
+	collapse := fs.String("collapse", "repo", "a column per repo, per repo group (group) or per project (project)")
+	users := fs.String("users", "", "comma-separated users of the matrix (default: all)")
+	repos := fs.String("repos", "", "comma-separated repos, repo groups or projects of the matrix (default: all)")
+	output := fs.String("o", "", "output file (default: stdout)")
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	opts := &loader.MatrixOptions{Users: splitNames(*users), Repos: splitNames(*repos)}
+	var ok bool
+	if opts.Collapse, ok = collapses[*collapse]; !ok {
+		fmt.Fprintf(oerr(), "Unknown collapse '%v' (repo, group or project expected)\n", *collapse)
+		return &exitError{fmt.Errorf("collapse '%v'", *collapse), exitUsage}
+	}
+	if *format != "csv" && *format != "xlsx" {
+		fmt.Fprintf(oerr(), "Unknown format '%v' (csv or xlsx expected)\n", *format)
+		return &exitError{fmt.Errorf("format '%v'", *format), exitUsage}
+	}
+	rows := matrixRows(conf.Matrix(opts))
+	return writeOutput(*output, func(w io.Writer) error {
+		if *format == "xlsx" {
+			return writeXLSX(w, rows)
+		}
+		return writeCSV(w, rows)
+	})
+}
+
+func splitNames(names string) []string {
+	res := []string{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// matrixRows returns the rows of a matrix: a header with the repos,
+// then a row per user
+func matrixRows(m *loader.Matrix) [][]string {
+	res := [][]string{append([]string{"user"}, m.Repos...)}
+	for i, username := range m.Users {
+		res = append(res, append([]string{username}, m.Cells[i]...))
+	}
+	return res
+}
+
+func writeCSV(w io.Writer, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// parts of a workbook with a single sheet, but the sheet itself (see xlsxSheet)
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="access" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// writeXLSX writes rows as a workbook with a single sheet of inline strings
+func writeXLSX(w io.Writer, rows [][]string) error {
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/worksheets/sheet1.xml", xlsxSheet(rows)},
+	}
+	for _, part := range parts {
+		pw, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(pw, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func xlsxSheet(rows [][]string) string {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, cell := range row {
+			if cell == "" {
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%v%d" t="inlineStr"><is><t>`, xlsxColumn(j), i+1)
+			xml.EscapeText(&b, []byte(cell))
+			b.WriteString(`</t></is></c>`)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// xlsxColumn returns the name of the j'th (from 0) column: A to Z, then AA, AB...
+func xlsxColumn(j int) string {
+	res := ""
+	for j++; j > 0; j = (j - 1) / 26 {
+		res = string(rune('A'+(j-1)%26)) + res
+	}
+	return res
+}
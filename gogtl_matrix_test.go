@@ -0,0 +1,83 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMatrix(t *testing.T) {
+	Convey("Prints the permission of each user on each repo", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "project.conf"), []byte("repo @project\n  RW+ = user3\n"), 0644)
+
+		Convey("As CSV", func() {
+			So(run([]string{"matrix", "-users", "user1, user2,user3,admin1", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, `user,gitolite-admin,module1,module2
+admin1,RW+,,
+user1,,RW,
+user2,,RW,RW
+user3,,RW+,RW+
+`)
+			resetStds()
+		})
+
+		Convey("By project, for some repos", func() {
+			So(run([]string{"matrix", "-collapse", "project", "-repos", "project", "-users", "user2,pu1", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, "user,project\npu1,RW\nuser2,RW\n")
+			resetStds()
+		})
+
+		Convey("As XLSX", func() {
+			xlsx := filepath.Join(tmp, "matrix.xlsx")
+			So(run([]string{"matrix", "-format", "xlsx", "-o", xlsx, "-collapse", "group", "-users", "user1", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, "")
+			zr, err := zip.OpenReader(xlsx)
+			So(err, ShouldBeNil)
+			defer zr.Close()
+			names := []string{}
+			sheet := ""
+			for _, f := range zr.File {
+				names = append(names, f.Name)
+				if f.Name == "xl/worksheets/sheet1.xml" {
+					r, _ := f.Open()
+					b, _ := ioutil.ReadAll(r)
+					r.Close()
+					sheet = string(b)
+				}
+			}
+			So(names, ShouldResemble, []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"})
+			So(sheet, ShouldContainSubstring, `<row r="1"><c r="A1" t="inlineStr"><is><t>user</t></is></c><c r="B1" t="inlineStr"><is><t>@project</t></is></c><c r="C1" t="inlineStr"><is><t>gitolite-admin</t></is></c></row>`)
+			So(sheet, ShouldContainSubstring, `<row r="2"><c r="A2" t="inlineStr"><is><t>user1</t></is></c><c r="B2" t="inlineStr"><is><t>RW</t></is></c></row>`)
+			resetStds()
+		})
+
+		Convey("Usage error if unknown format or collapse", func() {
+			So(run([]string{"matrix", "-format", "ods", conffile}), ShouldEqual, 2)
+			So(run([]string{"matrix", "-collapse", "team", conffile}), ShouldEqual, 2)
+			flushStds()
+			So(berr.String(), ShouldEqual, "Unknown format 'ods' (csv or xlsx expected)\nUnknown collapse 'team' (repo, group or project expected)\n")
+			resetStds()
+		})
+	})
+
+	Convey("Names XLSX columns", t, func() {
+		So(xlsxColumn(0), ShouldEqual, "A")
+		So(xlsxColumn(25), ShouldEqual, "Z")
+		So(xlsxColumn(26), ShouldEqual, "AA")
+		So(xlsxColumn(701), ShouldEqual, "ZZ")
+		So(xlsxColumn(702), ShouldEqual, "AAA")
+	})
+}
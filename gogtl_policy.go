@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/VonC/gogitolite/loader"
+)
+
+// policy prints the violations of a policy file (see loader.ReadPolicies)
+// by the config and its subconfs on stderr, and fails if there is any.
+func policy(a []string) error {
+	fs := newFlagSet("policy")
+	cf := addConfFlags(fs)
+	policyfile := fs.String("policies", "", "policy file")
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	if *policyfile == "" {
+		fmt.Fprintf(oerr(), "Missing -policies file\n")
+		return &exitError{fmt.Errorf("no policy file"), exitUsage}
+	}
+	policies, err := getPolicies(*policyfile)
+	if err != nil {
+		return err
+	}
+	errs := conf.CheckPolicies(policies)
+	for _, err := range errs {
+		fmt.Fprintf(oerr(), "%v\n", diagnostic(err))
+	}
+	return policyError(conf, errs)
+}
+
+// policyError returns the error ending a command when errs (the result of
+// conf.CheckPolicies) isn't empty
+func policyError(conf *loader.Conf, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &exitError{fmt.Errorf("%v policy violation(s) in '%v'", len(errs), conf.Filename()), exitPolicy}
+}
+
+func getPolicies(filename string) ([]*loader.Policy, error) {
+	f, err := os.Open(filename)
+	if err == nil {
+		defer f.Close()
+		var policies []*loader.Policy
+		if policies, err = loader.ReadPolicies(bufio.NewReader(f)); err == nil {
+			return policies, nil
+		}
+	}
+	fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+	return nil, err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicy(t *testing.T) {
+	Convey("Checks the config against a policy file", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+		policies := filepath.Join(tmp, "policies")
+
+		Convey("Violations are printed like lint findings", func() {
+			ioutil.WriteFile(policies, []byte("# admins only\nonly @almadmins RW+\ndeny user2 W master\n"), 0644)
+			So(run([]string{"policy", "-policies", policies, conffile}), ShouldEqual, exitPolicy)
+			flushStds()
+			So(bout.String(), ShouldEqual, "")
+			So(berr.String(), ShouldEqual, `'gitoliteadm' has 'RW+' on repo 'gitolite-admin' (rule 'RW+') [only @almadmins RW+]
+'user2' has 'W' on repo 'module1' (rule 'RW') [deny user2 W master]
+'user2' has 'W' on repo 'module2' (rule 'RW') [deny user2 W master]
+`)
+			resetStds()
+		})
+
+		Convey("A followed policy file prints nothing", func() {
+			ioutil.WriteFile(policies, []byte("deny @all R\n"), 0644)
+			So(run([]string{"policy", "-policies", policies, conffile}), ShouldEqual, 0)
+			flushStds()
+			So(berr.String(), ShouldEqual, "")
+			resetStds()
+		})
+
+		Convey("An incorrect policy file is an error", func() {
+			ioutil.WriteFile(policies, []byte("\nallow @all R\n"), 0644)
+			So(run([]string{"policy", "-policies", policies, conffile}), ShouldEqual, exitFailure)
+			flushStds()
+			So(berr.String(), ShouldEqual, "ERR Incorrect policy 'allow @all R' at line 2\n")
+			resetStds()
+		})
+
+		Convey("The policy file is required", func() {
+			So(run([]string{"policy", conffile}), ShouldEqual, exitUsage)
+			flushStds()
+			So(berr.String(), ShouldEqual, "Missing -policies file\n")
+			resetStds()
+		})
+	})
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VonC/gogitolite/loader"
+)
+
+// privs prints who can rewind or delete protected refs, as
+// 'user,repo,refex,rule,via' lines
+func privs(a []string) error {
+	fs := newFlagSet("privs")
+	cf := addConfFlags(fs)
+	refs := fs.String("refs", strings.Join(loader.DefaultProtectedRefs, ","), "comma-separated refexes of the protected refs")
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	for _, p := range conf.Privileged(splitNames(*refs)) {
+		fmt.Fprintf(out(), "%v,%v,%v,%v,%v\n", p.User, p.Repo, p.Ref, p.Rule, p.Via)
+	}
+	return nil
+}
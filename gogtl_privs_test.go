@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrivs(t *testing.T) {
+	Convey("Prints who can rewind or delete protected refs", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "project.conf"), []byte("repo @project\n  RW+ release/ = pu2\n"), 0644)
+
+		Convey("On master and release branches by default", func() {
+			So(run([]string{"privs", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, `admin1,gitolite-admin,master,RW+,@almadmins
+admin1,gitolite-admin,release/,RW+,@almadmins
+admin2,gitolite-admin,master,RW+,@almadmins
+admin2,gitolite-admin,release/,RW+,@almadmins
+gitoliteadm,gitolite-admin,master,RW+,
+gitoliteadm,gitolite-admin,release/,RW+,
+pu2,module1,release/,RW+ release/,
+pu2,module2,release/,RW+ release/,
+`)
+			resetStds()
+		})
+
+		Convey("On given refs", func() {
+			So(run([]string{"privs", "-refs", "release/1.0, next", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, `admin1,gitolite-admin,next,RW+,@almadmins
+admin1,gitolite-admin,release/1.0,RW+,@almadmins
+admin2,gitolite-admin,next,RW+,@almadmins
+admin2,gitolite-admin,release/1.0,RW+,@almadmins
+gitoliteadm,gitolite-admin,next,RW+,
+gitoliteadm,gitolite-admin,release/1.0,RW+,
+pu2,module1,release/1.0,RW+ release/,
+pu2,module2,release/1.0,RW+ release/,
+`)
+			resetStds()
+		})
+	})
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VonC/gogitolite/gitolite"
+	"github.com/VonC/gogitolite/gitrepo"
+	"github.com/VonC/gogitolite/loader"
+	"github.com/VonC/gogitolite/project"
+)
+
+// server exposes read-only JSON endpoints on a gitolite config and its
+// subconfs, loaded once, and reloaded when a file read changes (see
+// reloadIfChanged), or on SIGHUP.
+// Access checks are made on a snapshot of the config, swapped on reload.
+type server struct {
+	filename string
+	cf       *confFlags
+	mu       sync.RWMutex
+	conf     *loader.Conf
+	pm       *project.Manager
+	stamp    string
+	// files are the paths watched for the last config loaded successfully
+	// (see watched)
+	files []string
+	snap  gitolite.Holder
+}
+
+type projectJSON struct {
+	Name    string   `json:"name"`
+	Admins  []string `json:"admins"`
+	Members []string `json:"members"`
+}
+
+type diagnosticJSON struct {
+	Project string `json:"project"`
+	Code    string `json:"code"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type accessJSON struct {
+	User    string `json:"user"`
+	Repo    string `json:"repo"`
+	Ref     string `json:"ref"`
+	Perm    string `json:"perm"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// serve loads a gitolite config, and serves it over HTTP until stopped.
+func serve(a []string) error {
+	fs := newFlagSet("serve")
+	cf := addConfFlags(fs)
+	addr := fs.String("addr", ":8080", "HTTP address to listen to")
+	poll := fs.Duration("poll", 2*time.Second, "delay between two checks for conf changes")
+	filename, err := parse(fs, a)
+	if err != nil {
+		return err
+	}
+	srv, err := newServer(filename, cf)
+	if err != nil {
+		return err
+	}
+	hup := make(chan os.Signal, 1)
+	notifyReload(hup)
+	go func() {
+		ticker := time.NewTicker(*poll)
+		for {
+			select {
+			case <-hup:
+				if err := srv.load(); err == nil {
+					fmt.Fprintf(out(), "Reloaded '%v'\n", filename)
+				}
+			case <-ticker.C:
+				if reloaded, err := srv.reloadIfChanged(); reloaded && err == nil {
+					fmt.Fprintf(out(), "Reloaded '%v'\n", filename)
+				}
+			}
+		}
+	}()
+	fmt.Fprintf(out(), "Serving '%v' on '%v'\n", filename, *addr)
+	err = http.ListenAndServe(*addr, srv)
+	fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+	return err
+}
+
+// newServer creates a server on a gitolite config, loaded (and reloaded)
+// with the conf flags
+func newServer(filename string, cf *confFlags) (*server, error) {
+	srv := &server{filename: filename, cf: cf, files: []string{filename}}
+	if err := srv.load(); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// load reads the config and its subconfs. On error (with -strict, if
+// anything is ignored while reading them), the previous config (if any) is kept.
+func (srv *server) load() error {
+	srv.mu.RLock()
+	files := srv.files
+	srv.mu.RUnlock()
+	stamp := srv.confStamp(files)
+	conf, err := srv.cf.load(srv.filename)
+	if err == nil && *srv.cf.strict {
+		err = checkError(conf, conf.Check())
+	}
+	if err != nil {
+		srv.mu.Lock()
+		srv.stamp = stamp
+		srv.mu.Unlock()
+		return err
+	}
+	pm := conf.ProjectManager()
+	snap := gitolite.Freeze(conf.Gitolite())
+	if !sameNames(files, watched(conf)) {
+		stamp = srv.confStamp(watched(conf))
+	}
+	srv.mu.Lock()
+	srv.conf, srv.pm, srv.stamp, srv.files = conf, pm, stamp, watched(conf)
+	srv.snap.Store(snap)
+	srv.mu.Unlock()
+	return nil
+}
+
+// confStamp summarizes the paths watched for a config (see watched,
+// confStamp), or, with -repo, the commit the config is read from.
+func (srv *server) confStamp(files []string) string {
+	if *srv.cf.repo == "" {
+		return confStamp(files, *srv.cf.rc)
+	}
+	commit := ""
+	if repo, err := gitrepo.Open(*srv.cf.repo); err == nil {
+		commit, _ = repo.Resolve(*srv.cf.rev)
+	}
+	return confStamp(nil, *srv.cf.rc) + fmt.Sprintf("commit %v\n", commit)
+}
+
+// reloadIfChanged reloads the config if a file it has been read from (or
+// the rc file) has been added, removed or modified since the last load.
+func (srv *server) reloadIfChanged() (bool, error) {
+	srv.mu.RLock()
+	stamp, files := srv.stamp, srv.files
+	srv.mu.RUnlock()
+	if srv.confStamp(files) == stamp {
+		return false, nil
+	}
+	return true, srv.load()
+}
+
+func (srv *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		writeJSON(w, http.StatusMethodNotAllowed, &errorJSON{fmt.Sprintf("method '%v' not allowed", req.Method)})
+		return
+	}
+	srv.mu.RLock()
+	conf, pm := srv.conf, srv.pm
+	srv.mu.RUnlock()
+	q := req.URL.Query()
+	switch req.URL.Path {
+	case "/projects":
+		res := []*projectJSON{}
+		for _, p := range pm.Projects() {
+			pj := &projectJSON{Name: p.Name(), Admins: []string{}, Members: []string{}}
+			for _, admin := range p.Admins() {
+				pj.Admins = append(pj.Admins, admin.GetName())
+			}
+			for _, member := range p.Members() {
+				pj.Members = append(pj.Members, member.GetName())
+			}
+			res = append(res, pj)
+		}
+		writeJSON(w, http.StatusOK, res)
+	case "/diagnostics":
+		res := []*diagnosticJSON{}
+		for _, d := range pm.Diagnostics() {
+			res = append(res, &diagnosticJSON{Project: d.Project, Code: d.Code.String(), Rule: strings.TrimSpace(d.Rule.Access() + " " + d.Rule.Param()), Message: d.Error()})
+		}
+		writeJSON(w, http.StatusOK, res)
+	case "/repos":
+		writeJSON(w, http.StatusOK, conf.Repos())
+	case "/users":
+		writeJSON(w, http.StatusOK, conf.Users())
+	case "/who":
+		if reponame := q.Get("repo"); reponame != "" {
+			writeJSON(w, http.StatusOK, conf.WhoCanAccess(reponame))
+		} else {
+			writeJSON(w, http.StatusBadRequest, &errorJSON{"parameter 'repo' expected"})
+		}
+	case "/what":
+		if username := q.Get("user"); username != "" {
+			writeJSON(w, http.StatusOK, conf.WhatCanAccess(username))
+		} else {
+			writeJSON(w, http.StatusBadRequest, &errorJSON{"parameter 'user' expected"})
+		}
+	case "/access":
+		aj := &accessJSON{User: q.Get("user"), Repo: q.Get("repo"), Ref: q.Get("ref"), Perm: q.Get("perm")}
+		if aj.Perm == "" {
+			aj.Perm = "R"
+		}
+		if aj.User == "" || aj.Repo == "" || (aj.Perm != "R" && aj.Ref == "") {
+			writeJSON(w, http.StatusBadRequest, &errorJSON{"parameters 'user', 'repo' and (unless perm is R) 'ref' expected"})
+			return
+		}
+		if err := srv.snap.Load().CheckAccess(aj.User, aj.Repo, aj.Ref, aj.Perm); err != nil {
+			aj.Reason = err.Error()
+		} else {
+			aj.Allowed = true
+		}
+		writeJSON(w, http.StatusOK, aj)
+	default:
+		writeJSON(w, http.StatusNotFound, &errorJSON{fmt.Sprintf("unknown path '%v'", req.URL.Path)})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
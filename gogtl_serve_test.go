@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func get(url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		panic(err)
+	}
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(v)
+	return resp.StatusCode
+}
+
+func TestServe(t *testing.T) {
+	Convey("Serves access data over HTTP", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "project.conf"), []byte("repo @project\n  RW = user3\n"), 0644)
+
+		srv, err := newServer(conffile, addConfFlags(newFlagSet("serve")))
+		So(err, ShouldBeNil)
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+
+		Convey("Lists projects, repos and users", func() {
+			projects := []*projectJSON{}
+			So(get(ts.URL+"/projects", &projects), ShouldEqual, http.StatusOK)
+			So(len(projects), ShouldEqual, 1)
+			So(projects[0].Name, ShouldEqual, "project")
+			So(projects[0].Admins, ShouldResemble, []string{"projectowner1", "projectowner2"})
+			So(projects[0].Members, ShouldResemble, []string{"user1", "user11", "user2", "pu1", "user21"})
+			diagnostics := []*diagnosticJSON{}
+			So(get(ts.URL+"/diagnostics", &diagnostics), ShouldEqual, http.StatusOK)
+			So(len(diagnostics), ShouldEqual, 0)
+
+			names := []string{}
+			So(get(ts.URL+"/repos", &names), ShouldEqual, http.StatusOK)
+			So(names, ShouldResemble, []string{"gitolite-admin", "module1", "module2"})
+			So(get(ts.URL+"/users", &names), ShouldEqual, http.StatusOK)
+			So(names, ShouldResemble, []string{"admin1", "admin2", "gitoliteadm", "projectowner1", "projectowner2", "pu1", "user1", "user11", "user2", "user21", "user3"})
+		})
+
+		Convey("Tells who can access what", func() {
+			names := []string{}
+			So(get(ts.URL+"/who?repo=module2", &names), ShouldEqual, http.StatusOK)
+			So(names, ShouldResemble, []string{"pu1", "user2", "user21", "user3"})
+			So(get(ts.URL+"/what?user=user3", &names), ShouldEqual, http.StatusOK)
+			So(names, ShouldResemble, []string{"@project", "module1", "module2"})
+
+			e := &errorJSON{}
+			So(get(ts.URL+"/who", e), ShouldEqual, http.StatusBadRequest)
+			So(e.Error, ShouldEqual, "parameter 'repo' expected")
+			So(get(ts.URL+"/what", e), ShouldEqual, http.StatusBadRequest)
+			So(e.Error, ShouldEqual, "parameter 'user' expected")
+			So(get(ts.URL+"/unknown", e), ShouldEqual, http.StatusNotFound)
+			So(e.Error, ShouldEqual, "unknown path '/unknown'")
+
+			resp, err := http.Post(ts.URL+"/repos", "application/json", strings.NewReader("{}"))
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+			resp.Body.Close()
+		})
+
+		Convey("Checks effective permissions", func() {
+			aj := &accessJSON{}
+			So(get(ts.URL+"/access?user=user3&repo=module1&ref=refs/heads/master&perm=W", aj), ShouldEqual, http.StatusOK)
+			So(aj.Allowed, ShouldBeTrue)
+			So(aj.Reason, ShouldEqual, "")
+			aj = &accessJSON{}
+			So(get(ts.URL+"/access?user=user3&repo=module1&ref=refs/heads/master&perm=%2B", aj), ShouldEqual, http.StatusOK)
+			So(aj.Allowed, ShouldBeFalse)
+			So(aj.Reason, ShouldEqual, "+ refs/heads/master module1 user3 DENIED by fallthru")
+			aj = &accessJSON{}
+			So(get(ts.URL+"/access?user=user1&repo=module1", aj), ShouldEqual, http.StatusOK)
+			So(aj.Perm, ShouldEqual, "R")
+			So(aj.Allowed, ShouldBeTrue)
+
+			e := &errorJSON{}
+			So(get(ts.URL+"/access?user=user1&repo=module1&perm=W", e), ShouldEqual, http.StatusBadRequest)
+			So(e.Error, ShouldEqual, "parameters 'user', 'repo' and (unless perm is R) 'ref' expected")
+		})
+
+		Convey("Reloads the config when a file changes", func() {
+			reloaded, err := srv.reloadIfChanged()
+			So(reloaded, ShouldBeFalse)
+			So(err, ShouldBeNil)
+
+			subconf := filepath.Join(tmp, "conf", "subs", "project.conf")
+			ioutil.WriteFile(subconf, []byte("repo @project\n  RW = user4\n"), 0644)
+			later := time.Now().Add(time.Minute)
+			os.Chtimes(subconf, later, later)
+			reloaded, err = srv.reloadIfChanged()
+			So(reloaded, ShouldBeTrue)
+			So(err, ShouldBeNil)
+			names := []string{}
+			get(ts.URL+"/who?repo=module2", &names)
+			So(names, ShouldResemble, []string{"pu1", "user2", "user21", "user4"})
+
+			os.Rename(subconf, filepath.Join(tmp, "conf", "subs", "other.conf"))
+			reloaded, err = srv.reloadIfChanged()
+			So(reloaded, ShouldBeTrue)
+			diagnostics := []*diagnosticJSON{}
+			So(get(ts.URL+"/diagnostics", &diagnostics), ShouldEqual, http.StatusOK)
+			So(len(diagnostics), ShouldEqual, 1)
+			So(*diagnostics[0], ShouldResemble, diagnosticJSON{Project: "project", Code: "NoSubconf", Rule: "- VREF/NAME/", Message: "Ignore project name 'project': no subconf found"})
+			os.Rename(filepath.Join(tmp, "conf", "subs", "other.conf"), subconf)
+			srv.reloadIfChanged()
+
+			ioutil.WriteFile(conffile, []byte("invalid"), 0644)
+			reloaded, err = srv.reloadIfChanged()
+			flushStds()
+			So(reloaded, ShouldBeTrue)
+			So(err, ShouldNotBeNil)
+			get(ts.URL+"/who?repo=module2", &names)
+			So(names, ShouldResemble, []string{"pu1", "user2", "user21", "user4"})
+			reloaded, _ = srv.reloadIfChanged()
+			So(reloaded, ShouldBeFalse)
+			resetStds()
+		})
+
+		Convey("Error if the config can't be read", func() {
+			srv, err := newServer(filepath.Join(tmp, "unknown.conf"), addConfFlags(newFlagSet("serve")))
+			flushStds()
+			So(srv, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			resetStds()
+		})
+
+		Convey("Reads the config with the conf flags", func() {
+			fs := newFlagSet("serve")
+			cf := addConfFlags(fs)
+			So(fs.Parse([]string{"-strict"}), ShouldBeNil)
+			srv, err := newServer("_tests/p1/conf/gitolite.conf", cf)
+			So(srv, ShouldBeNil)
+			So(err.(*exitError).code, ShouldEqual, exitSubconf)
+			srv, err = newServer("_tests/p1/conf/gitolite.conf", addConfFlags(newFlagSet("serve")))
+			So(err, ShouldBeNil)
+			So(srv, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// notifyReload does nothing: there is no SIGHUP on Windows,
+// serve only reloads the config when a file changes.
+func notifyReload(c chan os.Signal) {
+}
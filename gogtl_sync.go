@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/VonC/gogitolite/loader"
+	"github.com/VonC/gogitolite/reader"
+)
+
+// syncGroups synchronises groups of the config with their members imported
+// from a CSV or LDIF file: it prints the changes as a diff of the config
+// file, and writes them with -apply.
+func syncGroups(a []string) error {
+	fs := newFlagSet("sync")
+	cf := addConfFlags(fs)
+	from := fs.String("from", "", "CSV ('group,member' lines) or LDIF file of group members")
+	format := fs.String("format", "csv", "format of the -from file: csv or ldif")
+	groups := fs.String("groups", "", "comma-separated groups to synchronise")
+	apply := fs.Bool("apply", false, "write the changes to the config file")
+	conf, err := parseConf(fs, cf, a)
+	if err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "ldif" {
+		fmt.Fprintf(oerr(), "Unknown format '%v' (csv or ldif expected)\n", *format)
+		return &exitError{fmt.Errorf("format '%v'", *format), exitUsage}
+	}
+	if *from == "" || len(splitNames(*groups)) == 0 {
+		fmt.Fprintf(oerr(), "Missing -from file or -groups\n")
+		return &exitError{fmt.Errorf("no -from file or -groups"), exitUsage}
+	}
+	if *apply && conf.Tree() != nil {
+		fmt.Fprintf(oerr(), "Can't apply changes to a config read from a git repository\n")
+		return &exitError{fmt.Errorf("-apply with -repo"), exitUsage}
+	}
+	members, err := getMembers(*from, *format)
+	if err != nil {
+		return err
+	}
+	changes, err := conf.GroupChanges(members, splitNames(*groups))
+	if err != nil {
+		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(out(), "No group change\n")
+		return nil
+	}
+	before, after, err := conf.ApplyGroupChanges(changes)
+	if err != nil {
+		fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+		return err
+	}
+	printGroupChanges(conf, changes, before, after)
+	if *apply {
+		return writeConf(conf.Filename(), after)
+	}
+	return nil
+}
+
+// printGroupChanges prints the members added to and removed from each group,
+// then the changed lines of the config file, as a unified diff
+// (group changes don't add nor remove lines).
+func printGroupChanges(conf *loader.Conf, changes []*loader.GroupChange, before, after string) {
+	for _, gc := range changes {
+		fmt.Fprintf(out(), "%v: %v added (%v), %v removed (%v)\n", gc.Group,
+			len(gc.Added), strings.Join(gc.Added, ", "), len(gc.Removed), strings.Join(gc.Removed, ", "))
+	}
+	fmt.Fprintf(out(), "--- %v\n+++ %v\n", conf.Filename(), conf.Filename())
+	blines, alines := strings.Split(before, "\n"), strings.Split(after, "\n")
+	for i := range blines {
+		if i < len(alines) && blines[i] != alines[i] {
+			fmt.Fprintf(out(), "@@ -%v +%v @@\n-%v\n+%v\n", i+1, i+1, blines[i], alines[i])
+		}
+	}
+}
+
+func writeConf(filename, content string) error {
+	fi, err := os.Stat(filename)
+	if err == nil {
+		if err = ioutil.WriteFile(filename, []byte(content), fi.Mode()); err == nil {
+			fmt.Fprintf(out(), "Updated '%v'\n", filename)
+			return nil
+		}
+	}
+	fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+	return err
+}
+
+func getMembers(filename, format string) (reader.Members, error) {
+	f, err := os.Open(filename)
+	if err == nil {
+		defer f.Close()
+		var members reader.Members
+		if format == "ldif" {
+			members, err = reader.ReadMembersLDIF(bufio.NewReader(f))
+		} else {
+			members, err = reader.ReadMembersCSV(bufio.NewReader(f))
+		}
+		if err == nil {
+			return members, nil
+		}
+	}
+	fmt.Fprintf(oerr(), "ERR %v\n", err.Error())
+	return nil, err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSync(t *testing.T) {
+	Convey("Synchronises groups with imported members", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+		csvfile := filepath.Join(tmp, "members.csv")
+		ioutil.WriteFile(csvfile, []byte("group,member\nalmadmins,admin2\nalmadmins,admin3\n"), 0644)
+		diff := `@almadmins: 1 added (admin3), 1 removed (admin1)
+--- ` + conffile + `
++++ ` + conffile + `
+@@ -3 +3 @@
+-		@almadmins = admin1 admin2
++		@almadmins = admin2 admin3
+`
+
+		Convey("Changes are printed as a diff", func() {
+			So(run([]string{"sync", "-from", csvfile, "-groups", "@almadmins", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, diff)
+			b, _ := ioutil.ReadFile(conffile)
+			So(string(b), ShouldEqual, gitoliteconf)
+			resetStds()
+		})
+
+		Convey("Changes are written with -apply", func() {
+			So(run([]string{"sync", "-from", csvfile, "-groups", "@almadmins", "-apply", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, diff+"Updated '"+conffile+"'\n")
+			b, _ := ioutil.ReadFile(conffile)
+			So(string(b), ShouldEqual, strings.Replace(gitoliteconf, "admin1 admin2", "admin2 admin3", 1))
+			resetStds()
+
+			So(run([]string{"sync", "-from", csvfile, "-groups", "@almadmins", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, "No group change\n")
+			resetStds()
+		})
+
+		Convey("Members can be imported from LDIF", func() {
+			ldif := filepath.Join(tmp, "members.ldif")
+			ioutil.WriteFile(ldif, []byte("dn: cn=almadmins,ou=groups\nobjectClass: posixGroup\nmemberUid: admin2\nmemberUid: admin3\n"), 0644)
+			So(run([]string{"sync", "-format", "ldif", "-from", ldif, "-groups", "almadmins", conffile}), ShouldEqual, 0)
+			flushStds()
+			So(bout.String(), ShouldEqual, diff)
+			resetStds()
+		})
+
+		Convey("Groups must be imported users groups of the config", func() {
+			So(run([]string{"sync", "-from", csvfile, "-groups", "@project", conffile}), ShouldEqual, exitFailure)
+			flushStds()
+			So(berr.String(), ShouldEqual, "ERR group '@project' is a repos group, not a user one\n")
+			resetStds()
+		})
+
+		Convey("A file and groups are required", func() {
+			So(run([]string{"sync", "-from", csvfile, conffile}), ShouldEqual, exitUsage)
+			flushStds()
+			So(berr.String(), ShouldEqual, "Missing -from file or -groups\n")
+			resetStds()
+			So(run([]string{"sync", "-format", "json", "-from", csvfile, "-groups", "@almadmins", conffile}), ShouldEqual, exitUsage)
+			flushStds()
+			So(berr.String(), ShouldEqual, "Unknown format 'json' (csv or ldif expected)\n")
+			resetStds()
+		})
+	})
+}
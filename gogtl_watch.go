@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/VonC/gogitolite/gitolite"
+	"github.com/VonC/gogitolite/loader"
+)
+
+// watcher re-reads a config and its subconfs each time a file read changes
+// (see confStamp), and reports the lint findings of the new config, and
+// the accesses changed since the last config read successfully.
+type watcher struct {
+	filename string
+	rcfile   string
+	verbose  bool
+	started  bool
+	stamp    string
+	// files are the paths watched for the last config read successfully
+	// (see watched)
+	files []string
+	prev  map[string]map[string]bool
+}
+
+// watch re-reads a config (from disk) each time a file it has been read
+// from, or the rc file, changes, until the process stops.
+func watch(a []string) error {
+	fs := newFlagSet("watch")
+	verbose := fs.Bool("v", false, "verbose, display filenames read")
+	rcfile := fs.String("rc", "", "gitolite.rc file (UMASK, GIT_CONFIG_KEYS, ROLES, ...)")
+	poll := fs.Duration("poll", 2*time.Second, "delay between two checks for conf changes")
+	filename, err := parse(fs, a)
+	if err != nil {
+		return err
+	}
+	if *rcfile != "" {
+		if _, err = getRC(*rcfile); err != nil {
+			return err
+		}
+	}
+	w := newWatcher(filename, *rcfile)
+	w.verbose = *verbose
+	w.watch(*poll)
+	return nil
+}
+
+// newWatcher creates a watcher of a config, read with a rc file if not empty
+func newWatcher(filename, rcfile string) *watcher {
+	return &watcher{filename: filename, rcfile: rcfile, files: []string{filename}}
+}
+
+// watch checks for conf changes every poll delay, until the process stops.
+func (w *watcher) watch(poll time.Duration) {
+	for {
+		w.runIfChanged()
+		time.Sleep(poll)
+	}
+}
+
+// runIfChanged re-reads the config on the first call, then only if a file
+// it has been read from, or the rc file, has been added, removed or
+// modified since.
+func (w *watcher) runIfChanged() bool {
+	stamp := confStamp(w.files, w.rcfile)
+	if w.started && stamp == w.stamp {
+		return false
+	}
+	files := w.files
+	w.started, w.stamp = true, stamp
+	w.run()
+	if !sameNames(files, w.files) {
+		w.stamp = confStamp(w.files, w.rcfile)
+	}
+	return true
+}
+
+// run reads the rc file, the config and its subconfs, and prints lint
+// findings and access changes. Parse errors are printed on stderr when
+// detected, and the accesses of the last successful read are kept for the
+// next diff.
+func (w *watcher) run() {
+	var rc *gitolite.RC
+	var err error
+	if w.rcfile != "" {
+		if rc, err = getRC(w.rcfile); err != nil {
+			fmt.Fprintf(oerr(), "Unable to read '%v', waiting for the next change\n", w.rcfile)
+			return
+		}
+	}
+	ld := newLoader(nil, rc)
+	ld.SetVerbose(w.verbose)
+	conf, err := ld.Load(w.filename)
+	if err != nil {
+		fmt.Fprintf(oerr(), "Unable to read '%v', waiting for the next change\n", w.filename)
+		return
+	}
+	findings := conf.Check()
+	cur := conf.Accesses()
+	changes := []*accessChange{}
+	if w.prev != nil {
+		changes = diffAccesses(w.prev, cur)
+	}
+	fmt.Fprintf(out(), "Read '%v': %v lint finding(s), %v access change(s)\n", w.filename, len(findings), len(changes))
+	for _, finding := range findings {
+		fmt.Fprintf(oerr(), "LINT %v\n", diagnostic(finding))
+	}
+	for _, ac := range changes {
+		fmt.Fprintf(out(), "%v\n", ac)
+	}
+	w.prev, w.files = cur, watched(conf)
+}
+
+// watched returns the paths whose changes mean a config must be read again:
+// the files it has been read from, then the directories searched for its
+// subconf files (where a first file can be added).
+func watched(conf *loader.Conf) []string {
+	return append(append([]string{}, conf.Files()...), conf.GlobDirs()...)
+}
+
+// confStamp summarizes the names, sizes and modification times of the
+// paths watched for a config (see watched), of their directories (changed
+// when a subconf file is added or removed), and of the rc file if not empty.
+func confStamp(files []string, rcfile string) string {
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, filepath.Dir(file), file)
+	}
+	if rcfile != "" {
+		paths = append(paths, rcfile)
+	}
+	res := ""
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if f, err := os.Stat(path); err == nil {
+			res = res + fmt.Sprintf("%v %v %v\n", path, f.Size(), f.ModTime().UnixNano())
+		} else {
+			res = res + fmt.Sprintf("%v missing\n", path)
+		}
+	}
+	return res
+}
+
+// sameNames checks if two lists have the same names, in the same order
+func sameNames(names1, names2 []string) bool {
+	if len(names1) != len(names2) {
+		return false
+	}
+	for i := range names1 {
+		if names1[i] != names2[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWatch(t *testing.T) {
+	Convey("Watches a config", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		subconf := filepath.Join(tmp, "conf", "subs", "project.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+		ioutil.WriteFile(subconf, []byte("repo @project\n  RW = user3\n"), 0644)
+		touch := func(filename, content string) {
+			ioutil.WriteFile(filename, []byte(content), 0644)
+			later := time.Now().Add(time.Minute)
+			os.Chtimes(filename, later, later)
+		}
+		w := newWatcher(conffile, "")
+
+		Convey("Reads the config on the first check, then only on changes", func() {
+			So(w.runIfChanged(), ShouldBeTrue)
+			flushStds()
+			So(bout.String(), ShouldEqual, "Read '"+conffile+"': 0 lint finding(s), 0 access change(s)\n")
+			resetStds()
+			So(w.runIfChanged(), ShouldBeFalse)
+		})
+
+		Convey("Only checks the files read, and the rc file", func() {
+			rcfile := filepath.Join(tmp, "gitolite.rc")
+			ioutil.WriteFile(rcfile, []byte("%RC = (\n);\n"), 0644)
+			notes := filepath.Join(tmp, "conf", "notes.txt")
+			ioutil.WriteFile(notes, []byte("not read"), 0644)
+			w = newWatcher(conffile, rcfile)
+			So(w.runIfChanged(), ShouldBeTrue)
+			resetStds()
+			So(w.files, ShouldResemble, []string{conffile, subconf, filepath.Join(tmp, "conf", "subs")})
+			touch(notes, "still not read")
+			So(w.runIfChanged(), ShouldBeFalse)
+			touch(rcfile, "%RC = (\n  UMASK => 0077,\n);\n")
+			So(w.runIfChanged(), ShouldBeTrue)
+			resetStds()
+		})
+
+		Convey("Reads the config again when a first subconf file is added", func() {
+			os.Remove(subconf)
+			So(w.runIfChanged(), ShouldBeTrue)
+			resetStds()
+			So(w.files, ShouldResemble, []string{conffile, filepath.Join(tmp, "conf", "subs")})
+			touch(subconf, "repo @project\n  RW = user3\n")
+			So(w.runIfChanged(), ShouldBeTrue)
+			resetStds()
+			So(w.files, ShouldResemble, []string{conffile, subconf, filepath.Join(tmp, "conf", "subs")})
+		})
+
+		Convey("Prints lint findings and access changes", func() {
+			w.runIfChanged()
+			resetStds()
+			touch(subconf, "repo @project\n  RW = user4\n")
+			touch(filepath.Join(tmp, "conf", "subs", "bad.conf"), "repo\n")
+			So(w.runIfChanged(), ShouldBeTrue)
+			flushStds()
+			So(berr.String(), ShouldEndWith, "LINT subconf file 'subs/bad.conf': Parse Error: group or repo expected after line 1 ('repo')\n")
+			So(bout.String(), ShouldEqual, "Read '"+conffile+`': 1 lint finding(s), 6 access change(s)
+- user3 @project
+- user3 module1
+- user3 module2
++ user4 @project
++ user4 module1
++ user4 module2
+`)
+			resetStds()
+		})
+
+		Convey("Keeps the last successful read on parse errors", func() {
+			w.runIfChanged()
+			touch(conffile, "invalid")
+			So(w.runIfChanged(), ShouldBeTrue)
+			flushStds()
+			So(bout.String(), ShouldEqual, "Read '"+conffile+"': 0 lint finding(s), 0 access change(s)\n")
+			So(berr.String(), ShouldEqual, `ERR Parse Error: group or repo expected after line 1 ('invalid')
+Unable to read '`+conffile+`', waiting for the next change
+`)
+			resetStds()
+			touch(conffile, gitoliteconf+"repo module3\n  RW = user5\n")
+			So(w.runIfChanged(), ShouldBeTrue)
+			flushStds()
+			So(bout.String(), ShouldEqual, "Read '"+conffile+`': 0 lint finding(s), 1 access change(s)
++ user5 module3
+`)
+			resetStds()
+		})
+	})
+}
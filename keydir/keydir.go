@@ -0,0 +1,251 @@
+package keydir
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Key is a public key read from a keydir file
+type Key struct {
+	user     string
+	filename string
+	line     string
+	blob     []byte
+}
+
+// Keydir is the set of public keys of a gitolite keydir
+type Keydir struct {
+	keys []*Key
+}
+
+// Report lists inconsistencies between a keydir and the users of a gitolite config
+type Report struct {
+	UsersWithoutKey []string
+	KeysWithoutUser []*Key
+	Duplicates      [][]*Key
+}
+
+// New creates an empty keydir
+func New() *Keydir {
+	return &Keydir{}
+}
+
+// specialUsers are gitolite users which never have keys
+var specialUsers = map[string]bool{"daemon": true, "gitweb": true}
+
+var userFromFilenameRx = regexp.MustCompile(`(@[^.]+)?\.pub$`)
+
+// UserFromFilename returns the user name of a key file, like gitolite does:
+// subdirectories are ignored, 'user@host.pub' is a key for 'user', but
+// 'user@example.com.pub' is a key for 'user@example.com'.
+// It returns an empty string if the file isn't a '.pub' file.
+func UserFromFilename(filename string) string {
+	base := path.Base(filepath.ToSlash(filename))
+	if !strings.HasSuffix(base, ".pub") {
+		return ""
+	}
+	return userFromFilenameRx.ReplaceAllString(base, "")
+}
+
+// Read reads the key files (recursively) of a keydir directory on disk
+func Read(dir string) (*Keydir, error) {
+	kd := New()
+	err := filepath.Walk(dir, func(filename string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() || UserFromFilename(filename) == "" {
+			return nil
+		}
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		relname, _ := filepath.Rel(dir, filename)
+		return kd.Add(filepath.ToSlash(relname), file)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kd, nil
+}
+
+// Add reads a key file, whose name is relative to keydir.
+// Files which are not '.pub' files are ignored.
+// A key file must contain exactly one key.
+func (kd *Keydir) Add(filename string, r io.Reader) error {
+	user := UserFromFilename(filename)
+	if user == "" {
+		return nil
+	}
+	lines := []string{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if len(lines) != 1 {
+		return fmt.Errorf("key file '%v' must contain exactly one key, not %v", filename, len(lines))
+	}
+	fields := strings.Fields(lines[0])
+	if len(fields) < 2 {
+		return fmt.Errorf("key file '%v' doesn't contain a public key", filename)
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return fmt.Errorf("key file '%v' doesn't contain a public key: %v", filename, err)
+	}
+	kd.keys = append(kd.keys, &Key{user: user, filename: filename, line: lines[0], blob: blob})
+	return nil
+}
+
+// Keys returns the keys read, in reading order
+func (kd *Keydir) Keys() []*Key {
+	return kd.keys
+}
+
+// Users returns the sorted names of users having at least one key
+func (kd *Keydir) Users() []string {
+	res := []string{}
+	seen := make(map[string]bool)
+	for _, key := range kd.keys {
+		if !seen[key.user] {
+			seen[key.user] = true
+			res = append(res, key.user)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// KeysForUser returns the keys of a given user
+func (kd *Keydir) KeysForUser(user string) []*Key {
+	res := []*Key{}
+	for _, key := range kd.keys {
+		if key.user == user {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+// Check compares the keydir with the users referenced by a gitolite config:
+// users without keys (who cannot log in), keys of users referenced nowhere,
+// and keys found in several files.
+func (kd *Keydir) Check(users []string) *Report {
+	res := &Report{UsersWithoutKey: []string{}, KeysWithoutUser: []*Key{}, Duplicates: [][]*Key{}}
+	known := make(map[string]bool)
+	for _, user := range users {
+		known[user] = true
+	}
+	keyusers := make(map[string]bool)
+	for _, user := range kd.Users() {
+		keyusers[user] = true
+	}
+	for _, user := range sortedNoDup(users) {
+		if !keyusers[user] && !specialUsers[user] && !strings.HasPrefix(user, "@") {
+			res.UsersWithoutKey = append(res.UsersWithoutKey, user)
+		}
+	}
+	fingerprints := []string{}
+	keysByFingerprint := make(map[string][]*Key)
+	for _, key := range kd.keys {
+		if !known[key.user] {
+			res.KeysWithoutUser = append(res.KeysWithoutUser, key)
+		}
+		fp := key.Fingerprint()
+		if _, ok := keysByFingerprint[fp]; !ok {
+			fingerprints = append(fingerprints, fp)
+		}
+		keysByFingerprint[fp] = append(keysByFingerprint[fp], key)
+	}
+	for _, fp := range fingerprints {
+		if len(keysByFingerprint[fp]) > 1 {
+			res.Duplicates = append(res.Duplicates, keysByFingerprint[fp])
+		}
+	}
+	return res
+}
+
+// authOptions are the ssh options gitolite sets for each of its keys
+const authOptions = "no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty"
+
+// AuthorizedKeys returns the ~/.ssh/authorized_keys block gitolite
+// generates for the keydir: one line per key (sorted by key file name)
+// forcing the gitolite-shell command (glshell) for the key user.
+// Like gitolite, a key with the fingerprint of a key already written is
+// skipped (see Check for the duplicates).
+func (kd *Keydir) AuthorizedKeys(glshell string) string {
+	keys := append([]*Key{}, kd.keys...)
+	sort.Stable(byFilename(keys))
+	res := "# gitolite start\n"
+	written := make(map[string]bool)
+	for _, key := range keys {
+		fp := key.Fingerprint()
+		if written[fp] {
+			continue
+		}
+		written[fp] = true
+		res = res + fmt.Sprintf("command=\"%v %v\",%v %v\n", glshell, key.user, authOptions, key.line)
+	}
+	return res + "# gitolite end\n"
+}
+
+type byFilename []*Key
+
+func (keys byFilename) Len() int           { return len(keys) }
+func (keys byFilename) Swap(i, j int)      { keys[i], keys[j] = keys[j], keys[i] }
+func (keys byFilename) Less(i, j int) bool { return keys[i].filename < keys[j].filename }
+
+// IsEmpty checks if a report has found no inconsistency
+func (rpt *Report) IsEmpty() bool {
+	return len(rpt.UsersWithoutKey) == 0 && len(rpt.KeysWithoutUser) == 0 && len(rpt.Duplicates) == 0
+}
+
+func sortedNoDup(names []string) []string {
+	res := []string{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// User returns the user name the key belongs to
+func (key *Key) User() string {
+	return key.user
+}
+
+// Filename returns the name of the key file, relative to keydir
+func (key *Key) Filename() string {
+	return key.filename
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key, like ssh-keygen -l
+func (key *Key) Fingerprint() string {
+	sum := sha256.Sum256(key.blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// String returns the key line, as read in the key file
+func (key *Key) String() string {
+	return key.line
+}
@@ -0,0 +1,134 @@
+package keydir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// base64 of 'key1', 'key2', 'key3'
+const (
+	key1 = "ssh-rsa a2V5MQ== alice@laptop"
+	key2 = "ssh-rsa a2V5Mg== bob"
+	key3 = "ssh-ed25519 a2V5Mw=="
+)
+
+func TestKeydir(t *testing.T) {
+
+	Convey("User names are deduced from key file names", t, func() {
+		So(UserFromFilename("alice.pub"), ShouldEqual, "alice")
+		So(UserFromFilename("alice@laptop.pub"), ShouldEqual, "alice")
+		So(UserFromFilename("alice@example.com.pub"), ShouldEqual, "alice@example.com")
+		So(UserFromFilename("sub/dir/alice@desktop.pub"), ShouldEqual, "alice")
+		So(UserFromFilename("README"), ShouldEqual, "")
+	})
+
+	Convey("Keys can be added", t, func() {
+		kd := New()
+		So(kd.Add("alice.pub", strings.NewReader(key1+"\n")), ShouldBeNil)
+		So(kd.Add("sub/alice@desktop.pub", strings.NewReader("\n"+key2)), ShouldBeNil)
+		So(kd.Add("README", strings.NewReader("not a key")), ShouldBeNil)
+		So(len(kd.Keys()), ShouldEqual, 2)
+
+		err := kd.Add("bob.pub", strings.NewReader(key1+"\n"+key2))
+		So(err.Error(), ShouldEqual, "key file 'bob.pub' must contain exactly one key, not 2")
+		err = kd.Add("bob.pub", strings.NewReader(""))
+		So(err.Error(), ShouldEqual, "key file 'bob.pub' must contain exactly one key, not 0")
+		err = kd.Add("bob.pub", strings.NewReader("ssh-rsa"))
+		So(err.Error(), ShouldEqual, "key file 'bob.pub' doesn't contain a public key")
+		err = kd.Add("bob.pub", strings.NewReader("ssh-rsa #invalid#"))
+		So(err.Error(), ShouldStartWith, "key file 'bob.pub' doesn't contain a public key: ")
+		So(len(kd.Keys()), ShouldEqual, 2)
+
+		So(kd.Users(), ShouldResemble, []string{"alice"})
+		keys := kd.KeysForUser("alice")
+		So(len(keys), ShouldEqual, 2)
+		So(keys[1].User(), ShouldEqual, "alice")
+		So(keys[1].Filename(), ShouldEqual, "sub/alice@desktop.pub")
+		So(keys[1].String(), ShouldEqual, key2)
+		So(keys[0].Fingerprint(), ShouldEqual, "SHA256:gXQJloeiZiH04s3XzAOz2s7bP7liJVsar9Azyr6DFTA")
+		So(len(kd.KeysForUser("bob")), ShouldEqual, 0)
+	})
+
+	Convey("A keydir can be read from disk", t, func() {
+		tmp, err := ioutil.TempDir("", "keydir")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "sub"), 0755)
+		ioutil.WriteFile(filepath.Join(tmp, "alice.pub"), []byte(key1), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "sub", "bob@host.pub"), []byte(key2), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "sub", "notes.txt"), []byte("notes"), 0644)
+
+		kd, err := Read(tmp)
+		So(err, ShouldBeNil)
+		So(kd.Users(), ShouldResemble, []string{"alice", "bob"})
+		So(kd.KeysForUser("bob")[0].Filename(), ShouldEqual, "sub/bob@host.pub")
+
+		ioutil.WriteFile(filepath.Join(tmp, "bad.pub"), []byte(""), 0644)
+		kd, err = Read(tmp)
+		So(kd, ShouldBeNil)
+		So(err.Error(), ShouldEqual, "key file 'bad.pub' must contain exactly one key, not 0")
+
+		kd, err = Read(filepath.Join(tmp, "unknown"))
+		So(kd, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A keydir can be checked against users", t, func() {
+		kd := New()
+		kd.Add("alice.pub", strings.NewReader(key1))
+		kd.Add("bob.pub", strings.NewReader(key2))
+		kd.Add("carol.pub", strings.NewReader(key3))
+		kd.Add("old/carol2.pub", strings.NewReader(key3))
+
+		rpt := kd.Check([]string{"alice", "alice", "bob", "dave", "daemon", "gitweb", "@all"})
+		So(rpt.IsEmpty(), ShouldBeFalse)
+		So(rpt.UsersWithoutKey, ShouldResemble, []string{"dave"})
+		So(len(rpt.KeysWithoutUser), ShouldEqual, 2)
+		So(rpt.KeysWithoutUser[0].Filename(), ShouldEqual, "carol.pub")
+		So(rpt.KeysWithoutUser[1].Filename(), ShouldEqual, "old/carol2.pub")
+		So(len(rpt.Duplicates), ShouldEqual, 1)
+		So(rpt.Duplicates[0][0].User(), ShouldEqual, "carol")
+		So(rpt.Duplicates[0][1].User(), ShouldEqual, "carol2")
+
+		rpt = kd.Check([]string{"alice", "bob", "carol", "carol2"})
+		So(len(rpt.UsersWithoutKey), ShouldEqual, 0)
+		So(len(rpt.KeysWithoutUser), ShouldEqual, 0)
+		So(len(rpt.Duplicates), ShouldEqual, 1)
+
+		rpt = New().Check([]string{})
+		So(rpt.IsEmpty(), ShouldBeTrue)
+	})
+
+	Convey("A keydir generates the gitolite authorized_keys block", t, func() {
+		kd := New()
+		So(kd.AuthorizedKeys("/home/git/bin/gitolite-shell"), ShouldEqual, `# gitolite start
+# gitolite end
+`)
+		kd.Add("sub/bob.pub", strings.NewReader(key2))
+		kd.Add("alice@laptop.pub", strings.NewReader(key1))
+		kd.Add("alice@example.com.pub", strings.NewReader(key3))
+		So(kd.AuthorizedKeys("/home/git/bin/gitolite-shell"), ShouldEqual, `# gitolite start
+command="/home/git/bin/gitolite-shell alice@example.com",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-ed25519 a2V5Mw==
+command="/home/git/bin/gitolite-shell alice",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa a2V5MQ== alice@laptop
+command="/home/git/bin/gitolite-shell bob",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa a2V5Mg== bob
+# gitolite end
+`)
+		So(kd.Keys()[0].Filename(), ShouldEqual, "sub/bob.pub")
+
+		Convey("A key already written is skipped", func() {
+			kd.Add("zed.pub", strings.NewReader(key1))
+			kd.Add("alice.pub", strings.NewReader(key2))
+			So(kd.AuthorizedKeys("/home/git/bin/gitolite-shell"), ShouldEqual, `# gitolite start
+command="/home/git/bin/gitolite-shell alice",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa a2V5Mg== bob
+command="/home/git/bin/gitolite-shell alice@example.com",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-ed25519 a2V5Mw==
+command="/home/git/bin/gitolite-shell alice",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa a2V5MQ== alice@laptop
+# gitolite end
+`)
+		})
+	})
+}
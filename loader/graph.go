@@ -0,0 +1,137 @@
+package loader
+
+import (
+	"strings"
+
+	"github.com/VonC/gogitolite/gitolite"
+)
+
+// Kinds of graph nodes
+const (
+	UserNode      = "user"
+	UserGroupNode = "usergroup"
+	RepoNode      = "repo"
+	RepoGroupNode = "repogroup"
+	ProjectNode   = "project"
+)
+
+// Kinds of graph edges
+const (
+	// MemberEdge links a member to its group, or a project repo group to its project
+	MemberEdge = "member"
+	// AdminEdge links a project admin to its project
+	AdminEdge = "admin"
+	// RuleEdge links a user (or user group) to a repo (or repo group) a rule applies to
+	RuleEdge = "rule"
+)
+
+// Node is a user, user group, repo, repo group or project of a graph,
+// identified by its kind and name.
+type Node struct {
+	ID   string
+	Kind string
+	Name string
+}
+
+// Edge links two nodes: a membership, or a rule (with its permission and refex)
+type Edge struct {
+	From  string
+	To    string
+	Kind  string
+	Perm  string
+	Refex string
+}
+
+// Graph is the model of a config as nodes and edges, in reading order
+type Graph struct {
+	Nodes []*Node
+	Edges []*Edge
+	ids   map[string]bool
+	gtl   *gitolite.Gitolite
+}
+
+// node returns the id of a node, added to the graph if new: the members of
+// a new group are added with their membership edges.
+func (g *Graph) node(kind, name string) string {
+	id := kind + ":" + name
+	if g.ids[id] {
+		return id
+	}
+	g.ids[id] = true
+	g.Nodes = append(g.Nodes, &Node{ID: id, Kind: kind, Name: name})
+	grp := g.gtl.GetGroup(name)
+	switch {
+	case grp == nil:
+	case kind == UserGroupNode:
+		for _, member := range grp.GetMembers() {
+			g.edge(g.userOrGroupNode(member), id, MemberEdge, "", "")
+		}
+	case kind == RepoGroupNode:
+		for _, member := range grp.GetMembers() {
+			g.edge(g.repoOrGroupNode(member), id, MemberEdge, "", "")
+		}
+	}
+	return id
+}
+
+func (g *Graph) edge(from, to, kind, perm, refex string) {
+	g.Edges = append(g.Edges, &Edge{From: from, To: to, Kind: kind, Perm: perm, Refex: refex})
+}
+
+// Graph returns the users, user groups, repos, repo groups and projects of
+// the config and its subconfs (see Merged), linked by memberships and rules.
+func (conf *Conf) Graph() *Graph {
+	gtl := conf.merged
+	g := &Graph{ids: make(map[string]bool), gtl: gtl}
+	for _, uog := range gtl.GetUsersOrGroups() {
+		if uog.User() != nil {
+			g.node(UserNode, uog.GetName())
+		}
+	}
+	for _, rog := range gtl.GetReposOrGroups() {
+		if rog.Repo() != nil {
+			g.node(RepoNode, rog.GetName())
+		}
+	}
+	for _, uog := range gtl.GetUsersOrGroups() {
+		if uog.Group() != nil {
+			g.node(UserGroupNode, uog.GetName())
+		}
+	}
+	for _, rog := range gtl.GetReposOrGroups() {
+		if rog.Group() != nil {
+			g.node(RepoGroupNode, rog.GetName())
+		}
+	}
+	for _, p := range conf.ProjectManager().Projects() {
+		id := g.node(ProjectNode, p.Name())
+		g.edge(g.node(RepoGroupNode, "@"+p.Name()), id, MemberEdge, "", "")
+		for _, admin := range p.Admins() {
+			g.edge(g.userOrGroupNode(admin.GetName()), id, AdminEdge, "", "")
+		}
+	}
+	for _, config := range gtl.Configs() {
+		for _, rule := range config.Rules() {
+			for _, uog := range rule.GetUsersOrGroups() {
+				for _, rog := range config.GetReposOrGroups() {
+					g.edge(g.userOrGroupNode(uog.GetName()), g.repoOrGroupNode(rog.GetName()), RuleEdge, rule.Access(), rule.Param())
+				}
+			}
+		}
+	}
+	return g
+}
+
+func (g *Graph) userOrGroupNode(name string) string {
+	if strings.HasPrefix(name, "@") {
+		return g.node(UserGroupNode, name)
+	}
+	return g.node(UserNode, name)
+}
+
+func (g *Graph) repoOrGroupNode(name string) string {
+	if strings.HasPrefix(name, "@") {
+		return g.node(RepoGroupNode, name)
+	}
+	return g.node(RepoNode, name)
+}
@@ -0,0 +1,53 @@
+package loader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGraph(t *testing.T) {
+	Convey("Builds the graph of a config and its subconfs", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte("@devs = user4 @leads\n@leads = user5\n"+gitoliteconf), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "project.conf"), []byte("repo @project\n  RW+ master = @devs\n"), 0644)
+		conf, err := newTestLoader(nil, bytes.NewBuffer(nil), bytes.NewBuffer(nil)).Load(conffile)
+		So(err, ShouldBeNil)
+
+		g := conf.Graph()
+		kinds := make(map[string]string)
+		for _, node := range g.Nodes {
+			kinds[node.ID] = node.Kind
+		}
+		So(kinds["user:user1"], ShouldEqual, UserNode)
+		So(kinds["user:user5"], ShouldEqual, UserNode)
+		So(kinds["usergroup:@devs"], ShouldEqual, UserGroupNode)
+		So(kinds["usergroup:@leads"], ShouldEqual, UserGroupNode)
+		So(kinds["repo:module2"], ShouldEqual, RepoNode)
+		So(kinds["repogroup:@project"], ShouldEqual, RepoGroupNode)
+		So(kinds["project:project"], ShouldEqual, ProjectNode)
+		So(len(kinds), ShouldEqual, len(g.Nodes))
+
+		edges := []string{}
+		for _, edge := range g.Edges {
+			edges = append(edges, edge.From+" "+edge.Kind+" "+edge.To+" "+edge.Perm+" "+edge.Refex)
+		}
+		So(edges, ShouldContain, "user:user4 member usergroup:@devs  ")
+		So(edges, ShouldContain, "usergroup:@leads member usergroup:@devs  ")
+		So(edges, ShouldContain, "user:user5 member usergroup:@leads  ")
+		So(edges, ShouldContain, "repo:module1 member repogroup:@project  ")
+		So(edges, ShouldContain, "repogroup:@project member project:project  ")
+		So(edges, ShouldContain, "user:projectowner1 admin project:project  ")
+		So(edges, ShouldContain, "user:user2 rule repo:module2 RW ")
+		So(edges, ShouldContain, "user:projectowner1 rule repo:gitolite-admin - VREF/NAME/")
+		So(edges[len(edges)-1], ShouldEqual, "usergroup:@devs rule repogroup:@project RW+ master")
+	})
+}
@@ -0,0 +1,543 @@
+package loader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/VonC/gogitolite/gitolite"
+	"github.com/VonC/gogitolite/gitrepo"
+	"github.com/VonC/gogitolite/keydir"
+	"github.com/VonC/gogitolite/project"
+	"github.com/VonC/gogitolite/reader"
+)
+
+// Loader reads a gitolite config and the subconfs it includes,
+// from disk, or from the tree of a gitolite-admin commit.
+// A loader can be used for several loads.
+type Loader struct {
+	tree    *gitrepo.Tree
+	rc      *gitolite.RC
+	verbose bool
+	sout    io.Writer
+	serr    io.Writer
+	jobs    int
+}
+
+// Conf is a gitolite config loaded with its subconfs
+type Conf struct {
+	ld                  *Loader
+	filename            string
+	gtl                 *gitolite.Gitolite
+	merged              *gitolite.Gitolite
+	subconfs            map[string]*gitolite.Gitolite
+	usersToReposOrGroup map[string][]gitolite.RepoOrGroup
+	// usersToRogNames indexes the names of usersToReposOrGroup
+	usersToRogNames map[string]map[string]bool
+	ignored         []error
+	// files are the files read, the config then its subconf files, ignored or not
+	files []string
+	// globDirs are the directories searched for subconf files (on disk)
+	globDirs []string
+}
+
+// Access is a line of the audit: a user (or user group, or role) with
+// read access to a repo (or repo group), and the kind of user:
+// "user", "role" or "system" (groups and technical accounts)
+type Access struct {
+	User string
+	Repo string
+	Type string
+}
+
+// New creates a loader reading files from tree, or from disk if tree is nil.
+// rc (can be nil) is the gitolite.rc the configs are checked against.
+func New(tree *gitrepo.Tree, rc *gitolite.RC) *Loader {
+	return &Loader{tree: tree, rc: rc, sout: os.Stdout, serr: os.Stderr, jobs: runtime.NumCPU()}
+}
+
+// SetJobs sets how many subconf files the loader reads concurrently
+// (default: the number of CPUs, 1 to read them one after the other).
+// The result is the same whatever the number of jobs.
+func (ld *Loader) SetJobs(jobs int) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	ld.jobs = jobs
+}
+
+// SetVerbose makes the loader display the files it reads
+func (ld *Loader) SetVerbose(verbose bool) {
+	ld.verbose = verbose
+}
+
+// SetOutput sets where the loader displays the files it reads (if verbose),
+// and the errors it detects (default: stdout and stderr)
+func (ld *Loader) SetOutput(sout, serr io.Writer) {
+	ld.sout, ld.serr = sout, serr
+}
+
+// Load reads a config, then the subconfs it includes (nested subconfs included).
+// It returns an error if the config itself can't be read: subconfs which can't
+// be read are ignored (see Conf.Ignored).
+func (ld *Loader) Load(filename string) (*Conf, error) {
+	conf := &Conf{ld: ld,
+		filename:            filename,
+		files:               []string{filename},
+		subconfs:            make(map[string]*gitolite.Gitolite),
+		usersToReposOrGroup: make(map[string][]gitolite.RepoOrGroup),
+		usersToRogNames:     make(map[string]map[string]bool),
+	}
+	if ld.verbose {
+		fmt.Fprintf(ld.sout, "Read file '%v'\n", filename)
+	}
+	var err error
+	if conf.gtl, err = conf.ld.read(filename); err != nil {
+		return nil, err
+	}
+	conf.processSubconfsOf(conf.gtl)
+	conf.merged = conf.gtl.Merged()
+	conf.index(conf.merged)
+	return conf, nil
+}
+
+func (ld *Loader) read(filename string) (*gitolite.Gitolite, error) {
+	gtl, err := ld.parse(filename, nil, "")
+	if err != nil {
+		fmt.Fprintf(ld.serr, "ERR %v\n", err.Error())
+		return nil, err
+	}
+	return gtl, nil
+}
+
+// parse reads a config, or the subconf of parent named subconf, without
+// displaying anything nor modifying parent (see gitolite.MarkParentGroups):
+// subconfs are parsed concurrently. The subconf is returned even if it can't
+// be fully read, for the groups of parent it marks.
+func (ld *Loader) parse(filename string, parent *gitolite.Gitolite, subconf string) (*gitolite.Gitolite, error) {
+	var r io.Reader
+	if ld.tree != nil {
+		fr, err := ld.tree.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		r = fr
+	} else {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = bufio.NewReader(f)
+	}
+	if parent == nil {
+		return reader.ReadWithRC(r, ld.rc)
+	}
+	return reader.ParseSubconf(r, parent, subconf)
+}
+
+// Filename returns the file the config has been read from
+func (conf *Conf) Filename() string {
+	return conf.filename
+}
+
+// Tree returns the git tree the config has been read from, nil if read from disk
+func (conf *Conf) Tree() *gitrepo.Tree {
+	return conf.ld.tree
+}
+
+// Gitolite returns the main config (its subconfs are its children)
+func (conf *Conf) Gitolite() *gitolite.Gitolite {
+	return conf.gtl
+}
+
+// Merged returns the main config with its subconfs inlined at their subconf
+// line (see gitolite.Merged): the rules gitolite applies, in order.
+func (conf *Conf) Merged() *gitolite.Gitolite {
+	return conf.merged
+}
+
+// Subconfs returns the subconfs read, by file name
+func (conf *Conf) Subconfs() map[string]*gitolite.Gitolite {
+	return conf.subconfs
+}
+
+// Files returns the files read: the config, then its subconf files
+// (including the ones ignored), in reading order
+func (conf *Conf) Files() []string {
+	return conf.files
+}
+
+// GlobDirs returns the directories searched for the files of the subconf
+// lines, when read from disk: adding a first file there changes the config.
+func (conf *Conf) GlobDirs() []string {
+	return conf.globDirs
+}
+
+// Ignored returns why subconf files, or some of their rules, have been ignored
+func (conf *Conf) Ignored() []error {
+	return conf.ignored
+}
+
+// ProjectManager returns the projects declared by the config and its subconfs
+func (conf *Conf) ProjectManager() *project.Manager {
+	return project.NewManager(conf.gtl, conf.subconfs)
+}
+
+func addRogNoDup(rog gitolite.RepoOrGroup, rogs []gitolite.RepoOrGroup, seen map[string]bool) []gitolite.RepoOrGroup {
+	res := rogs
+	if !seen[rog.GetName()] {
+		seen[rog.GetName()] = true
+		res = append(rogs, rog)
+	}
+	return res
+}
+
+func (conf *Conf) updateUsersToRepos(uog gitolite.UserOrGroup, config *gitolite.Config) {
+	var rogs []gitolite.RepoOrGroup
+	var ok bool
+	if rogs, ok = conf.usersToReposOrGroup[uog.GetName()]; !ok {
+		rogs = []gitolite.RepoOrGroup{}
+		conf.usersToRogNames[uog.GetName()] = make(map[string]bool)
+	}
+	seen := conf.usersToRogNames[uog.GetName()]
+	for _, cfgrog := range config.GetReposOrGroups() {
+		rogs = addRogNoDup(cfgrog, rogs, seen)
+		if cfgrog.Group() != nil {
+			cfggrp := cfgrog.Group()
+			repos := cfggrp.GetAllRepos()
+			for _, repo := range repos {
+				rogs = addRogNoDup(repo, rogs, seen)
+			}
+		}
+	}
+	conf.usersToReposOrGroup[uog.GetName()] = rogs
+}
+
+// index records which repos the users of the merged config can read
+func (conf *Conf) index(merged *gitolite.Gitolite) {
+	for _, config := range merged.Configs() {
+		for _, rule := range config.Rules() {
+			if strings.Contains(rule.Access(), "R") {
+				for _, uog := range merged.RuleUsers(rule) {
+					conf.updateUsersToRepos(uog, config)
+				}
+			}
+		}
+	}
+}
+
+// subconfFile is a file included by a subconf line, and the result of its parsing
+type subconfFile struct {
+	filename string
+	relname  string
+	name     string
+	subconf  *gitolite.Subconf
+	gtl      *gitolite.Gitolite
+	err      error
+}
+
+// processSubconfsOf reads the files included by the subconf lines of a
+// config (the main one, or a subconf for nested subconfs): they are
+// parsed concurrently, then processed line after line.
+func (conf *Conf) processSubconfsOf(gtl *gitolite.Gitolite) {
+	declaring := conf.filename
+	if gtl.Path() != "" {
+		declaring = gtl.Path()
+	}
+	files := []*subconfFile{}
+	for _, subconf := range gtl.Subconfs() {
+		for _, filename := range conf.subconfFiles(declaring, subconf) {
+			relname := filepath.ToSlash(filename)
+			if rel, err := filepath.Rel(filepath.Dir(declaring), filename); err == nil {
+				relname = filepath.ToSlash(rel)
+			}
+			name := subconf.Name()
+			if name == "" {
+				name = subconfName(relname)
+			}
+			files = append(files, &subconfFile{filename: filename, relname: relname, name: name, subconf: subconf})
+		}
+	}
+	conf.parseSubconfs(gtl, files)
+	for _, file := range files {
+		conf.processSubconf(gtl, file)
+	}
+}
+
+// isRead checks if a file has already been read, as the main config or a subconf
+func (conf *Conf) isRead(filename string) bool {
+	_, seen := conf.subconfs[filename]
+	return seen || filename == conf.filename
+}
+
+// parseSubconfs parses subconf files of parent not read yet, with at most
+// as many files parsed at the same time as the loader jobs.
+func (conf *Conf) parseSubconfs(parent *gitolite.Gitolite, files []*subconfFile) {
+	jobs := make(chan bool, conf.ld.jobs)
+	var wg sync.WaitGroup
+	for _, file := range files {
+		if conf.isRead(file.filename) {
+			continue
+		}
+		wg.Add(1)
+		jobs <- true
+		go func(file *subconfFile) {
+			defer wg.Done()
+			file.gtl, file.err = conf.ld.parse(file.filename, parent, file.name)
+			<-jobs
+		}(file)
+	}
+	wg.Wait()
+}
+
+// subconfFiles returns the sorted files matching the glob pattern of a
+// subconf line, relative to the directory of the file declaring it.
+func (conf *Conf) subconfFiles(declaring string, subconf *gitolite.Subconf) []string {
+	res := []string{}
+	if tree := conf.ld.tree; tree != nil {
+		dir := path.Dir(declaring)
+		if dir == "." {
+			dir = ""
+		}
+		for _, name := range tree.Files(dir) {
+			if subconf.MatchString(strings.TrimPrefix(name, dir+"/")) {
+				res = append(res, name)
+			}
+		}
+	} else {
+		pattern := filepath.Join(filepath.Dir(declaring), filepath.FromSlash(subconf.Pattern()))
+		conf.addGlobDir(pattern)
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			if f, err := os.Stat(match); err == nil && !f.IsDir() {
+				res = append(res, match)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// addGlobDir records the deepest directory of a glob pattern without
+// wildcard, once.
+func (conf *Conf) addGlobDir(pattern string) {
+	dir := filepath.Dir(pattern)
+	for strings.ContainsAny(dir, "*?[") {
+		dir = filepath.Dir(dir)
+	}
+	for _, d := range conf.globDirs {
+		if d == dir {
+			return
+		}
+	}
+	conf.globDirs = append(conf.globDirs, dir)
+}
+
+// processSubconf processes a file included by a subconf line of parent,
+// then reads the subconfs it includes itself. A file is read only once:
+// a file parsed while it had been read since is ignored.
+func (conf *Conf) processSubconf(parent *gitolite.Gitolite, file *subconfFile) {
+	if conf.isRead(file.filename) {
+		return
+	}
+	relname, filename := file.relname, file.filename
+	conf.files = append(conf.files, filename)
+	if conf.ld.verbose {
+		fmt.Fprintf(conf.ld.sout, "Visited: %s %s\n", relname, filename)
+	}
+	subgtl, err := file.gtl, file.err
+	if subgtl != nil {
+		subgtl.MarkParentGroups()
+	}
+	if err != nil {
+		fmt.Fprintf(conf.ld.serr, "ERR %v\n", err.Error())
+		fmt.Fprintf(conf.ld.serr, "Ignore subconf file: %s %s because of err '%v'\n", relname, filename, err)
+		conf.ignored = append(conf.ignored, fmt.Errorf("subconf file '%v': %v", relname, err))
+		return
+	}
+	for _, violation := range subgtl.ScopeViolations() {
+		fmt.Fprintf(conf.ld.serr, "Ignore access in subconf file: %s %s because of '%v'\n", relname, filename, violation)
+		conf.ignored = append(conf.ignored, fmt.Errorf("subconf file '%v': %v", relname, violation))
+	}
+	parent.AddChild(subgtl, filename, file.subconf)
+	conf.subconfs[filename] = subgtl
+	conf.processSubconfsOf(subgtl)
+}
+
+// subconfName returns the name of a subconf, like gitolite does:
+// its file name without directory nor extension.
+func subconfName(relname string) string {
+	base := path.Base(relname)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// Check returns the inconsistencies of a config read with its subconfs:
+// subconf files which couldn't be read, and ignored project declarations.
+func (conf *Conf) Check() []error {
+	errs := append([]error{}, conf.ignored...)
+	for _, d := range conf.ProjectManager().Diagnostics() {
+		errs = append(errs, d)
+	}
+	return errs
+}
+
+// ReposOrGroups returns the repos and repo groups (with the repos of those
+// groups) a user, user group or role has read access to, in reading order.
+func (conf *Conf) ReposOrGroups(username string) []gitolite.RepoOrGroup {
+	return conf.usersToReposOrGroup[username]
+}
+
+// Audit returns who has read access to what, sorted by user
+func (conf *Conf) Audit() []*Access {
+	names := make([]string, 0, len(conf.usersToReposOrGroup))
+	for username := range conf.usersToReposOrGroup {
+		names = append(names, username)
+	}
+	sort.Strings(names)
+	res := []*Access{}
+	for _, username := range names {
+		if username == "" {
+			continue
+		}
+		typeuser := conf.userType(username)
+		for _, repo := range conf.usersToReposOrGroup[username] {
+			res = append(res, &Access{User: username, Repo: repo.GetName(), Type: typeuser})
+		}
+	}
+	return res
+}
+
+func (conf *Conf) userType(username string) string {
+	switch {
+	case conf.gtl.IsRole(username):
+		return "role"
+	case strings.HasPrefix(username, "@"),
+		strings.HasPrefix(username, "proj"),
+		strings.HasPrefix(username, "HB"),
+		strings.Contains(username, "dmin"):
+		return "system"
+	}
+	return "user"
+}
+
+// Accesses returns, for each user, the set of repos (or repo groups) names
+// the user can access, as collected by the audit.
+func (conf *Conf) Accesses() map[string]map[string]bool {
+	res := make(map[string]map[string]bool)
+	for username, rogs := range conf.usersToReposOrGroup {
+		if username == "" {
+			continue
+		}
+		reponames := make(map[string]bool)
+		for _, rog := range rogs {
+			reponames[rog.GetName()] = true
+		}
+		res[username] = reponames
+	}
+	return res
+}
+
+// gitolites returns the main config and its subconfs
+func (conf *Conf) gitolites() []*gitolite.Gitolite {
+	res := []*gitolite.Gitolite{conf.gtl}
+	for _, subgtl := range conf.subconfs {
+		res = append(res, subgtl)
+	}
+	return res
+}
+
+// Users returns the sorted names of all users (roles excluded)
+// referenced by the config and its subconfs
+func (conf *Conf) Users() []string {
+	res := []string{}
+	for _, gtl := range conf.gitolites() {
+		for _, uog := range gtl.GetUsersOrGroups() {
+			if uog.User() != nil && !gtl.IsRole(uog.GetName()) {
+				res = append(res, uog.GetName())
+			}
+		}
+	}
+	return sortedNoDup(res)
+}
+
+// Repos returns the sorted names of the repos declared in the config and its subconfs
+func (conf *Conf) Repos() []string {
+	res := []string{}
+	for _, gtl := range conf.gitolites() {
+		for _, rog := range gtl.GetReposOrGroups() {
+			if rog.Repo() != nil {
+				res = append(res, rog.GetName())
+			}
+		}
+	}
+	return sortedNoDup(res)
+}
+
+// WhoCanAccess returns the sorted names of the users with access to a repo
+func (conf *Conf) WhoCanAccess(reponame string) []string {
+	res := []string{}
+	for username, reponames := range conf.Accesses() {
+		if reponames[reponame] {
+			res = append(res, username)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// WhatCanAccess returns the sorted names of the repos (or repo groups) a user can access
+func (conf *Conf) WhatCanAccess(username string) []string {
+	res := []string{}
+	for reponame := range conf.Accesses()[username] {
+		res = append(res, reponame)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Keydir reads the public keys of dir, or, if dir is empty,
+// of the keydir next to the conf directory (in the git tree or on disk).
+func (conf *Conf) Keydir(dir string) (*keydir.Keydir, error) {
+	tree := conf.ld.tree
+	if tree == nil {
+		if dir == "" {
+			dir = filepath.Join(filepath.Dir(filepath.Dir(conf.filename)), "keydir")
+		}
+		return keydir.Read(dir)
+	}
+	if dir == "" {
+		dir = path.Join(path.Dir(path.Dir(conf.filename)), "keydir")
+	}
+	kd := keydir.New()
+	for _, name := range tree.Files(dir) {
+		r, err := tree.Open(name)
+		if err == nil {
+			err = kd.Add(strings.TrimPrefix(name, strings.Trim(dir, "/")+"/"), r)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return kd, nil
+}
+
+func sortedNoDup(names []string) []string {
+	res := []string{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
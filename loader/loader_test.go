@@ -0,0 +1,382 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/VonC/gogitolite/gitrepo"
+	"github.com/VonC/gogitolite/reader"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const gitoliteconf = `
+@project = module1 module2
+@almadmins = admin1 admin2
+
+repo gitolite-admin
+  RW+     =   gitoliteadm @almadmins
+  RW      =   projectowner1 projectowner2
+  RW VREF/NAME/conf/subs/project = projectowner1 projectowner2
+  -  VREF/NAME/                  = projectowner1 projectowner2
+
+repo module1
+  RW = user1 user2
+repo module2
+  RW = user2
+repo @project
+  RW = pu1
+subconf "subs/*.conf"
+`
+
+func git(dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@test"}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		panic(string(out))
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func newTestLoader(tree *gitrepo.Tree, bout, berr *bytes.Buffer) *Loader {
+	ld := New(tree, nil)
+	ld.SetOutput(bout, berr)
+	return ld
+}
+
+func TestLoader(t *testing.T) {
+	Convey("Loads a config and its subconfs", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		subconf := filepath.Join(tmp, "conf", "subs", "project.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+		ioutil.WriteFile(subconf, []byte("repo @project\n  RW = user3\n"), 0644)
+		bout, berr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+		ld := newTestLoader(nil, bout, berr)
+
+		Convey("Error if unknown file", func() {
+			conf, err := ld.Load(filepath.Join(tmp, "unknown.conf"))
+			So(conf, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldStartWith, "ERR open ")
+		})
+
+		Convey("Error if bad config content", func() {
+			ioutil.WriteFile(conffile, []byte("test"), 0644)
+			conf, err := ld.Load(conffile)
+			So(conf, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			So(berr.String(), ShouldEqual, "ERR Parse Error: group or repo expected after line 1 ('test')\n")
+		})
+
+		Convey("Displays the files read if verbose", func() {
+			ld.SetVerbose(true)
+			conf, err := ld.Load(conffile)
+			So(err, ShouldBeNil)
+			So(conf.Filename(), ShouldEqual, conffile)
+			So(conf.Tree(), ShouldBeNil)
+			So(bout.String(), ShouldEqual, "Read file '"+conffile+"'\nVisited: subs/project.conf "+subconf+"\n")
+			So(berr.String(), ShouldEqual, "")
+		})
+
+		Convey("Collects accesses of the config and its subconfs", func() {
+			conf, err := ld.Load(conffile)
+			So(err, ShouldBeNil)
+			So(len(conf.Subconfs()), ShouldEqual, 1)
+			So(conf.Subconfs()[subconf].SubconfName(), ShouldEqual, "project")
+			So(conf.Gitolite().Children()[0], ShouldEqual, conf.Subconfs()[subconf])
+			So(len(conf.ReposOrGroups("user3")), ShouldEqual, 3)
+			So(conf.Repos(), ShouldResemble, []string{"gitolite-admin", "module1", "module2"})
+			So(conf.Users(), ShouldResemble, []string{"admin1", "admin2", "gitoliteadm", "projectowner1", "projectowner2", "pu1", "user1", "user2", "user3"})
+			So(conf.WhoCanAccess("module2"), ShouldResemble, []string{"pu1", "user2", "user3"})
+			So(conf.WhatCanAccess("user3"), ShouldResemble, []string{"@project", "module1", "module2"})
+			So(conf.Accesses()["user1"], ShouldResemble, map[string]bool{"module1": true})
+			So(conf.ProjectManager().NbProjects(), ShouldEqual, 1)
+			So(len(conf.Check()), ShouldEqual, 0)
+
+			audit := conf.Audit()
+			So(len(audit), ShouldEqual, 14)
+			So(*audit[0], ShouldResemble, Access{User: "admin1", Repo: "gitolite-admin", Type: "system"})
+			So(*audit[len(audit)-1], ShouldResemble, Access{User: "user3", Repo: "module2", Type: "user"})
+		})
+
+		Convey("Ignores subconfs which can't be read", func() {
+			ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "projectbad.conf"), []byte("repo\n"), 0644)
+			conf, err := ld.Load(conffile)
+			So(err, ShouldBeNil)
+			So(len(conf.Subconfs()), ShouldEqual, 1)
+			So(berr.String(), ShouldEqual, "ERR Parse Error: group or repo expected after line 1 ('repo')\n"+
+				"Ignore subconf file: subs/projectbad.conf "+filepath.Join(tmp, "conf", "subs", "projectbad.conf")+" because of err 'Parse Error: group or repo expected after line 1 ('repo')'\n")
+			So(len(conf.Ignored()), ShouldEqual, 1)
+			So(conf.Check()[0].Error(), ShouldEqual, "subconf file 'subs/projectbad.conf': Parse Error: group or repo expected after line 1 ('repo')")
+		})
+
+		Convey("Can be used for several loads", func() {
+			conf1, err := ld.Load(conffile)
+			So(err, ShouldBeNil)
+			ioutil.WriteFile(subconf, []byte("repo @project\n  RW = user4\n"), 0644)
+			conf2, err := ld.Load(conffile)
+			So(err, ShouldBeNil)
+			So(conf1.WhoCanAccess("module2"), ShouldResemble, []string{"pu1", "user2", "user3"})
+			So(conf2.WhoCanAccess("module2"), ShouldResemble, []string{"pu1", "user2", "user4"})
+		})
+
+		Convey("Checks configs against the rc", func() {
+			rc, err := reader.ReadRC(strings.NewReader("%RC = (\n  GIT_CONFIG_KEYS => 'hooks\\..*',\n  ROLES => { READERS => 1, },\n);\n"))
+			So(err, ShouldBeNil)
+			ioutil.WriteFile(conffile, []byte("repo gitolite-admin\n  RW+ = admin\nrepo foo\n  RW = READERS alice\n  config hooks.mailinglist = foo@example.com\n"), 0644)
+			ld = New(nil, rc)
+			ld.SetOutput(bout, berr)
+			conf, err := ld.Load(conffile)
+			So(err, ShouldBeNil)
+			So(conf.Audit()[0].Type, ShouldEqual, "role")
+			So(conf.Users(), ShouldResemble, []string{"admin", "alice"})
+
+			ld = newTestLoader(nil, bout, berr)
+			ld.rc, _ = reader.ReadRC(strings.NewReader("%RC = ( UMASK => 0077 );\n"))
+			conf, err = ld.Load(conffile)
+			So(conf, ShouldBeNil)
+			So(berr.String(), ShouldEqual, "ERR Parse Error: git config 'hooks.mailinglist' not allowed, check GIT_CONFIG_KEYS in the rc file, line 5 ('config hooks.mailinglist = foo@example.com')\n")
+		})
+
+		Convey("Reads conf, subconfs and keydir from a git tree", func() {
+			os.MkdirAll(filepath.Join(tmp, "keydir"), 0755)
+			ioutil.WriteFile(filepath.Join(tmp, "keydir", "user1.pub"), []byte("ssh-rsa dXNlcjE= user1"), 0644)
+			git(tmp, "init", "-q", "-b", "master")
+			git(tmp, "add", "-A")
+			git(tmp, "commit", "-q", "-m", "conf")
+			repo, err := gitrepo.Open(tmp)
+			So(err, ShouldBeNil)
+			tree, err := repo.Tree("HEAD")
+			So(err, ShouldBeNil)
+			conf, err := newTestLoader(tree, bout, berr).Load("conf/gitolite.conf")
+			So(err, ShouldBeNil)
+			So(conf.Tree(), ShouldEqual, tree)
+			So(len(conf.Subconfs()), ShouldEqual, 1)
+			So(conf.Subconfs()["conf/subs/project.conf"], ShouldNotBeNil)
+			So(len(conf.ReposOrGroups("user3")), ShouldEqual, 3)
+			So(berr.String(), ShouldEqual, "")
+			kd, err := conf.Keydir("")
+			So(err, ShouldBeNil)
+			So(kd.Users(), ShouldResemble, []string{"user1"})
+		})
+	})
+}
+
+func TestSubconfs(t *testing.T) {
+	Convey("Enforces subconf name scoping", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "project.conf"), []byte("@devs = user3\nrepo module1 module3\n  RW = @devs\n"), 0644)
+		bout, berr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+		conf, err := newTestLoader(nil, bout, berr).Load(conffile)
+		So(err, ShouldBeNil)
+		So(berr.String(), ShouldEqual, "Ignore access in subconf file: subs/project.conf "+filepath.Join(tmp, "conf", "subs", "project.conf")+
+			" because of 'subconf 'project' attempting to set access for 'module3' at line 2 ('repo module1 module3')'\n")
+		So(len(conf.ReposOrGroups("@project.devs")), ShouldEqual, 0)
+		So(conf.ReposOrGroups("user3")[0].GetName(), ShouldEqual, "module1")
+		So(len(conf.ReposOrGroups("user3")), ShouldEqual, 1)
+		errs := conf.Check()
+		So(len(errs), ShouldEqual, 1)
+		So(errs[0].Error(), ShouldEqual, "subconf file 'subs/project.conf': subconf 'project' attempting to set access for 'module3' at line 2 ('repo module1 module3')")
+	})
+
+	Convey("Reads named and nested subconfs", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		os.MkdirAll(filepath.Join(tmp, "conf", "teams"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf+"@team = module2\nsubconf team = \"teams/main.conf\"\nsubconf \"subs/project.conf\"\n"), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "project.conf"), []byte("repo @project\n  RW = user3\n"), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "teams", "main.conf"), []byte("subconf \"*.conf\"\nrepo module2\n  RW = user4\n"), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "teams", "module2.conf"), []byte("repo module2\n  R = user5\n"), 0644)
+		bout, berr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+		conf, err := newTestLoader(nil, bout, berr).Load(conffile)
+		So(err, ShouldBeNil)
+		So(berr.String(), ShouldEqual, "")
+		gtl := conf.Gitolite()
+		So(len(conf.Subconfs()), ShouldEqual, 3)
+		So(len(gtl.Children()), ShouldEqual, 2)
+		So(gtl.Children()[0].SubconfName(), ShouldEqual, "project")
+		So(gtl.Children()[1].SubconfName(), ShouldEqual, "team")
+		team := conf.Subconfs()[filepath.Join(tmp, "conf", "teams", "main.conf")]
+		So(team.SubconfName(), ShouldEqual, "team")
+		So(team.Parent(), ShouldEqual, gtl)
+		So(len(team.Children()), ShouldEqual, 1)
+		So(team.Children()[0].SubconfName(), ShouldEqual, "module2")
+		So(team.Children()[0].Path(), ShouldEqual, filepath.Join(tmp, "conf", "teams", "module2.conf"))
+		So(team.Children()[0].IncludedBy().Pattern(), ShouldEqual, "*.conf")
+		So(team.IncludedBy().Line(), ShouldEqual, 19)
+		So(conf.ReposOrGroups("user4")[0].GetName(), ShouldEqual, "module2")
+		So(conf.ReposOrGroups("user5")[0].GetName(), ShouldEqual, "module2")
+		So(len(conf.Check()), ShouldEqual, 0)
+		So(conf.Files(), ShouldResemble, []string{conffile,
+			filepath.Join(tmp, "conf", "subs", "project.conf"),
+			filepath.Join(tmp, "conf", "teams", "main.conf"),
+			filepath.Join(tmp, "conf", "teams", "module2.conf")})
+		So(conf.GlobDirs(), ShouldResemble, []string{filepath.Join(tmp, "conf", "subs"), filepath.Join(tmp, "conf", "teams")})
+	})
+
+	Convey("Merges subconfs at their subconf line", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte("@devs = user6 user7\n"+gitoliteconf+"repo module1\n  - = user6\n"), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "project.conf"), []byte("repo module1\n  RW+ = @devs\n"), 0644)
+		bout, berr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+		conf, err := newTestLoader(nil, bout, berr).Load(conffile)
+		So(err, ShouldBeNil)
+		So(berr.String(), ShouldEqual, "")
+		So(conf.Gitolite().CheckAccess("user6", "module1", "refs/heads/master", "+"), ShouldNotBeNil)
+		So(conf.Merged().CheckAccess("user6", "module1", "refs/heads/master", "+"), ShouldBeNil)
+		So(conf.Merged().CheckAccess("user7", "module1", "refs/heads/master", "+"), ShouldBeNil)
+		So(conf.WhoCanAccess("module1"), ShouldContain, "user6")
+		So(conf.WhoCanAccess("module1"), ShouldContain, "user7")
+		So(conf.WhoCanAccess("module1"), ShouldNotContain, "@devs")
+	})
+
+	Convey("Reads subconfs concurrently, with the same result", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		conffile := genConf(tmp, 600, 90)
+		subs := filepath.Join(tmp, "conf", "subs")
+		ioutil.WriteFile(filepath.Join(subs, "p1.conf"), []byte("subconf \"../nested/*.conf\"\nrepo @p1\n    RW = o1\nrepo r1 r250\n    R = u1\n"), 0644)
+		ioutil.WriteFile(filepath.Join(subs, "p3.conf"), []byte("repo @p3\n    RW = o3\nrepo\n"), 0644)
+		os.MkdirAll(filepath.Join(tmp, "conf", "nested"), 0755)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "nested", "n1.conf"), []byte("repo r1\n    R = u2\n"), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "nested", "p2.conf"), []byte("repo @p2\n    R = u3\n"), 0644)
+
+		load := func(jobs int) (string, string) {
+			bout, berr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+			ld := newTestLoader(nil, bout, berr)
+			ld.SetVerbose(true)
+			ld.SetJobs(jobs)
+			conf, err := ld.Load(conffile)
+			So(err, ShouldBeNil)
+			res := bytes.NewBufferString(conf.Gitolite().String())
+			filenames := []string{}
+			for filename := range conf.Subconfs() {
+				filenames = append(filenames, filename)
+			}
+			sort.Strings(filenames)
+			for _, filename := range filenames {
+				gtl := conf.Subconfs()[filename]
+				res.WriteString(gtl.Path() + "\n" + gtl.String() + gtl.Print())
+			}
+			for _, access := range conf.Audit() {
+				fmt.Fprintf(res, "%v,%v,%v\n", access.User, access.Repo, access.Type)
+			}
+			for _, err := range conf.Check() {
+				res.WriteString(err.Error() + "\n")
+			}
+			return res.String(), bout.String() + berr.String()
+		}
+		res, out := load(1)
+		So(out, ShouldContainSubstring, "Visited: ../nested/n1.conf")
+		So(out, ShouldContainSubstring, "Ignore subconf file: subs/p3.conf")
+		So(out, ShouldContainSubstring, "Ignore access in subconf file: subs/p1.conf")
+		So(strings.Index(out, "Visited: ../nested/p2.conf"), ShouldBeLessThan, strings.Index(out, "Visited: subs/p2.conf"))
+		for _, jobs := range []int{0, 2, 8, 64} {
+			pres, pout := load(jobs)
+			So(pres, ShouldEqual, res)
+			So(pout, ShouldEqual, out)
+		}
+	})
+}
+
+// genConf writes in dir a config with nbRepos repos, in projects of 100
+// repos (each with its subconf, and its owner), and nbUsers users in teams
+// of 30: each repo has its own config, with rules for a team and two users.
+// It returns the config file.
+func genConf(dir string, nbRepos, nbUsers int) string {
+	var b bytes.Buffer
+	nbProjects := nbRepos / 100
+	nbTeams := nbUsers / 30
+	os.MkdirAll(filepath.Join(dir, "conf", "subs"), 0755)
+	b.WriteString("repo gitolite-admin\n    RW+ = admin\n")
+	for p := 0; p < nbProjects; p++ {
+		fmt.Fprintf(&b, "    RW = o%d\n    RW VREF/NAME/conf/subs/p%d = o%d\n    - VREF/NAME/ = o%d\n", p, p, p, p)
+		sub := fmt.Sprintf("repo @p%d\n    RW = o%d\n    R = @team%d\n", p, p, p%nbTeams)
+		ioutil.WriteFile(filepath.Join(dir, "conf", "subs", fmt.Sprintf("p%d.conf", p)), []byte(sub), 0644)
+	}
+	for t := 0; t < nbTeams; t++ {
+		fmt.Fprintf(&b, "@team%d =", t)
+		for u := t * 30; u < (t+1)*30; u++ {
+			fmt.Fprintf(&b, " u%d", u)
+		}
+		b.WriteString("\n")
+	}
+	for p := 0; p < nbProjects; p++ {
+		fmt.Fprintf(&b, "@p%d =", p)
+		for r := p * 100; r < (p+1)*100; r++ {
+			fmt.Fprintf(&b, " r%d", r)
+		}
+		b.WriteString("\n")
+	}
+	for r := 0; r < nbRepos; r++ {
+		fmt.Fprintf(&b, "repo r%d\n    RW+ = @team%d\n    RW = u%d\n    R = u%d\n", r, r%nbTeams, r%nbUsers, (r*7)%nbUsers)
+	}
+	b.WriteString("subconf \"subs/*.conf\"\n")
+	conffile := filepath.Join(dir, "conf", "gitolite.conf")
+	ioutil.WriteFile(conffile, b.Bytes(), 0644)
+	return conffile
+}
+
+func TestLoadLarge(t *testing.T) {
+	Convey("Loads a large config", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		conf, err := newTestLoader(nil, bytes.NewBuffer(nil), bytes.NewBuffer(nil)).Load(genConf(tmp, 2000, 600))
+		So(err, ShouldBeNil)
+		So(len(conf.Repos()), ShouldEqual, 2001)
+		So(len(conf.Users()), ShouldEqual, 621)
+		So(len(conf.Subconfs()), ShouldEqual, 20)
+		So(conf.ProjectManager().NbProjects(), ShouldEqual, 20)
+		So(len(conf.Check()), ShouldEqual, 0)
+		So(conf.WhatCanAccess("u0"), ShouldContain, "r1300")
+	})
+}
+
+func benchmarkLoad(b *testing.B, nbRepos, nbUsers int) {
+	tmp, err := ioutil.TempDir("", "gogtl")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	conffile := genConf(tmp, nbRepos, nbUsers)
+	ld := New(nil, nil)
+	ld.SetOutput(ioutil.Discard, ioutil.Discard)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conf, err := ld.Load(conffile)
+		if err != nil {
+			b.Fatal(err)
+		}
+		conf.ProjectManager()
+	}
+}
+
+func BenchmarkLoad1k(b *testing.B)  { benchmarkLoad(b, 1000, 300) }
+func BenchmarkLoad10k(b *testing.B) { benchmarkLoad(b, 10000, 3000) }
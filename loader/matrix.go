@@ -0,0 +1,121 @@
+package loader
+
+// Collapse is how the repos of a matrix are grouped into columns
+type Collapse int
+
+const (
+	// ByRepo has a column per repo
+	ByRepo Collapse = iota
+	// ByRepoGroup has a column per repo group: a repo is in the column of the
+	// first repo group (in reading order) containing it, or in its own column
+	ByRepoGroup
+	// ByProject has a column per project (see project.Manager): a repo is in
+	// the column of its project, or in its own column
+	ByProject
+)
+
+// MatrixOptions selects the rows and columns of a matrix
+type MatrixOptions struct {
+	Collapse Collapse
+	// Users are the users of the matrix rows, all users if empty
+	Users []string
+	// Repos are the repos, repo groups or projects (see Collapse) of the matrix
+	// columns, all of them if empty
+	Repos []string
+}
+
+// Matrix is the effective permission of users on repos, built on the audit
+// of a config: Cells[i][j] is the permission of Users[i] on Repos[j], as
+// gitolite.Permission returns it ("RW+", "RW", "R", or "" for no access).
+// The permission on collapsed repos is the strongest one on any of them.
+type Matrix struct {
+	Users []string
+	Repos []string
+	Cells [][]string
+}
+
+var permissionRanks = map[string]int{"": 0, "R": 1, "RW": 2, "RW+": 3}
+
+// Matrix returns the permission of each user on each repo, with the
+// (sorted) users and repos (or collapsed repos) selected by opts.
+func (conf *Conf) Matrix(opts *MatrixOptions) *Matrix {
+	users := filterNames(conf.Users(), opts.Users)
+	columns := conf.columns(opts.Collapse)
+	res := &Matrix{Users: users, Repos: []string{}}
+	reponames := conf.Repos()
+	for _, reponame := range reponames {
+		res.Repos = append(res.Repos, columns[reponame])
+	}
+	res.Repos = filterNames(sortedNoDup(res.Repos), opts.Repos)
+	colIdx := make(map[string]int)
+	for j, column := range res.Repos {
+		colIdx[column] = j
+	}
+	res.Cells = make([][]string, len(users))
+	for i := range users {
+		res.Cells[i] = make([]string, len(res.Repos))
+	}
+	for _, reponame := range reponames {
+		j, ok := colIdx[columns[reponame]]
+		if !ok {
+			continue
+		}
+		for i, perm := range conf.merged.Permissions(reponame, users) {
+			if permissionRanks[perm] > permissionRanks[res.Cells[i][j]] {
+				res.Cells[i][j] = perm
+			}
+		}
+	}
+	return res
+}
+
+// columns returns the matrix column of each repo
+func (conf *Conf) columns(collapse Collapse) map[string]string {
+	res := make(map[string]string)
+	switch collapse {
+	case ByRepoGroup:
+		for _, rog := range conf.merged.GetReposOrGroups() {
+			if rog.Group() == nil {
+				continue
+			}
+			for _, repo := range rog.Group().GetAllRepos() {
+				if _, ok := res[repo.GetName()]; !ok {
+					res[repo.GetName()] = rog.GetName()
+				}
+			}
+		}
+	case ByProject:
+		for _, p := range conf.ProjectManager().Projects() {
+			for _, reponame := range p.Repos() {
+				if _, ok := res[reponame]; !ok {
+					res[reponame] = p.Name()
+				}
+			}
+		}
+	}
+	for _, reponame := range conf.Repos() {
+		if _, ok := res[reponame]; !ok {
+			res[reponame] = reponame
+		}
+	}
+	return res
+}
+
+// filterNames returns the names which are selected (in the same order),
+// all of them if none is
+func filterNames(names, selected []string) []string {
+	if len(selected) == 0 {
+		return names
+	}
+	sel := make(map[string]bool)
+	for _, name := range selected {
+		sel[name] = true
+	}
+	res := []string{}
+	for _, name := range names {
+		if sel[name] {
+			res = append(res, name)
+		}
+	}
+	return res
+}
@@ -0,0 +1,51 @@
+package loader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMatrix(t *testing.T) {
+	Convey("Builds the matrix of users permissions on repos", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf+"repo module3\n  R = user1\n"), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "project.conf"), []byte("repo @project\n  RW+ = user3\n"), 0644)
+		conf, err := newTestLoader(nil, bytes.NewBuffer(nil), bytes.NewBuffer(nil)).Load(conffile)
+		So(err, ShouldBeNil)
+
+		m := conf.Matrix(&MatrixOptions{Users: []string{"user3", "user1", "user2", "admin1"}})
+		So(m.Users, ShouldResemble, []string{"admin1", "user1", "user2", "user3"})
+		So(m.Repos, ShouldResemble, []string{"gitolite-admin", "module1", "module2", "module3"})
+		So(m.Cells, ShouldResemble, [][]string{
+			{"RW+", "", "", ""},
+			{"", "RW", "", "R"},
+			{"", "RW", "RW", ""},
+			{"", "RW+", "RW+", ""},
+		})
+
+		Convey("Collapses repos into their repo group or project", func() {
+			m := conf.Matrix(&MatrixOptions{Collapse: ByRepoGroup, Users: []string{"user1", "user2"}})
+			So(m.Repos, ShouldResemble, []string{"@project", "gitolite-admin", "module3"})
+			So(m.Cells, ShouldResemble, [][]string{{"RW", "", "R"}, {"RW", "", ""}})
+			m = conf.Matrix(&MatrixOptions{Collapse: ByProject, Users: []string{"user1", "user2"}})
+			So(m.Repos, ShouldResemble, []string{"gitolite-admin", "module3", "project"})
+			So(m.Cells, ShouldResemble, [][]string{{"", "R", "RW"}, {"", "", "RW"}})
+		})
+
+		Convey("Selects repos", func() {
+			m := conf.Matrix(&MatrixOptions{Repos: []string{"module2", "unknown"}})
+			So(m.Repos, ShouldResemble, []string{"module2"})
+			So(len(m.Users), ShouldEqual, len(conf.Users()))
+			So(m.Cells[len(m.Users)-1], ShouldResemble, []string{"RW+"})
+		})
+	})
+}
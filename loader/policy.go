@@ -0,0 +1,264 @@
+package loader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/VonC/gogitolite/gitolite"
+)
+
+// Policy is a line of a policy file (see ReadPolicies)
+type Policy struct {
+	// Line is the line number of the policy in its file
+	Line int
+	// Verb is 'deny', 'only', 'require' or 'max-projects'
+	Verb string
+	// Who is the user, user group or @all the policy is about ('desc' for 'require')
+	Who string
+	// Perm and Refex restrict 'deny' and 'only' policies to rules granting
+	// Perm ('R', 'RW', 'RW+', 'W' or '+'), for refs matching Refex if not empty
+	Perm  string
+	Refex string
+	// Max is the number of projects of a 'max-projects' policy
+	Max  int
+	text string
+}
+
+func (p *Policy) String() string {
+	return p.text
+}
+
+var policyPermRx = regexp.MustCompile(`^(R|RW|RW\+|W|\+)$`)
+
+// ReadPolicies reads a policy file: one policy per line, '#' starting a comment.
+//
+//	# no rule grants W to @all
+//	deny @all W
+//	# no rule grants RW+ on master to a user of @externals
+//	deny @externals RW+ master
+//	# only users of @release-managers get RW+ on tags
+//	only @release-managers RW+ refs/tags/
+//	# every repo has a desc
+//	require desc
+//	# a user of @externals accesses the repos of at most 3 projects
+//	max-projects @externals 3
+func ReadPolicies(r io.Reader) ([]*Policy, error) {
+	res := []*Policy{}
+	s := bufio.NewScanner(r)
+	l := 0
+	for s.Scan() {
+		l = l + 1
+		t := s.Text()
+		if i := strings.Index(t, "#"); i >= 0 {
+			t = t[:i]
+		}
+		fields := strings.Fields(t)
+		if len(fields) == 0 {
+			continue
+		}
+		p := &Policy{Line: l, Verb: fields[0], text: strings.Join(fields, " ")}
+		if !p.set(fields[1:]) {
+			return nil, fmt.Errorf("Incorrect policy '%v' at line %v", p.text, l)
+		}
+		res = append(res, p)
+	}
+	return res, s.Err()
+}
+
+// set sets the fields of a policy from the arguments of its verb,
+// and returns false if they are incorrect.
+func (p *Policy) set(args []string) bool {
+	switch p.Verb {
+	case "deny", "only":
+		if len(args) < 2 || len(args) > 3 || !policyPermRx.MatchString(args[1]) {
+			return false
+		}
+		p.Who, p.Perm = args[0], args[1]
+		if len(args) == 3 {
+			p.Refex = args[2]
+		}
+		return true
+	case "require":
+		p.Who = strings.Join(args, " ")
+		return p.Who == "desc"
+	case "max-projects":
+		if len(args) != 2 {
+			return false
+		}
+		max, err := strconv.Atoi(args[1])
+		p.Who, p.Max = args[0], max
+		return err == nil && max >= 0
+	}
+	return false
+}
+
+// Violation is a policy a config doesn't follow, for a repo or a user
+type Violation struct {
+	Policy *Policy
+	Repo   string
+	User   string
+	msg    string
+}
+
+// Error returns the violation message
+func (v *Violation) Error() string {
+	return v.msg
+}
+
+// CheckPolicies returns the violations of policies by the config and its
+// subconfs (see Merged), in policy order, then by repo or user.
+// Like Check, it returns them as errors.
+func (conf *Conf) CheckPolicies(policies []*Policy) []error {
+	errs := []error{}
+	for _, p := range policies {
+		var vs []*Violation
+		switch p.Verb {
+		case "deny", "only":
+			vs = conf.checkGrants(p)
+		case "require":
+			vs = conf.checkDesc(p)
+		case "max-projects":
+			vs = conf.checkMaxProjects(p)
+		}
+		for _, v := range vs {
+			errs = append(errs, v)
+		}
+	}
+	return errs
+}
+
+// checkGrants returns the rules granting the permission of a 'deny' policy
+// to its user (or to a user of its group), or the permission of an 'only'
+// policy to anyone else.
+// A 'deny @all' policy only denies rules naming @all, which only an
+// 'only @all' policy allows.
+func (conf *Conf) checkGrants(p *Policy) []*Violation {
+	who := make(map[string]bool)
+	for _, username := range conf.userNames(p.Who) {
+		who[username] = true
+	}
+	res := []*Violation{}
+	for _, reponame := range conf.Repos() {
+		for _, rule := range conf.merged.RulesForRepo(reponame) {
+			if gitolite.IsVREF(rule.Param()) || rule.Access() == "-" || !strings.Contains(rule.Access(), p.Perm) {
+				continue
+			}
+			if p.Refex != "" {
+				if _, ok := protectedRef(rule, p.Refex); !ok {
+					continue
+				}
+			}
+			for _, uog := range rule.GetUsersOrGroups() {
+				name := uog.GetName()
+				violates := false
+				switch {
+				case name == p.Who:
+					violates = p.Verb == "deny"
+				case p.Verb == "deny":
+					// @all stands for any user, named by a rule or not
+					violates = p.Who != "@all" && (name == "@all" && len(who) > 0 || conf.anyIn(uog, who))
+				default:
+					violates = name == "@all" || !conf.allIn(uog, who)
+				}
+				if violates {
+					res = append(res, &Violation{Policy: p, Repo: reponame, User: name,
+						msg: fmt.Sprintf("'%v' has '%v' on repo '%v' (rule '%v')", name, p.Perm, reponame, ruleText(rule))})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// anyIn returns true if a user (or a user of a group) of a rule is in users
+func (conf *Conf) anyIn(uog gitolite.UserOrGroup, users map[string]bool) bool {
+	for _, username := range conf.ruleUserNames(uog) {
+		if users[username] {
+			return true
+		}
+	}
+	return false
+}
+
+// allIn returns true if a user (or all the users of a group) of a rule are in users
+func (conf *Conf) allIn(uog gitolite.UserOrGroup, users map[string]bool) bool {
+	for _, username := range conf.ruleUserNames(uog) {
+		if !users[username] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDesc returns the repos none of the configs of which has a desc
+func (conf *Conf) checkDesc(p *Policy) []*Violation {
+	res := []*Violation{}
+	for _, reponame := range conf.Repos() {
+		hasDesc := false
+		for _, cfg := range conf.merged.GetConfigsForRepo(reponame) {
+			if cfg.Desc() != "" {
+				hasDesc = true
+			}
+		}
+		if !hasDesc {
+			res = append(res, &Violation{Policy: p, Repo: reponame, msg: fmt.Sprintf("Repo '%v' has no desc", reponame)})
+		}
+	}
+	return res
+}
+
+// checkMaxProjects returns the users of a 'max-projects' policy with access
+// to a repo of more projects than allowed
+func (conf *Conf) checkMaxProjects(p *Policy) []*Violation {
+	users := conf.userNames(p.Who)
+	projects := make(map[string][]string)
+	for _, prj := range conf.ProjectManager().Projects() {
+		for _, reponame := range prj.Repos() {
+			perms := conf.merged.Permissions(reponame, users)
+			for i, username := range users {
+				if perms[i] != "" && !containsName(projects[username], prj.Name()) {
+					projects[username] = append(projects[username], prj.Name())
+				}
+			}
+		}
+	}
+	res := []*Violation{}
+	for _, username := range users {
+		if len(projects[username]) > p.Max {
+			res = append(res, &Violation{Policy: p, User: username,
+				msg: fmt.Sprintf("'%v' is in %v projects (%v)", username, len(projects[username]), strings.Join(projects[username], ", "))})
+		}
+	}
+	return res
+}
+
+// userNames returns the sorted names of the users a user, user group
+// (of the config or its subconfs) or @all stands for
+func (conf *Conf) userNames(name string) []string {
+	if name == "@all" {
+		return conf.Users()
+	}
+	if !strings.HasPrefix(name, "@") {
+		return []string{name}
+	}
+	res := []string{}
+	if grp := conf.merged.GetGroup(name); grp != nil {
+		for _, usr := range conf.merged.GroupUsers(grp) {
+			res = append(res, usr.GetName())
+		}
+	}
+	return sortedNoDup(res)
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package loader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const policyconf = `
+@p1 = r1
+@p2 = r2
+@externals = ext1 ext2
+@rm = relman
+
+repo gitolite-admin
+  RW+     = admin
+  RW      = po
+  RW VREF/NAME/conf/subs/p1 = po
+  -  VREF/NAME/             = po
+  RW      = po
+  RW VREF/NAME/conf/subs/p2 = po
+  -  VREF/NAME/             = po
+
+repo @p1
+  RW = ext1
+repo @p2
+  RW = @externals
+  R  = @all
+repo r3
+  desc = "repo 3"
+  RW+ refs/tags/ = @rm dev1
+  RW             = @all
+subconf "subs/*.conf"
+`
+
+const policies = `
+# security team policies
+deny @all W
+deny ext2 RW       # not even through a group
+only @rm RW+ refs/tags/
+require desc
+max-projects @externals 1
+`
+
+func TestPolicy(t *testing.T) {
+	Convey("Reads a policy file", t, func() {
+		ps, err := ReadPolicies(strings.NewReader(policies))
+		So(err, ShouldBeNil)
+		So(len(ps), ShouldEqual, 5)
+		So(ps[1].Line, ShouldEqual, 4)
+		So(ps[1].String(), ShouldEqual, "deny ext2 RW")
+		So(ps[2].Who, ShouldEqual, "@rm")
+		So(ps[2].Perm, ShouldEqual, "RW+")
+		So(ps[2].Refex, ShouldEqual, "refs/tags/")
+		So(ps[4].Max, ShouldEqual, 1)
+
+		for _, bad := range []string{"allow @all R", "deny @all", "deny @all RWC", "only a RW b c", "require owner", "max-projects @x", "max-projects @x -1"} {
+			_, err = ReadPolicies(strings.NewReader("\n" + bad))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Incorrect policy '"+bad+"' at line 2")
+		}
+	})
+
+	Convey("Checks a config against policies", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(policyconf), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "p1.conf"), []byte("repo r1\n  desc = \"repo 1\"\n  R = reader1\n"), 0644)
+		ioutil.WriteFile(filepath.Join(tmp, "conf", "subs", "p2.conf"), []byte("repo r2\n  R = reader2\n"), 0644)
+		conf, err := newTestLoader(nil, bytes.NewBuffer(nil), bytes.NewBuffer(nil)).Load(conffile)
+		So(err, ShouldBeNil)
+		So(conf.ProjectManager().NbProjects(), ShouldEqual, 2)
+
+		ps, err := ReadPolicies(strings.NewReader(policies))
+		So(err, ShouldBeNil)
+		msgs := []string{}
+		for _, err := range conf.CheckPolicies(ps) {
+			v := err.(*Violation)
+			msgs = append(msgs, v.Policy.String()+": "+v.Error())
+		}
+		So(msgs, ShouldResemble, []string{
+			"deny @all W: '@all' has 'W' on repo 'r3' (rule 'RW')",
+			"deny ext2 RW: '@externals' has 'RW' on repo 'r2' (rule 'RW')",
+			"deny ext2 RW: '@all' has 'RW' on repo 'r3' (rule 'RW')",
+			"only @rm RW+ refs/tags/: 'admin' has 'RW+' on repo 'gitolite-admin' (rule 'RW+')",
+			"only @rm RW+ refs/tags/: 'dev1' has 'RW+' on repo 'r3' (rule 'RW+ refs/tags/')",
+			"require desc: Repo 'gitolite-admin' has no desc",
+			"require desc: Repo 'r2' has no desc",
+			"max-projects @externals 1: 'ext1' is in 2 projects (p1, p2)",
+		})
+		So(conf.CheckPolicies(nil), ShouldBeEmpty)
+
+		Convey("A group policy is violated through @all", func() {
+			ioutil.WriteFile(conffile, []byte("@externals = ext1\nrepo gitolite-admin\n  RW+ = admin\nrepo r4\n  RW+ master = @all\n"), 0644)
+			conf, err := newTestLoader(nil, bytes.NewBuffer(nil), bytes.NewBuffer(nil)).Load(conffile)
+			So(err, ShouldBeNil)
+			ps, err := ReadPolicies(strings.NewReader("deny @externals RW+ master"))
+			So(err, ShouldBeNil)
+			errs := conf.CheckPolicies(ps)
+			So(len(errs), ShouldEqual, 1)
+			So(errs[0].Error(), ShouldEqual, "'@all' has 'RW+' on repo 'r4' (rule 'RW+ master')")
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package loader
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/VonC/gogitolite/gitolite"
+)
+
+// DefaultProtectedRefs are the refexes of the refs protected by default:
+// master and release branches
+var DefaultProtectedRefs = []string{"master", "release/"}
+
+// Privilege is a user who can rewind or delete protected refs of a repo
+type Privilege struct {
+	User string
+	Repo string
+	// Ref is the protected refex
+	Ref string
+	// Rule is the first rule granting the privilege, as "RW+ refex"
+	Rule string
+	// Via is the user group (or @all) named by the rule, empty if the
+	// rule names the user
+	Via string
+}
+
+// Privileged returns who can rewind ('+') or delete ('D') refs matching
+// protected refexes (gitolite refexes, see Rule.MatchesRef), through the
+// first rule granting it, sorted by user, repo and refex.
+// Rules are evaluated like gitolite does (see gitolite.CheckAccess): a
+// '-' rule before an 'RW+' one for the same ref denies the privilege.
+func (conf *Conf) Privileged(protected []string) []*Privilege {
+	res := []*Privilege{}
+	for _, reponame := range conf.Repos() {
+		seen := make(map[string]bool)
+		for _, rule := range conf.merged.RulesForRepo(reponame) {
+			if gitolite.IsVREF(rule.Param()) || rule.Access() == "-" || !strings.ContainsAny(rule.Access(), "+D") {
+				continue
+			}
+			perm := "D"
+			if strings.Contains(rule.Access(), "+") {
+				perm = "+"
+			}
+			for _, refex := range protected {
+				ref, ok := protectedRef(rule, refex)
+				if !ok {
+					continue
+				}
+				for _, uog := range rule.GetUsersOrGroups() {
+					for _, username := range conf.ruleUserNames(uog) {
+						key := username + " " + refex
+						if seen[key] || conf.merged.CheckAccess(username, reponame, ref, perm) != nil {
+							continue
+						}
+						seen[key] = true
+						via := ""
+						if uog.GetName() != username {
+							via = uog.GetName()
+						}
+						res = append(res, &Privilege{User: username, Repo: reponame, Ref: refex, Rule: ruleText(rule), Via: via})
+					}
+				}
+			}
+		}
+	}
+	sort.Sort(byUserRepoRef(res))
+	return res
+}
+
+// ruleUserNames returns the names of the users a user (or user group, or @all) of a rule stands for
+func (conf *Conf) ruleUserNames(uog gitolite.UserOrGroup) []string {
+	if uog.GetName() == "@all" {
+		return conf.Users()
+	}
+	if uog.Group() == nil {
+		return []string{uog.GetName()}
+	}
+	res := []string{}
+	for _, usr := range conf.merged.GroupUsers(uog.Group()) {
+		res = append(res, usr.GetName())
+	}
+	return res
+}
+
+// protectedRef returns the ref to check a rule against for a protected refex,
+// if the rule applies to refs it matches: either the rule refex matches
+// the protected one (a rule for any ref, or for 'mas'), or it is one of the
+// refs the protected one matches (a rule for 'release/1.0').
+func protectedRef(rule *gitolite.Rule, refex string) (string, bool) {
+	ref := fullRef(refex)
+	if rule.MatchesRef(ref) {
+		return ref, true
+	}
+	param := fullRef(rule.Param())
+	if rx, err := regexp.Compile("^" + ref); err == nil && rx.MatchString(param) {
+		return param, true
+	}
+	return "", false
+}
+
+// ruleText returns the access and refex of a rule, as "RW+ refex"
+func ruleText(rule *gitolite.Rule) string {
+	return strings.TrimSpace(rule.Access() + " " + rule.Param())
+}
+
+// fullRef returns the ref of a refex: a refex not starting with 'refs/' is a branch
+func fullRef(refex string) string {
+	if strings.HasPrefix(refex, "refs/") {
+		return refex
+	}
+	return "refs/heads/" + refex
+}
+
+type byUserRepoRef []*Privilege
+
+func (ps byUserRepoRef) Len() int      { return len(ps) }
+func (ps byUserRepoRef) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
+func (ps byUserRepoRef) Less(i, j int) bool {
+	if ps[i].User != ps[j].User {
+		return ps[i].User < ps[j].User
+	}
+	if ps[i].Repo != ps[j].Repo {
+		return ps[i].Repo < ps[j].Repo
+	}
+	return ps[i].Ref < ps[j].Ref
+}
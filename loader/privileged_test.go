@@ -0,0 +1,92 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const privilegedconf = `
+@leads = lead1
+@devs = dev1 @leads
+@apps = app1 app2
+
+repo gitolite-admin
+  RW+ = admin
+
+repo @apps
+  -   master       = dev1
+  RW+ master       = @devs
+  RW+ dev/         = dev2
+  RW+ release/1.0  = rel1
+  RW  release/     = rel2
+
+repo app2
+  RW+ = @all
+
+repo app3
+  RW+ ma           = dev3
+  RW+ refs/tags/   = tagger
+`
+
+func TestPrivileged(t *testing.T) {
+	Convey("Reports who can rewind or delete protected refs", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(privilegedconf), 0644)
+		conf, err := newTestLoader(nil, bytes.NewBuffer(nil), bytes.NewBuffer(nil)).Load(conffile)
+		So(err, ShouldBeNil)
+
+		lines := func(ps []*Privilege) []string {
+			res := []string{}
+			for _, p := range ps {
+				res = append(res, fmt.Sprintf("%v %v %v '%v' %v", p.User, p.Repo, p.Ref, p.Rule, p.Via))
+			}
+			return res
+		}
+		So(lines(conf.Privileged(DefaultProtectedRefs)), ShouldResemble, []string{
+			"admin app2 master 'RW+' @all",
+			"admin app2 release/ 'RW+' @all",
+			"admin gitolite-admin master 'RW+' ",
+			"admin gitolite-admin release/ 'RW+' ",
+			"dev1 app2 release/ 'RW+' @all",
+			"dev2 app2 master 'RW+' @all",
+			"dev2 app2 release/ 'RW+' @all",
+			"dev3 app2 master 'RW+' @all",
+			"dev3 app2 release/ 'RW+' @all",
+			"dev3 app3 master 'RW+ ma' ",
+			"lead1 app1 master 'RW+ master' @devs",
+			"lead1 app2 master 'RW+ master' @devs",
+			"rel1 app1 release/ 'RW+ release/1.0' ",
+			"rel1 app2 master 'RW+' @all",
+			"rel1 app2 release/ 'RW+ release/1.0' ",
+			"rel2 app2 master 'RW+' @all",
+			"rel2 app2 release/ 'RW+' @all",
+			"tagger app2 master 'RW+' @all",
+			"tagger app2 release/ 'RW+' @all",
+		})
+
+		Convey("Protected refs are configurable", func() {
+			So(lines(conf.Privileged([]string{"refs/tags/v"})), ShouldContain, "tagger app3 refs/tags/v 'RW+ refs/tags/' ")
+			So(len(conf.Privileged([]string{"next"})), ShouldEqual, 8)
+		})
+
+		Convey("A rule denied for a ref doesn't hide a later one granted for another", func() {
+			ioutil.WriteFile(conffile, []byte("repo gitolite-admin\n  RW+ = admin\nrepo x\n  -   release/1.0 = alice\n  RW+ release/1.0 = alice\n  RW+ release/2.0 = alice\n"), 0644)
+			conf, err := newTestLoader(nil, bytes.NewBuffer(nil), bytes.NewBuffer(nil)).Load(conffile)
+			So(err, ShouldBeNil)
+			So(lines(conf.Privileged([]string{"release/"})), ShouldResemble, []string{
+				"admin gitolite-admin release/ 'RW+' ",
+				"alice x release/ 'RW+ release/2.0' ",
+			})
+		})
+	})
+}
@@ -0,0 +1,108 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/VonC/gogitolite/reader"
+)
+
+// GroupChange is a group of the config with the members to add to it, and
+// to remove from it, to get the members imported from a directory.
+type GroupChange struct {
+	Group   string
+	Added   []string
+	Removed []string
+}
+
+// GroupChanges compares the members of groups of the config (not of its
+// subconfs) with the members imported for them, in the order of groups.
+// Groups must be users groups (or unused groups) of the config, with
+// imported members.
+func (conf *Conf) GroupChanges(imported reader.Members, groups []string) ([]*GroupChange, error) {
+	res := []*GroupChange{}
+	for _, grpname := range groups {
+		if !strings.HasPrefix(grpname, "@") {
+			grpname = "@" + grpname
+		}
+		grp := conf.gtl.GetGroup(grpname)
+		if grp == nil {
+			return nil, fmt.Errorf("group '%v' not defined in '%v'", grpname, conf.filename)
+		}
+		if !grp.IsUsers() && !grp.IsUndefined() {
+			return nil, fmt.Errorf("group '%v' is a repos group, not a user one", grpname)
+		}
+		members, ok := imported[grpname]
+		if !ok {
+			return nil, fmt.Errorf("no members imported for group '%v'", grpname)
+		}
+		if len(members) == 0 {
+			return nil, fmt.Errorf("group '%v' can't have no members", grpname)
+		}
+		gc := &GroupChange{Group: grpname, Added: []string{}, Removed: []string{}}
+		for _, member := range members {
+			if !containsName(grp.GetMembers(), member) {
+				gc.Added = append(gc.Added, member)
+			}
+		}
+		for _, member := range grp.GetMembers() {
+			if !containsName(members, member) {
+				gc.Removed = append(gc.Removed, member)
+			}
+		}
+		if len(gc.Added) > 0 || len(gc.Removed) > 0 {
+			res = append(res, gc)
+		}
+	}
+	return res, nil
+}
+
+// ApplyGroupChanges returns the content of the config file before and
+// after group changes: only the definition line of the groups changes (see
+// reader.WriteGroups), their members removed, then the added ones appended.
+// Neither the file nor the config are modified: the config must be loaded
+// again (from the written file) to reflect the changes.
+func (conf *Conf) ApplyGroupChanges(changes []*GroupChange) (string, string, error) {
+	members := make(map[string][]string)
+	for _, gc := range changes {
+		grp := conf.gtl.GetGroup(gc.Group)
+		if grp == nil {
+			return "", "", fmt.Errorf("group '%v' not defined in '%v'", gc.Group, conf.filename)
+		}
+		grpmembers := []string{}
+		for _, member := range grp.GetMembers() {
+			if !containsName(gc.Removed, member) {
+				grpmembers = append(grpmembers, member)
+			}
+		}
+		for _, member := range gc.Added {
+			if !containsName(grpmembers, member) {
+				grpmembers = append(grpmembers, member)
+			}
+		}
+		members[gc.Group] = grpmembers
+	}
+	before, err := conf.content()
+	if err != nil {
+		return "", "", err
+	}
+	var after bytes.Buffer
+	if err = reader.WriteGroups(bytes.NewReader(before), &after, members); err != nil {
+		return "", "", err
+	}
+	return string(before), after.String(), nil
+}
+
+// content returns the content of the config file, from the git tree if read from one
+func (conf *Conf) content() ([]byte, error) {
+	if conf.ld.tree == nil {
+		return ioutil.ReadFile(conf.filename)
+	}
+	r, err := conf.ld.tree.Open(conf.filename)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,64 @@
+package loader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/VonC/gogitolite/reader"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSync(t *testing.T) {
+	Convey("Groups are synchronised with imported members", t, func() {
+		tmp, err := ioutil.TempDir("", "gogtl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		os.MkdirAll(filepath.Join(tmp, "conf", "subs"), 0755)
+		conffile := filepath.Join(tmp, "conf", "gitolite.conf")
+		ioutil.WriteFile(conffile, []byte(gitoliteconf), 0644)
+		ld := newTestLoader(nil, bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+		conf, err := ld.Load(conffile)
+		So(err, ShouldBeNil)
+		imported := reader.Members{"@almadmins": {"admin2", "admin3"}, "@project": {"x"}, "@none": {}}
+
+		changes, err := conf.GroupChanges(imported, []string{"almadmins"})
+		So(err, ShouldBeNil)
+		So(changes, ShouldResemble, []*GroupChange{{Group: "@almadmins", Added: []string{"admin3"}, Removed: []string{"admin1"}}})
+
+		before, after, err := conf.ApplyGroupChanges(changes)
+		So(err, ShouldBeNil)
+		So(before, ShouldEqual, gitoliteconf)
+		So(after, ShouldEqual, strings.Replace(gitoliteconf, "@almadmins = admin1 admin2", "@almadmins = admin2 admin3", 1))
+		So(conf.Gitolite().GetGroup("@almadmins").GetMembers(), ShouldResemble, []string{"admin1", "admin2"})
+		So(conf.Merged().CheckAccess("admin1", "gitolite-admin", "", "R"), ShouldBeNil)
+
+		ioutil.WriteFile(conffile, []byte(after), 0644)
+		conf, err = ld.Load(conffile)
+		So(err, ShouldBeNil)
+		So(conf.Merged().CheckAccess("admin3", "gitolite-admin", "refs/heads/master", "+"), ShouldBeNil)
+		So(conf.Merged().CheckAccess("admin1", "gitolite-admin", "", "R"), ShouldNotBeNil)
+		changes, err = conf.GroupChanges(imported, []string{"@almadmins"})
+		So(err, ShouldBeNil)
+		So(changes, ShouldBeEmpty)
+
+		Convey("Only imported users groups of the config can be synchronised", func() {
+			for grpname, msg := range map[string]string{
+				"@qa":      "group '@qa' not defined in '" + conffile + "'",
+				"@project": "group '@project' is a repos group, not a user one",
+			} {
+				_, err = conf.GroupChanges(imported, []string{grpname})
+				So(err.Error(), ShouldEqual, msg)
+			}
+			conf.Gitolite().AddUserOrRepoGroup("@none", []string{"x"}, nil)
+			conf.Gitolite().AddUserOrRepoGroup("@absent", []string{"x"}, nil)
+			_, err = conf.GroupChanges(imported, []string{"@none"})
+			So(err.Error(), ShouldEqual, "group '@none' can't have no members")
+			_, err = conf.GroupChanges(imported, []string{"@absent"})
+			So(err.Error(), ShouldEqual, "no members imported for group '@absent'")
+		})
+	})
+}
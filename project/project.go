@@ -1,40 +1,38 @@
 package project
 
 import (
-	"bufio"
 	"fmt"
-	"io"
-	"os"
-	"regexp"
 	"strings"
 
 	"github.com/VonC/gogitolite/gitolite"
 )
 
-var (
-	sout *bufio.Writer
-	serr *bufio.Writer
-)
-
-func out() io.Writer {
-	if sout == nil {
-		return os.Stdout
-	}
-	return sout
-}
-
-func oerr() io.Writer {
-	if serr == nil {
-		return os.Stderr
-	}
-	return serr
-}
-
 // Project has a name and users
 type Project struct {
 	name    string
 	admins  []gitolite.UserOrGroup
 	members []gitolite.UserOrGroup
+	repos   []string
+}
+
+// Name returns the project name
+func (p *Project) Name() string {
+	return p.name
+}
+
+// Admins returns the users (or user groups) administrating the project
+func (p *Project) Admins() []gitolite.UserOrGroup {
+	return p.admins
+}
+
+// Repos returns the names of the repos of the project (its @name repo group)
+func (p *Project) Repos() []string {
+	return p.repos
+}
+
+// Members returns the users (or user groups) with access to the project repos
+func (p *Project) Members() []gitolite.UserOrGroup {
+	return p.members
 }
 
 func (p *Project) String() string {
@@ -56,11 +54,53 @@ func (p *Project) String() string {
 	return res
 }
 
+// DiagnosticCode is the reason a project declaration has been ignored
+type DiagnosticCode int
+
+const (
+	// NoRWBefore means the 'RW VREF/NAME/conf/subs/name' rule of a project
+	// doesn't follow a naked 'RW' rule
+	NoRWBefore DiagnosticCode = iota + 1
+	// AdminsDiffer means the rules of a project declaration don't have the same users
+	AdminsDiffer
+	// NoName means the 'RW VREF/NAME/conf/subs/' rule of a project has no project name
+	NoName
+	// NoSubconf means no subconf is named after the project
+	NoSubconf
+)
+
+var diagnosticCodes = map[DiagnosticCode]string{
+	NoRWBefore:   "NoRWBefore",
+	AdminsDiffer: "AdminsDiffer",
+	NoName:       "NoName",
+	NoSubconf:    "NoSubconf",
+}
+
+func (code DiagnosticCode) String() string {
+	return diagnosticCodes[code]
+}
+
+// Diagnostic explains why a project declaration of the gitolite-admin repo
+// has been ignored: Rule is the rule at which it has been ignored, and
+// Project the project name (empty if unknown).
+type Diagnostic struct {
+	Project string
+	Code    DiagnosticCode
+	Rule    *gitolite.Rule
+	msg     string
+}
+
+// Error returns the diagnostic message
+func (d *Diagnostic) Error() string {
+	return d.msg
+}
+
 // Manager manages project for a gitolite instance
 type Manager struct {
-	gtl      *gitolite.Gitolite
-	subconfs map[string]*gitolite.Gitolite
-	projects []*Project
+	gtl         *gitolite.Gitolite
+	subconfs    map[string]*gitolite.Gitolite
+	projects    []*Project
+	diagnostics []*Diagnostic
 }
 
 // NewManager creates a new project manager
@@ -80,6 +120,15 @@ func (pm *Manager) NbProjects() int {
 	return len(pm.projects)
 }
 
+// Diagnostics returns why project declarations have been ignored, in reading order
+func (pm *Manager) Diagnostics() []*Diagnostic {
+	return pm.diagnostics
+}
+
+func (pm *Manager) ignore(projectname string, code DiagnosticCode, rule *gitolite.Rule, format string, a ...interface{}) {
+	pm.diagnostics = append(pm.diagnostics, &Diagnostic{Project: projectname, Code: code, Rule: rule, msg: fmt.Sprintf(format, a...)})
+}
+
 func (pm *Manager) updateProjects() {
 	gtl := pm.gtl
 	configs := gtl.GetConfigsForRepo("gitolite-admin")
@@ -97,7 +146,7 @@ func (pm *Manager) updateProjects() {
 				isrw = true
 			} else if rule.Access() == "-" && rule.Param() == "VREF/NAME/" {
 				if currentProject != nil && currentProject.name == "" {
-					fmt.Fprintf(oerr(), "Ignore project with no name\n")
+					pm.ignore("", NoName, rule, "Ignore project with no name")
 					currentProject = nil
 				}
 				currentProject = pm.currentProjectVREFName(currentProject, rule, gtl)
@@ -108,20 +157,12 @@ func (pm *Manager) updateProjects() {
 	}
 }
 
-var subconfRx = regexp.MustCompile(`(?m)^.+[/\\](.+)\.conf$`)
-
 func (pm *Manager) checkSubConf(p *Project) bool {
 	var subconf *gitolite.Gitolite
-	for subconfpath, gtl := range pm.subconfs {
-		res := subconfRx.FindStringSubmatchIndex(subconfpath)
-		//fmt.Println("\nSUBCFGpath ", subconfpath, res)
-		if res != nil {
-			subconfname := subconfpath[res[2]:res[3]]
-			//fmt.Println("subconfname ", subconfname, p.name)
-			if subconfname == p.name {
-				subconf = gtl
-				break
-			}
+	for _, gtl := range pm.subconfs {
+		if gtl.SubconfName() == p.name {
+			subconf = gtl
+			break
 		}
 	}
 	if subconf != nil {
@@ -139,12 +180,12 @@ func (pm *Manager) currentProjectRW(rule *gitolite.Rule, currentProject *Project
 		projectname := rule.Param()[len(prefix):]
 		//fmt.Println("\nPRJ '", projectname, "'")
 		if currentProject == nil {
-			fmt.Fprintf(oerr(), "Ignore project name '%v': no RW rule before.\n", projectname)
+			pm.ignore(projectname, NoRWBefore, rule, "Ignore project name '%v': no RW rule before.", projectname)
 		} else {
 			currentProject.name = projectname
 		}
 		if currentProject != nil && !currentProject.hasSameUsers(rule.GetUsersFirstOrGroups()) {
-			fmt.Fprintf(oerr(), "Ignore project name '%v': Admins differ on 'RW' (%v vs. %v)\n", projectname,
+			pm.ignore(projectname, AdminsDiffer, rule, "Ignore project name '%v': Admins differ on 'RW' (%v vs. %v)", projectname,
 				currentProject.admins, rule.GetUsersFirstOrGroups())
 			currentProject = nil
 		}
@@ -154,7 +195,7 @@ func (pm *Manager) currentProjectRW(rule *gitolite.Rule, currentProject *Project
 
 func (pm *Manager) currentProjectVREFName(currentProject *Project, rule *gitolite.Rule, gtl *gitolite.Gitolite) *Project {
 	if currentProject != nil && !currentProject.hasSameUsers(rule.GetUsersFirstOrGroups()) {
-		fmt.Fprintf(oerr(), "Ignore project name '%v': admins differ on '-' (%v vs. %v)\n", currentProject.name,
+		pm.ignore(currentProject.name, AdminsDiffer, rule, "Ignore project name '%v': admins differ on '-' (%v vs. %v)", currentProject.name,
 			currentProject.admins, rule.GetUsersFirstOrGroups())
 		currentProject = nil
 	}
@@ -165,7 +206,7 @@ func (pm *Manager) currentProjectVREFName(currentProject *Project, rule *gitolit
 				pm.projects = append(pm.projects, currentProject)
 				pm.updateMembers(currentProject)
 			} else {
-				fmt.Fprintf(oerr(), "Ignore project name '%v': no subconf found\n", currentProject.name)
+				pm.ignore(currentProject.name, NoSubconf, rule, "Ignore project name '%v': no subconf found", currentProject.name)
 			}
 		}
 	}
@@ -177,6 +218,7 @@ func (pm *Manager) updateMembers(p *Project) {
 	group := pm.gtl.GetGroup("@" + p.name)
 	repos := group.GetAllRepos()
 	for _, repo := range repos {
+		p.repos = append(p.repos, repo.GetName())
 		configs := pm.gtl.GetConfigsForRepo(repo.GetName())
 		//fmt.Println("\nCFG: ", repo.GetName(), " => ", configs)
 		for _, config := range configs {
@@ -1,8 +1,6 @@
 package project
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
 	"strings"
 	"testing"
@@ -12,38 +10,6 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-var (
-	bout *bytes.Buffer
-	wout *bufio.Writer
-	berr *bytes.Buffer
-	werr *bufio.Writer
-)
-
-func init() {
-
-	out()
-	oerr()
-	bout = bytes.NewBuffer(nil)
-	wout = bufio.NewWriter(bout)
-	sout = wout
-	berr = bytes.NewBuffer(nil)
-	werr = bufio.NewWriter(berr)
-	serr = werr
-	out()
-}
-
-func resetStds() {
-	bout = bytes.NewBuffer(nil)
-	sout.Reset(bout)
-	berr = bytes.NewBuffer(nil)
-	serr.Reset(berr)
-}
-
-func flushStds() {
-	sout.Flush()
-	serr.Flush()
-}
-
 /*
    subconf "subs/*.conf"
 
@@ -73,10 +39,8 @@ func TestProject(t *testing.T) {
 			r := strings.NewReader(gitoliteconf)
 			gtl, err := reader.Read(r)
 			subconfs := make(map[string]*gitolite.Gitolite)
-			subconfs["path/project.conf"] = gtl
+			subconfs["path/project.conf"] = gitolite.NewSubconf(gtl, "project")
 			pm := NewManager(gtl, subconfs)
-			flushStds()
-			resetStds()
 			So(err, ShouldBeNil)
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 3)
@@ -97,7 +61,7 @@ func TestProject(t *testing.T) {
 			r := strings.NewReader(gitoliteconf)
 			gtl, err := reader.Read(r)
 			subconfs := make(map[string]*gitolite.Gitolite)
-			subconfs["path/project.conf"] = gtl
+			subconfs["path/project.conf"] = gitolite.NewSubconf(gtl, "project")
 			pm := NewManager(gtl, subconfs)
 			So(err, ShouldBeNil)
 			So(gtl, ShouldNotBeNil)
@@ -108,8 +72,6 @@ func TestProject(t *testing.T) {
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(fmt.Sprintf("groups '%v'", gtl.GetGroup("@project")), ShouldEqual, "groups 'group '@project'<repos>: [module1 module2]'")
 			So(pm.Projects()[0].String(), ShouldEqual, "project project, admins: projectowner, members: ")
-			flushStds()
-			resetStds()
 		})
 
 		Convey("Detects one project with several admins and users", func() {
@@ -130,7 +92,7 @@ func TestProject(t *testing.T) {
 			r := strings.NewReader(gitoliteconf)
 			gtl, err := reader.Read(r)
 			subconfs := make(map[string]*gitolite.Gitolite)
-			subconfs["path/project.conf"] = gtl
+			subconfs["path/project.conf"] = gitolite.NewSubconf(gtl, "project")
 			pm := NewManager(gtl, subconfs)
 			So(err, ShouldBeNil)
 			So(gtl, ShouldNotBeNil)
@@ -141,8 +103,10 @@ func TestProject(t *testing.T) {
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(fmt.Sprintf("groups '%v'", gtl.GetGroup("@project")), ShouldEqual, "groups 'group '@project'<repos>: [module1 module2]'")
 			So(pm.Projects()[0].String(), ShouldEqual, "project project, admins: projectowner1, projectowner2, members: user1, user11, user2, user21")
-			flushStds()
-			resetStds()
+			So(pm.Projects()[0].Name(), ShouldEqual, "project")
+			So(len(pm.Projects()[0].Admins()), ShouldEqual, 2)
+			So(pm.Projects()[0].Members()[3].GetName(), ShouldEqual, "user21")
+			So(pm.Projects()[0].Repos(), ShouldResemble, []string{"module1", "module2"})
 		})
 
 		Convey("No project if no RW rule before", func() {
@@ -165,8 +129,6 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			resetStds()
 		})
 
 		Convey("No project if none detected", func() {
@@ -186,8 +148,6 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			resetStds()
 		})
 
 		Convey("No project if users changes in VREF/NAME/conf", func() {
@@ -211,8 +171,6 @@ func TestProject(t *testing.T) {
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(gtl.NbUsers(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			resetStds()
 		})
 
 		Convey("No project if users changes in VREF/NAME/", func() {
@@ -236,8 +194,6 @@ func TestProject(t *testing.T) {
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(gtl.NbUsers(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			resetStds()
 		})
 
 		Convey("No project if no repo group", func() {
@@ -258,8 +214,6 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 2)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			resetStds()
 		})
 
 		Convey("No project if user group", func() {
@@ -287,8 +241,6 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 2)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			resetStds()
 		})
 
 		Convey("No project if empty name", func() {
@@ -307,7 +259,7 @@ func TestProject(t *testing.T) {
 			r := strings.NewReader(gitoliteconf)
 			gtl, err := reader.Read(r)
 			subconfs := make(map[string]*gitolite.Gitolite)
-			subconfs["path/project.conf"] = gtl
+			subconfs["path/project.conf"] = gitolite.NewSubconf(gtl, "project")
 			pm := NewManager(gtl, subconfs)
 			So(err, ShouldBeNil)
 			So(gtl, ShouldNotBeNil)
@@ -315,10 +267,11 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			So(berr.String(), ShouldEqual, `Ignore project with no name
-`)
-			resetStds()
+			So(pm.Diagnostics()[0].Error(), ShouldEqual, `Ignore project with no name`)
+			So(pm.Diagnostics()[0].Code, ShouldEqual, NoName)
+			So(pm.Diagnostics()[0].Project, ShouldEqual, "")
+			So(pm.Diagnostics()[0].Rule.Access(), ShouldEqual, "-")
+			So(len(pm.Diagnostics()), ShouldEqual, 1)
 		})
 
 		Convey("No project if no subconfs", func() {
@@ -343,10 +296,11 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			So(berr.String(), ShouldEqual, `Ignore project name 'project': no subconf found
-`)
-			resetStds()
+			So(pm.Diagnostics()[0].Error(), ShouldEqual, `Ignore project name 'project': no subconf found`)
+			So(pm.Diagnostics()[0].Code, ShouldEqual, NoSubconf)
+			So(pm.Diagnostics()[0].Code.String(), ShouldEqual, "NoSubconf")
+			So(pm.Diagnostics()[0].Project, ShouldEqual, "project")
+			So(pm.Diagnostics()[0].Rule.Param(), ShouldEqual, "VREF/NAME/")
 		})
 
 		Convey("No project if no RW rule first", func() {
@@ -364,7 +318,7 @@ func TestProject(t *testing.T) {
 			r := strings.NewReader(gitoliteconf)
 			gtl, err := reader.Read(r)
 			subconfs := make(map[string]*gitolite.Gitolite)
-			subconfs["path/project.conf"] = gtl
+			subconfs["path/project.conf"] = gitolite.NewSubconf(gtl, "project")
 			pm := NewManager(gtl, subconfs)
 			So(err, ShouldBeNil)
 			So(gtl, ShouldNotBeNil)
@@ -372,10 +326,9 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			So(berr.String(), ShouldEqual, `Ignore project name 'project': no RW rule before.
-`)
-			resetStds()
+			So(pm.Diagnostics()[0].Error(), ShouldEqual, `Ignore project name 'project': no RW rule before.`)
+			So(pm.Diagnostics()[0].Code, ShouldEqual, NoRWBefore)
+			So(pm.Diagnostics()[0].Rule.Param(), ShouldEqual, "VREF/NAME/conf/subs/project")
 		})
 
 		Convey("No project if admins change", func() {
@@ -394,7 +347,7 @@ func TestProject(t *testing.T) {
 			r := strings.NewReader(gitoliteconf)
 			gtl, err := reader.Read(r)
 			subconfs := make(map[string]*gitolite.Gitolite)
-			subconfs["path/project.conf"] = gtl
+			subconfs["path/project.conf"] = gitolite.NewSubconf(gtl, "project")
 			pm := NewManager(gtl, subconfs)
 			So(err, ShouldBeNil)
 			So(gtl, ShouldNotBeNil)
@@ -402,10 +355,9 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			So(berr.String(), ShouldEqual, `Ignore project name 'project': Admins differ on 'RW' ([user 'projectowner1'] vs. [user 'projectowner1' user 'po2'])
-`)
-			resetStds()
+			So(pm.Diagnostics()[0].Error(), ShouldEqual, `Ignore project name 'project': Admins differ on 'RW' ([user 'projectowner1'] vs. [user 'projectowner1' user 'po2'])`)
+			So(pm.Diagnostics()[0].Code, ShouldEqual, AdminsDiffer)
+			So(pm.Diagnostics()[0].Rule.Param(), ShouldEqual, "VREF/NAME/conf/subs/project")
 		})
 
 		Convey("No project if admins change on last rule", func() {
@@ -424,7 +376,7 @@ func TestProject(t *testing.T) {
 			r := strings.NewReader(gitoliteconf)
 			gtl, err := reader.Read(r)
 			subconfs := make(map[string]*gitolite.Gitolite)
-			subconfs["path/project.conf"] = gtl
+			subconfs["path/project.conf"] = gitolite.NewSubconf(gtl, "project")
 			pm := NewManager(gtl, subconfs)
 			So(err, ShouldBeNil)
 			So(gtl, ShouldNotBeNil)
@@ -432,10 +384,10 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			So(berr.String(), ShouldEqual, `Ignore project name 'project': admins differ on '-' ([user 'projectowner'] vs. [user 'projectowner1'])
-`)
-			resetStds()
+			So(pm.Diagnostics()[0].Error(), ShouldEqual, `Ignore project name 'project': admins differ on '-' ([user 'projectowner'] vs. [user 'projectowner1'])`)
+			So(pm.Diagnostics()[0].Code, ShouldEqual, AdminsDiffer)
+			So(pm.Diagnostics()[0].Project, ShouldEqual, "project")
+			So(pm.Diagnostics()[0].Rule.Param(), ShouldEqual, "VREF/NAME/")
 		})
 
 	})
@@ -464,10 +416,9 @@ func TestProject(t *testing.T) {
 			So(gtl.IsEmpty(), ShouldBeFalse)
 			So(gtl.NbRepos(), ShouldEqual, 3)
 			So(pm.NbProjects(), ShouldEqual, 0)
-			flushStds()
-			So(berr.String(), ShouldEqual, `Ignore project name 'project2': no subconf found
-`)
-			resetStds()
+			So(pm.Diagnostics()[0].Error(), ShouldEqual, `Ignore project name 'project2': no subconf found`)
+			So(pm.Diagnostics()[0].Code, ShouldEqual, NoSubconf)
+			So(pm.Diagnostics()[0].Project, ShouldEqual, "project2")
 		})
 	})
 
@@ -487,10 +438,8 @@ func TestProject(t *testing.T) {
 		r := strings.NewReader(gitoliteconf)
 		gtl, err := reader.Read(r)
 		subconfs := make(map[string]*gitolite.Gitolite)
-		subconfs["path/project.conf"] = gtl
+		subconfs["path/project.conf"] = gitolite.NewSubconf(gtl, "project")
 		pm := NewManager(gtl, subconfs)
-		flushStds()
-		resetStds()
 
 		Convey("Adding an existing project errors", func() {
 
@@ -0,0 +1,214 @@
+package reader
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Members are the members of groups imported from a directory, by group
+// name (with its '@' prefix), in reading order.
+type Members map[string][]string
+
+func (m Members) add(grpname, member string) {
+	if !strings.HasPrefix(grpname, "@") {
+		grpname = "@" + grpname
+	}
+	members, ok := m[grpname]
+	if !ok {
+		members = []string{}
+	}
+	if member != "" && !isIn(member, members) {
+		members = append(members, member)
+	}
+	m[grpname] = members
+}
+
+func isIn(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadMembersCSV reads 'group,member' lines (further columns are ignored),
+// after an optional 'group,...' header line.
+// A line with an empty member declares a group without members.
+func ReadMembersCSV(r io.Reader) (Members, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	res := Members{}
+	for l := 1; ; l++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if l == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "group") {
+			continue
+		}
+		if len(record) < 2 || strings.TrimSpace(record[0]) == "" {
+			return nil, ParseError{msg: fmt.Sprintf("group and member expected at line %v ('%v')", l, strings.Join(record, ","))}
+		}
+		res.add(strings.TrimSpace(record[0]), strings.TrimSpace(record[1]))
+	}
+}
+
+// ldifGroupClasses are the object classes of LDAP groups
+var ldifGroupClasses = map[string]bool{"groupofnames": true, "groupofuniquenames": true, "posixgroup": true}
+
+// ReadMembersLDIF reads the groups of an LDIF file: entries of a group
+// object class (groupOfNames, groupOfUniqueNames, posixGroup), or with
+// members. A group is named after its 'cn' (or the first RDN of its dn),
+// its members after their 'memberUid', or the first RDN value of their
+// 'member' or 'uniqueMember' dn (alice for 'uid=alice,ou=people,...').
+func ReadMembersLDIF(r io.Reader) (Members, error) {
+	res := Members{}
+	entry := []string{}
+	s := bufio.NewScanner(r)
+	l := 0
+	for {
+		more := s.Scan()
+		l = l + 1
+		t := strings.TrimRight(s.Text(), "\r")
+		if more && strings.HasPrefix(t, " ") && len(entry) > 0 {
+			entry[len(entry)-1] = entry[len(entry)-1] + t[1:]
+			continue
+		}
+		if more && strings.HasPrefix(t, "#") {
+			continue
+		}
+		if !more || t == "" {
+			if err := addLDIFEntry(res, entry); err != nil {
+				return nil, ParseError{msg: fmt.Sprintf("%v in entry ending at line %v", err.Error(), l-1)}
+			}
+			entry = []string{}
+			if !more {
+				return res, s.Err()
+			}
+			continue
+		}
+		entry = append(entry, t)
+	}
+}
+
+// addLDIFEntry adds the members of an LDIF entry ('attr: value' lines),
+// if it is a group
+func addLDIFEntry(m Members, entry []string) error {
+	name, dn := "", ""
+	isGroup := false
+	members := []string{}
+	for _, line := range entry {
+		attr, value, err := ldifAttr(line)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(attr) {
+		case "dn":
+			dn = value
+		case "cn":
+			if name == "" {
+				name = value
+			}
+		case "objectclass":
+			isGroup = isGroup || ldifGroupClasses[strings.ToLower(value)]
+		case "memberuid":
+			members = append(members, value)
+		case "member", "uniquemember":
+			members = append(members, rdnValue(value))
+		}
+	}
+	if !isGroup && len(members) == 0 {
+		return nil
+	}
+	if name == "" {
+		name = rdnValue(dn)
+	}
+	if name == "" {
+		return fmt.Errorf("no cn for group")
+	}
+	m.add(name, "")
+	for _, member := range members {
+		m.add(name, member)
+	}
+	return nil
+}
+
+// ldifAttr returns the attribute and value of an 'attr: value' line
+// ('attr:: base64 value' for an encoded value)
+func ldifAttr(line string) (string, string, error) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("'attr: value' expected instead of '%v'", line)
+	}
+	attr, value := line[:i], line[i+1:]
+	if strings.HasPrefix(value, ":") {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid base64 value for '%v'", attr)
+		}
+		value = string(b)
+	}
+	return attr, strings.TrimSpace(value), nil
+}
+
+// rdnValue returns the value of the first RDN of a dn: 'alice' for
+// 'uid=alice,ou=people,dc=example,dc=com'
+func rdnValue(dn string) string {
+	rdn := strings.SplitN(dn, ",", 2)[0]
+	if i := strings.Index(rdn, "="); i >= 0 {
+		rdn = rdn[i+1:]
+	}
+	return strings.TrimSpace(rdn)
+}
+
+var writeGroupRx = regexp.MustCompile(`^(\s*(@[a-zA-Z0-9_-]+)\s*?=\s*)(.*?)(\s*)$`)
+
+// WriteGroups copies a gitolite config file, with the members of some of its
+// groups replaced: only the members of their definition line are rewritten,
+// other lines (comments, indentation, line endings) are copied as is.
+// It fails if a group isn't defined by the file.
+func WriteGroups(r io.Reader, w io.Writer, members map[string][]string) error {
+	br := bufio.NewReader(r)
+	done := map[string]bool{}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		content := strings.TrimSuffix(line, "\n")
+		if res := writeGroupRx.FindStringSubmatch(content); res != nil {
+			if grpmembers, ok := members[res[2]]; ok && !done[res[2]] {
+				done[res[2]] = true
+				line = res[1] + strings.Join(grpmembers, " ") + res[4] + line[len(content):]
+			}
+		}
+		if _, werr := io.WriteString(w, line); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	missing := []string{}
+	for grpname := range members {
+		if !done[grpname] {
+			missing = append(missing, grpname)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("group(s) '%v' not defined", strings.Join(missing, "', '"))
+	}
+	return nil
+}
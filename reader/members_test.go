@@ -0,0 +1,75 @@
+package reader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var membersldif = `version: 1
+
+# developers
+dn: cn=devs,ou=groups,dc=example,dc=com
+objectClass: groupOfNames
+cn: devs
+member: uid=alice,ou=people,dc=example,dc=com
+member: uid=bob,ou=peo
+ ple,dc=example,dc=com
+
+dn: cn=ops,ou=groups,dc=example,dc=com
+objectClass: posixGroup
+memberUid: carol
+memberUid:: ZGF2ZQ==
+
+dn: cn=empty,ou=groups,dc=example,dc=com
+objectClass: groupOfUniqueNames
+
+dn: uid=alice,ou=people,dc=example,dc=com
+objectClass: inetOrgPerson
+cn: Alice
+`
+
+var membersconf = `@devs = alice bob
+# ops, managed by the directory
+  @ops   =   carol
+@other = x
+
+repo foo
+  RW = @devs @ops`
+
+func TestMembers(t *testing.T) {
+
+	Convey("Group members are read from CSV", t, func() {
+		m, err := ReadMembersCSV(strings.NewReader("Group,Member,Name\ndevs,alice,Alice\n@devs, bob\nops,\ndevs,alice\n"))
+		So(err, ShouldBeNil)
+		So(m, ShouldResemble, Members{"@devs": {"alice", "bob"}, "@ops": {}})
+
+		_, err = ReadMembersCSV(strings.NewReader("devs,alice\nops\n"))
+		So(err.Error(), ShouldEqual, "Parse Error: group and member expected at line 2 ('ops')")
+	})
+
+	Convey("Group members are read from LDIF", t, func() {
+		m, err := ReadMembersLDIF(strings.NewReader(membersldif))
+		So(err, ShouldBeNil)
+		So(m, ShouldResemble, Members{"@devs": {"alice", "bob"}, "@ops": {"carol", "dave"}, "@empty": {}})
+
+		_, err = ReadMembersLDIF(strings.NewReader("dn: cn=devs\nmember uid=alice\n"))
+		So(err.Error(), ShouldEqual, "Parse Error: 'attr: value' expected instead of 'member uid=alice' in entry ending at line 2")
+	})
+
+	Convey("Group definition lines are rewritten", t, func() {
+		var w bytes.Buffer
+		err := WriteGroups(strings.NewReader(membersconf), &w, map[string][]string{"@devs": {"alice", "eve"}, "@ops": {"carol", "dave"}})
+		So(err, ShouldBeNil)
+		So(w.String(), ShouldEqual, strings.Replace(strings.Replace(membersconf, "alice bob", "alice eve", 1), "=   carol", "=   carol dave", 1))
+
+		w.Reset()
+		So(WriteGroups(strings.NewReader("@a = x\r\n@b = y"), &w, map[string][]string{"@a": {"z"}, "@b": {"t"}}), ShouldBeNil)
+		So(w.String(), ShouldEqual, "@a = z\r\n@b = t")
+
+		err = WriteGroups(strings.NewReader(membersconf), &w, map[string][]string{"@qa": {"x"}, "@dev": {"x"}})
+		So(err.Error(), ShouldEqual, "group(s) '@dev', '@qa' not defined")
+	})
+}
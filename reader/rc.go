@@ -0,0 +1,238 @@
+package reader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/VonC/gogitolite/gitolite"
+)
+
+// rcToken is a lexical element of a gitolite.rc file
+type rcToken struct {
+	s      string
+	quoted bool
+	l      int
+}
+
+// rcValue is a scalar, a list ([...]) or a hash ({...}) of a gitolite.rc file
+type rcValue struct {
+	scalar string
+	list   []string
+	hash   []string
+	kind   byte
+}
+
+type rcParser struct {
+	tokens []*rcToken
+	i      int
+}
+
+// ReadRC reads the common subset of a gitolite.rc file (the %RC Perl hash):
+// UMASK, GIT_CONFIG_KEYS, ROLES, ENABLE and any other scalar value.
+// Nested hashes other than ROLES are ignored.
+func ReadRC(r io.Reader) (*gitolite.RC, error) {
+	tokens, err := rcTokens(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &rcParser{tokens: tokens}
+	for !p.isAt("%RC") {
+		if p.next() == nil {
+			return nil, ParseError{msg: "no %RC hash found in rc file"}
+		}
+	}
+	p.next()
+	if err = p.expect("="); err == nil {
+		err = p.expect("(")
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := gitolite.NewRC()
+	for !p.isAt(")") {
+		key, value, err := p.readKeyValue()
+		if err != nil {
+			return nil, err
+		}
+		if err = setRCValue(rc, key, value); err != nil {
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+func setRCValue(rc *gitolite.RC, key *rcToken, value *rcValue) error {
+	switch key.s {
+	case "UMASK":
+		umask, err := strconv.ParseInt(value.scalar, 0, 32)
+		if err != nil || value.kind != 's' {
+			return ParseError{msg: fmt.Sprintf("Invalid UMASK '%v' at line %v", value.scalar, key.l)}
+		}
+		rc.SetUMask(int(umask))
+	case "GIT_CONFIG_KEYS":
+		if err := rc.SetGitConfigKeys(value.scalar); err != nil {
+			return ParseError{msg: fmt.Sprintf("%v at line %v", err.Error(), key.l)}
+		}
+	case "ROLES":
+		for _, role := range value.hash {
+			rc.AddRole(role)
+		}
+	case "ENABLE":
+		for _, feature := range value.list {
+			rc.Enable(feature)
+		}
+	default:
+		if value.kind == 's' {
+			rc.SetValue(key.s, value.scalar)
+		}
+	}
+	return nil
+}
+
+func (p *rcParser) next() *rcToken {
+	if p.i >= len(p.tokens) {
+		return nil
+	}
+	t := p.tokens[p.i]
+	p.i = p.i + 1
+	return t
+}
+
+func (p *rcParser) isAt(s string) bool {
+	return p.i < len(p.tokens) && !p.tokens[p.i].quoted && p.tokens[p.i].s == s
+}
+
+func (p *rcParser) line() int {
+	if p.i < len(p.tokens) {
+		return p.tokens[p.i].l
+	}
+	if len(p.tokens) > 0 {
+		return p.tokens[len(p.tokens)-1].l
+	}
+	return 0
+}
+
+func (p *rcParser) expect(s string) error {
+	if !p.isAt(s) {
+		return ParseError{msg: fmt.Sprintf("'%v' expected in rc file at line %v", s, p.line())}
+	}
+	p.next()
+	return nil
+}
+
+// skipComma skips an optional ',' (Perl allows trailing commas)
+func (p *rcParser) skipComma() {
+	if p.isAt(",") {
+		p.next()
+	}
+}
+
+func (p *rcParser) readScalar() (*rcToken, error) {
+	t := p.next()
+	if t == nil || (!t.quoted && strings.ContainsAny(t.s, "=,()[]{};")) {
+		return nil, ParseError{msg: fmt.Sprintf("value expected in rc file at line %v", p.line())}
+	}
+	return t, nil
+}
+
+func (p *rcParser) readKeyValue() (*rcToken, *rcValue, error) {
+	key, err := p.readScalar()
+	if err == nil {
+		err = p.expect("=>")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := p.readValue()
+	if err != nil {
+		return nil, nil, err
+	}
+	p.skipComma()
+	return key, value, nil
+}
+
+func (p *rcParser) readValue() (*rcValue, error) {
+	switch {
+	case p.isAt("["):
+		p.next()
+		res := &rcValue{kind: 'l'}
+		for !p.isAt("]") {
+			t, err := p.readScalar()
+			if err != nil {
+				return nil, err
+			}
+			res.list = append(res.list, t.s)
+			p.skipComma()
+		}
+		p.next()
+		return res, nil
+	case p.isAt("{"):
+		p.next()
+		res := &rcValue{kind: 'h'}
+		for !p.isAt("}") {
+			key, _, err := p.readKeyValue()
+			if err != nil {
+				return nil, err
+			}
+			res.hash = append(res.hash, key.s)
+		}
+		p.next()
+		return res, nil
+	}
+	t, err := p.readScalar()
+	if err != nil {
+		return nil, err
+	}
+	return &rcValue{kind: 's', scalar: t.s}, nil
+}
+
+// rcTokens splits a gitolite.rc file in tokens, ignoring comments.
+func rcTokens(r io.Reader) ([]*rcToken, error) {
+	res := []*rcToken{}
+	s := bufio.NewScanner(r)
+	l := 0
+	for s.Scan() {
+		l = l + 1
+		t := []rune(s.Text())
+		for i := 0; i < len(t); {
+			c := t[i]
+			switch {
+			case unicode.IsSpace(c):
+				i = i + 1
+			case c == '#':
+				i = len(t)
+			case c == '\'' || c == '"':
+				j := i + 1
+				value := ""
+				for ; j < len(t) && t[j] != c; j++ {
+					if t[j] == '\\' && j+1 < len(t) && (t[j+1] == c || t[j+1] == '\\') {
+						j = j + 1
+					}
+					value = value + string(t[j])
+				}
+				if j >= len(t) {
+					return nil, ParseError{msg: fmt.Sprintf("unterminated string in rc file at line %v", l)}
+				}
+				res = append(res, &rcToken{s: value, quoted: true, l: l})
+				i = j + 1
+			case c == '=' && i+1 < len(t) && t[i+1] == '>':
+				res = append(res, &rcToken{s: "=>", l: l})
+				i = i + 2
+			case strings.ContainsRune("=,()[]{};", c):
+				res = append(res, &rcToken{s: string(c), l: l})
+				i = i + 1
+			default:
+				j := i
+				for ; j < len(t) && !unicode.IsSpace(t[j]) && !strings.ContainsRune("#=,()[]{};'\"", t[j]); j++ {
+				}
+				res = append(res, &rcToken{s: string(t[i:j]), l: l})
+				i = j
+			}
+		}
+	}
+	return res, s.Err()
+}
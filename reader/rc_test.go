@@ -0,0 +1,114 @@
+package reader
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var gitoliterc = `# configuration variables for gitolite
+
+%RC = (
+
+    # ------------------------------------------------------------------
+
+    # default umask gives you perms of '0700'; see the rc file docs for
+    # how/why you might change this
+    UMASK                           =>  0027,
+
+    # look for "git-config" in the documentation
+    GIT_CONFIG_KEYS                 =>  'core\.sharedRepository hooks\..*',
+
+    # comment out if you don't need all the extra detail in the logfile
+    LOG_EXTRA                       =>  1,
+    SITE_INFO                       =>  "Please see http://example.com/gitolite # for help",
+    LOCAL_CODE                      =>  "$ENV{HOME}/local",
+
+    # roles.  add more roles (like MANAGER, TESTER, ...) here.
+    #   WARNING: if you make changes to this hash, you MUST run 'gitolite
+    #   compile' afterward, and possibly also 'gitolite trigger POST_COMPILE'
+    ROLES => {
+        READERS                     =>  1,
+        WRITERS                     =>  1,
+        'MANAGERS'                  =>  1,
+    },
+
+    SAFE_CONFIG => {
+        DOLLAR => { X => '$' },
+    },
+
+    ENABLE => [
+            'help',
+            'desc',
+            # 'mirror',
+            "D",
+    ],
+);
+
+# ------------------------------------------------------------------------------
+# per perl rules, this should be the last line in such a file:
+1;
+`
+
+func TestReadRC(t *testing.T) {
+
+	Convey("A gitolite.rc can be read", t, func() {
+		rc, err := ReadRC(strings.NewReader(gitoliterc))
+		So(err, ShouldBeNil)
+		So(rc.UMask(), ShouldEqual, 0027)
+		So(rc.GitConfigKeys(), ShouldEqual, `core\.sharedRepository hooks\..*`)
+		So(rc.Roles(), ShouldResemble, []string{"READERS", "WRITERS", "MANAGERS"})
+		So(rc.Enabled(), ShouldResemble, []string{"help", "desc", "D"})
+		So(rc.Value("LOG_EXTRA"), ShouldEqual, "1")
+		So(rc.Value("SITE_INFO"), ShouldEqual, "Please see http://example.com/gitolite # for help")
+		So(rc.Value("LOCAL_CODE"), ShouldEqual, "$ENV{HOME}/local")
+		So(rc.Value("SAFE_CONFIG"), ShouldEqual, "")
+	})
+
+	Convey("An invalid gitolite.rc is detected", t, func() {
+		for _, test := range []struct{ rc, msg string }{
+			{"", "Parse Error: no %RC hash found in rc file"},
+			{"%RC = ( UMASK => 'a', );", "Parse Error: Invalid UMASK 'a' at line 1"},
+			{"%RC = ( UMASK => [ 1 ], );", "Parse Error: Invalid UMASK '' at line 1"},
+			{"%RC = ( GIT_CONFIG_KEYS => 'a(', );", "Parse Error: invalid GIT_CONFIG_KEYS regexp 'a(': error parsing regexp: missing closing ): `(?i)^(?:a()$` at line 1"},
+			{"%RC = (\n UMASK => 'a", "Parse Error: unterminated string in rc file at line 2"},
+			{"%RC ( UMASK => 1 );", "Parse Error: '=' expected in rc file at line 1"},
+			{"%RC = \n UMASK => 1 );", "Parse Error: '(' expected in rc file at line 2"},
+			{"%RC = ( UMASK = 1 );", "Parse Error: '=>' expected in rc file at line 1"},
+			{"%RC = ( UMASK => , );", "Parse Error: value expected in rc file at line 1"},
+			{"%RC = ( ENABLE => [ 'a', ", "Parse Error: value expected in rc file at line 1"},
+		} {
+			rc, err := ReadRC(strings.NewReader(test.rc))
+			So(rc, ShouldBeNil)
+			So(err.Error(), ShouldEqual, test.msg)
+		}
+	})
+
+	Convey("A gitolite.conf is read with its rc", t, func() {
+		test = ""
+		rc, _ := ReadRC(strings.NewReader(gitoliterc))
+		conf := `
+repo gitolite-admin
+    RW+ = admin
+repo foo
+    RW = WRITERS MANAGERS alice
+    config hooks.mailinglist = foo@example.com
+    option deny-rules = 1
+`
+		gtl, err := ReadWithRC(strings.NewReader(conf), rc)
+		So(err, ShouldBeNil)
+		So(gtl.RC(), ShouldEqual, rc)
+		So(gtl.IsRole("MANAGERS"), ShouldBeTrue)
+		So(gtl.IsRole("alice"), ShouldBeFalse)
+		cfg := gtl.GetConfigsForRepo("foo")[0]
+		So(cfg.Option("deny-rules"), ShouldEqual, "1")
+
+		gtl, err = ReadWithRC(strings.NewReader(conf+"    config core.bare = true\n"), rc)
+		So(err.Error(), ShouldEqual, "Parse Error: git config 'core.bare' not allowed, check GIT_CONFIG_KEYS in the rc file, line 8 ('config core.bare = true')")
+
+		sub, err := Update(strings.NewReader("repo bar\n  config core.bare = true\n"), gtl)
+		So(sub.IsRole("WRITERS"), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "Parse Error: git config 'core.bare' not allowed, check GIT_CONFIG_KEYS in the rc file, line 2 ('config core.bare = true')")
+	})
+}
@@ -15,27 +15,59 @@ type content struct {
 	l             int
 	gtl           *gitolite.Gitolite
 	currentConfig *gitolite.Config
+	// currentComment groups the comment lines read since the last group, repo or rule
+	currentComment *gitolite.Comment
 }
 
 type stateFn func(*content) (stateFn, error)
 
 var test = ""
-var currentComment = &gitolite.Comment{}
 
 // Read a gitolite config file
 func Read(r io.Reader) (*gitolite.Gitolite, error) {
 	return Update(r, nil)
 }
 
+// ReadWithRC reads a gitolite config file, honoring a gitolite.rc
+// (allowed 'config' keys, role names)
+func ReadWithRC(r io.Reader, rc *gitolite.RC) (*gitolite.Gitolite, error) {
+	return update(r, nil, rc, "")
+}
+
 // Update a gitolite config file
 func Update(r io.Reader, gtl *gitolite.Gitolite) (*gitolite.Gitolite, error) {
-	res := gitolite.NewGitolite(gtl)
+	res, err := update(r, gtl, nil, "")
+	res.MarkParentGroups()
+	return res, err
+}
+
+// UpdateSubconf reads the subconf 'name' of a gitolite config: group names it
+// defines are prefixed with 'name.', and access set for repos outside of its
+// scope is ignored (see ScopeViolations).
+func UpdateSubconf(r io.Reader, gtl *gitolite.Gitolite, name string) (*gitolite.Gitolite, error) {
+	res, err := ParseSubconf(r, gtl, name)
+	res.MarkParentGroups()
+	return res, err
+}
+
+// ParseSubconf reads the subconf 'name' of a gitolite config like UpdateSubconf,
+// but without modifying gtl, so that several subconfs can be read concurrently:
+// MarkParentGroups must then be called on each subconf, in reading order.
+func ParseSubconf(r io.Reader, gtl *gitolite.Gitolite, name string) (*gitolite.Gitolite, error) {
+	return update(r, gtl, nil, name)
+}
+
+func update(r io.Reader, gtl *gitolite.Gitolite, rc *gitolite.RC, subconf string) (*gitolite.Gitolite, error) {
+	res := gitolite.NewSubconf(gtl, subconf)
+	if rc != nil {
+		res.SetRC(rc)
+	}
 	if r == nil {
 		return res, nil
 	}
 	s := bufio.NewScanner(r)
 	s.Scan()
-	c := &content{s: s, gtl: res, l: 1}
+	c := &content{s: s, gtl: res, l: 1, currentComment: &gitolite.Comment{}}
 	var state stateFn
 	var err error
 	for state, err = readEmptyOrCommentLines(c); state != nil && err == nil; {
@@ -83,7 +115,7 @@ func (pe ParseError) Error() string {
 }
 
 var readEmptyOrCommentLinesRx = regexp.MustCompile(`(?m)^\s*?$|^\s*?#(.*?)$`)
-var readSubconfLinesRx = regexp.MustCompile(`(?m)^\s*?subconf\s+"(.*.conf)"\s*?$`)
+var readSubconfLinesRx = regexp.MustCompile(`(?m)^\s*?subconf\s+(?:([a-zA-Z0-9_.-]+)\s*=\s*)?"(.*.conf)"\s*?$`)
 
 func readEmptyOrCommentLines(c *content) (stateFn, error) {
 	t := c.s.Text()
@@ -98,13 +130,17 @@ func readEmptyOrCommentLines(c *content) (stateFn, error) {
 				}
 				return readRepoOrGroup, nil
 			}
-			err := c.gtl.AddSubconf(t[res[2]:res[3]])
+			name := ""
+			if res[2] > -1 {
+				name = t[res[2]:res[3]]
+			}
+			err := c.gtl.AddNamedSubconf(name, t[res[4]:res[5]], c.l)
 			if err != nil {
-				return nil, ParseError{msg: fmt.Sprintf("Invalid subconf regexp:\n%v at line %v ('%v')", err.Error(), c.l, t)}
+				return nil, ParseError{msg: fmt.Sprintf("Invalid subconf pattern:\n%v at line %v ('%v')", err.Error(), c.l, t)}
 			}
 		} else {
-			currentComment.AddComment(t)
-			//fmt.Println("\nCMT: ", currentComment, "\nGTL: ", c.gtl)
+			c.currentComment.AddComment(t)
+			//fmt.Println("\nCMT: ", c.currentComment, "\nGTL: ", c.gtl)
 		}
 		if !c.s.Scan() {
 			keepReading = false
@@ -145,13 +181,13 @@ func readGroup(c *content) (stateFn, error) {
 	}
 	//fmt.Println(res, "'"+c.s+"'", "'"+c.s[res[2]:res[3]]+"'", "'"+c.s[res[4]:res[5]]+"'")
 	grpname := t[res[2]:res[3]]
-	grpmembers := strings.Split(strings.TrimSpace(t[res[4]:res[5]]), " ")
+	grpmembers := localNames(c.gtl, strings.Split(strings.TrimSpace(t[res[4]:res[5]]), " "))
 	// http://cats.groups.google.com.meowbify.com/forum/#!topic/golang-nuts/-pqkICuokio
 	//fmt.Printf("'%v'\n", grpmembers)
-	if err := c.gtl.AddUserOrRepoGroup(grpname, grpmembers, currentComment); err != nil {
+	if err := c.gtl.AddUserOrRepoGroup(grpname, grpmembers, c.currentComment); err != nil {
 		return nil, ParseError{msg: fmt.Sprintf("%v at line %v ('%v')", err.Error(), c.l, t)}
 	}
-	currentComment = &gitolite.Comment{}
+	c.currentComment = &gitolite.Comment{}
 
 	// fmt.Println("'" + c.s + "'")
 	if !c.s.Scan() {
@@ -161,6 +197,30 @@ func readGroup(c *content) (stateFn, error) {
 	return readEmptyOrCommentLines, nil
 }
 
+// localNames translates names of groups defined in the subconf being read
+// into their prefixed names.
+func localNames(gtl *gitolite.Gitolite, names []string) []string {
+	res := []string{}
+	for _, name := range names {
+		res = append(res, gtl.LocalGroupName(name))
+	}
+	return res
+}
+
+// allowedRepos filters out repos a subconf cannot set access for,
+// recording a scope violation for each of them.
+func allowedRepos(c *content, rpnames []string, t string) []string {
+	res := []string{}
+	for _, rpname := range rpnames {
+		if c.gtl.IsRepoAllowed(rpname) {
+			res = append(res, rpname)
+		} else {
+			c.gtl.AddScopeViolation(fmt.Errorf("subconf '%v' attempting to set access for '%v' at line %v ('%v')", c.gtl.SubconfName(), rpname, c.l, t))
+		}
+	}
+	return res
+}
+
 var readRepoRx = regexp.MustCompile(`(?m)^\s*?repo\s*?((?:@?[a-zA-Z0-9\._-]+\s*?)+)$`)
 
 func readRepo(c *content) (stateFn, error) {
@@ -179,13 +239,23 @@ func readRepo(c *content) (stateFn, error) {
 			return nil, ParseError{msg: fmt.Sprintf("Duplicate repo element name '%v' at line %v ('%v')", val, c.l, t)}
 		}
 	}
+	rpmembers = allowedRepos(c, localNames(c.gtl, rpmembers), t)
+	if len(rpmembers) == 0 {
+		// no repo of the line in the scope of the subconf: its config is skipped
+		c.currentComment = &gitolite.Comment{}
+		if !c.s.Scan() {
+			return nil, nil
+		}
+		c.l = c.l + 1
+		return skipRepoRules, nil
+	}
 	var config *gitolite.Config
-	if cfg, err := c.gtl.AddConfig(rpmembers, currentComment); err == nil {
+	if cfg, err := c.gtl.AddConfig(rpmembers, c.currentComment); err == nil {
 		config = cfg
 	} else {
 		return nil, ParseError{msg: fmt.Sprintf("%v\nAt line %v ('%v')", err.Error(), c.l, t)}
 	}
-	currentComment = &gitolite.Comment{}
+	c.currentComment = &gitolite.Comment{}
 
 	if !c.s.Scan() {
 		return nil, nil
@@ -205,19 +275,34 @@ func readRepoRulesDesc(c *content, config *gitolite.Config, t string) (bool, err
 	if res == nil || len(res) == 0 {
 		return false, nil
 	}
-	if err := config.SetDesc(strings.TrimSpace(t[res[2]:res[3]]), currentComment); err != nil {
+	if err := config.SetDesc(strings.TrimSpace(t[res[2]:res[3]]), c.currentComment); err != nil {
+		return true, ParseError{msg: fmt.Sprintf("%v, line %v ('%v')", err.Error(), c.l, t)}
+	}
+	c.currentComment = &gitolite.Comment{}
+	return true, nil
+}
+
+var repoRuleConfigRx = regexp.MustCompile(`(?m)^(config|option)\s+([^\s=]+)\s*=\s*(.*?)$`)
+
+func readRepoRulesConfig(c *content, config *gitolite.Config, t string) (bool, error) {
+	res := repoRuleConfigRx.FindStringSubmatchIndex(t)
+	if res == nil || len(res) == 0 {
+		return false, nil
+	}
+	option := t[res[2]:res[3]] == "option"
+	if err := c.gtl.AddGitConfig(config, t[res[4]:res[5]], strings.TrimSpace(t[res[6]:res[7]]), option, c.currentComment); err != nil {
 		return true, ParseError{msg: fmt.Sprintf("%v, line %v ('%v')", err.Error(), c.l, t)}
 	}
-	currentComment = &gitolite.Comment{}
+	c.currentComment = &gitolite.Comment{}
 	return true, nil
 }
 
-func readRepoRulesComment(t string) (bool, error) {
+func readRepoRulesComment(c *content, t string) (bool, error) {
 	res := readEmptyOrCommentLinesRx.FindStringSubmatchIndex(t)
 	if res == nil || len(res) == 0 {
 		return false, nil
 	}
-	currentComment.AddComment(t)
+	c.currentComment.AddComment(t)
 	return true, nil
 }
 
@@ -229,7 +314,7 @@ func readRepoRuleGroupUsers(rule *gitolite.Rule, username string, c *content, t
 }
 
 func readRepoRuleUsers(rule *gitolite.Rule, post string, c *content, t string) error {
-	users := strings.Split(post, " ")
+	users := localNames(c.gtl, strings.Split(post, " "))
 	for _, username := range users {
 		if !strings.HasPrefix(username, "@") {
 			if err := c.gtl.AddUserOrGroupToRule(rule, username); err != nil {
@@ -253,11 +338,10 @@ func readRepoRule(c *content, config *gitolite.Config, t string) (bool, error) {
 	post := strings.TrimSpace(t[res[4]:res[5]])
 	if res[6] > -1 {
 		//fmt.Printf("\nreadRepoRuleRx res='%v'\n", res)
-		currentComment.SetSameLine(strings.TrimSpace(t[res[6]:res[7]]))
+		c.currentComment.SetSameLine(strings.TrimSpace(t[res[6]:res[7]]))
 	}
 
 	respre := repoRulePreRx.FindStringSubmatchIndex(pre)
-	fmt.Printf("\nrespre='%v' for '%v'\n", respre, pre)
 	if respre == nil {
 		return true, ParseError{msg: fmt.Sprintf("Incorrect access rule '%v' at line %v ('%v')", pre, c.l, t)}
 	}
@@ -266,13 +350,18 @@ func readRepoRule(c *content, config *gitolite.Config, t string) (bool, error) {
 	if respre[4] > -1 {
 		param = pre[respre[4]:respre[5]]
 	}
-	rule := gitolite.NewRule(access, param, currentComment)
+	if gitolite.IsVREF(param) {
+		if _, err := gitolite.ParseVREF(param); err != nil {
+			return true, ParseError{msg: fmt.Sprintf("%v at line %v ('%v')", err.Error(), c.l, t)}
+		}
+	}
+	rule := gitolite.NewRule(access, param, c.currentComment)
 	err := readRepoRuleUsers(rule, post, c, t)
 	if err != nil {
 		return true, err
 	}
 	c.gtl.AddRuleToConfig(rule, config)
-	currentComment = &gitolite.Comment{}
+	c.currentComment = &gitolite.Comment{}
 
 	if strings.HasPrefix(param, "VREF/NAME/conf/subs/") {
 		repogrpname := "@" + param[len("VREF/NAME/conf/subs/"):]
@@ -294,6 +383,25 @@ func readRepoRule(c *content, config *gitolite.Config, t string) (bool, error) {
 	return true, nil
 }
 
+// skipRepoRules skips the desc, config and rule lines of a repo config,
+// and the comments before them.
+func skipRepoRules(c *content) (stateFn, error) {
+	for {
+		t := strings.TrimSpace(c.s.Text())
+		if readEmptyOrCommentLinesRx.MatchString(t) {
+			c.currentComment.AddComment(t)
+		} else if repoRuleDescRx.MatchString(t) || repoRuleConfigRx.MatchString(t) || readRepoRuleRx.MatchString(t) {
+			c.currentComment = &gitolite.Comment{}
+		} else {
+			return readEmptyOrCommentLines, nil
+		}
+		if !c.s.Scan() {
+			return nil, nil
+		}
+		c.l = c.l + 1
+	}
+}
+
 func readRepoRules(c *content) (stateFn, error) {
 	t := strings.TrimSpace(c.s.Text())
 	//fmt.Printf("readRepoRules '%v'\n", t)
@@ -303,7 +411,10 @@ func readRepoRules(c *content) (stateFn, error) {
 		//fmt.Printf("readRepoRules '%v'\n", t)
 		lineProcessed, err := readRepoRulesDesc(c, config, t)
 		if !lineProcessed {
-			lineProcessed, err = readRepoRulesComment(t)
+			lineProcessed, err = readRepoRulesConfig(c, config, t)
+		}
+		if !lineProcessed {
+			lineProcessed, err = readRepoRulesComment(c, t)
 		}
 		if !lineProcessed {
 			lineProcessed, err = readRepoRule(c, config, t)
@@ -313,7 +424,7 @@ func readRepoRules(c *content) (stateFn, error) {
 			return nil, err
 		}
 		if !lineProcessed {
-			if len(config.Rules()) == 0 {
+			if len(config.Rules()) == 0 && len(config.GitConfigs()) == 0 {
 				return nil, ParseError{msg: fmt.Sprintf("At least one access rule expected at line %v ('%v')", c.l, t)}
 			}
 			break
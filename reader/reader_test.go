@@ -1,6 +1,7 @@
 package reader
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"testing"
@@ -583,6 +584,98 @@ repo otherRepo
 
 	})
 
+	Convey("A Gitolite detects invalid VREF rules", t, func() {
+		test = ""
+		r := strings.NewReader(`
+					repo foo
+					RW = user
+					- VREF/COUNT/a = user
+`)
+		_, err := Read(r)
+		So(err.Error(), ShouldEqual, "Parse Error: invalid VREF COUNT limit 'a' at line 4 ('- VREF/COUNT/a = user')")
+	})
+
+	Convey("A Gitolite subconf is scoped by its name", t, func() {
+		test = "ignorega"
+		gtl, err := Read(strings.NewReader(`
+					@foo = foo-app foo-lib
+					@devs = alice
+					repo gitolite-admin
+					RW+ = admin
+`))
+		So(err, ShouldBeNil)
+		sub, err := UpdateSubconf(strings.NewReader(`
+					@devs = bob carol
+					@libs = foo-lib
+					repo foo-app gitolite-admin
+					RW = @devs
+					repo @libs
+					RW = @devs
+					# all read foo
+					repo @foo foo
+					R = @all
+`), gtl, "foo")
+		So(err, ShouldBeNil)
+		So(sub.SubconfName(), ShouldEqual, "foo")
+		So(sub.GetGroup("@foo.devs").GetMembers(), ShouldResemble, []string{"bob", "carol"})
+		So(sub.Configs()[0].Rules()[0].String(), ShouldEqual, "RW  = @foo.devs (bob, carol)")
+		So(len(sub.GetConfigsForRepo("foo-app")), ShouldEqual, 2)
+		So(len(sub.GetConfigsForRepo("gitolite-admin")), ShouldEqual, 0)
+		So(len(sub.GetConfigsForRepo("foo-lib")), ShouldEqual, 2)
+		So(len(sub.ScopeViolations()), ShouldEqual, 1)
+		So(sub.ScopeViolations()[0].Error(), ShouldEqual, "subconf 'foo' attempting to set access for 'gitolite-admin' at line 4 ('repo foo-app gitolite-admin')")
+		So(gtl.GetGroup("@devs").GetMembers(), ShouldResemble, []string{"alice"})
+		So(len(sub.Configs()), ShouldEqual, 3)
+		So(sub.Configs()[0].Print(), ShouldEqual, "repo foo-app\n    RW    = @foo.devs\n\n")
+		So(sub.Configs()[1].Print(), ShouldEqual, "repo @foo.libs\n    RW    = @foo.devs\n\n")
+		So(sub.Configs()[2].Print(), ShouldEqual, "# all read foo\nrepo @foo foo\n    R     = @all\n\n")
+	})
+
+	Convey("A Gitolite can read config and option lines", t, func() {
+		test = "ignorega"
+		r := strings.NewReader(`
+					repo foo
+					# mailing list
+					config hooks.mailinglist = foo@example.com # same line
+					RW = user
+					option deny-rules = 1
+					R = guest
+					repo bar
+					config core.sharedRepository =
+`)
+		gtl, err := Read(r)
+		So(err, ShouldBeNil)
+		cfg := gtl.GetConfigsForRepo("foo")[0]
+		So(len(cfg.GitConfigs()), ShouldEqual, 2)
+		So(cfg.Option("deny-rules"), ShouldEqual, "1")
+		cfg = gtl.GetConfigsForRepo("bar")[0]
+		So(len(cfg.Rules()), ShouldEqual, 0)
+		So(cfg.GitConfigs()[0].Value(), ShouldEqual, "")
+		So(gtl.Print(), ShouldEqual, `
+repo foo
+    # mailing list
+    config hooks.mailinglist = foo@example.com # same line
+    RW    = user
+    option deny-rules = 1
+    R     = guest
+
+repo bar
+    config core.sharedRepository = 
+
+`)
+		gtl, err = Read(strings.NewReader(gtl.Print()))
+		So(err, ShouldBeNil)
+		So(gtl.GetConfigsForRepo("foo")[0].Print(), ShouldEqual, `
+repo foo
+    # mailing list
+    config hooks.mailinglist = foo@example.com # same line
+    RW    = user
+    option deny-rules = 1
+    R     = guest
+
+`)
+	})
+
 	Convey("A Gitolite can read subconfs", t, func() {
 		test = "ignorega"
 
@@ -600,15 +693,15 @@ repo otherRepo
 		Convey("A Gitolite detect invalid subconf line~regexp", func() {
 			r := strings.NewReader(`
 						# comment
-						subconf "subs/(*.conf"
+						subconf "subs/[*.conf"
 `)
 			gtl, err := Read(r)
 			So(err, ShouldNotBeNil)
-			So(strings.HasPrefix(err.Error(), "Parse Error: Invalid subconf regexp"), ShouldBeTrue)
+			So(strings.HasPrefix(err.Error(), "Parse Error: Invalid subconf pattern"), ShouldBeTrue)
 			So(len(gtl.Subconfs()), ShouldEqual, 0)
 		})
 
-		Convey("A Gitolite detect invalid subconf line", func() {
+		Convey("A Gitolite ignores duplicate subconf lines", func() {
 			r := strings.NewReader(`
 						# comment
 						subconf "subs/*.conf"
@@ -619,6 +712,107 @@ repo otherRepo
 			So(len(gtl.Subconfs()), ShouldEqual, 2)
 		})
 
+		Convey("A Gitolite reads named subconf lines", func() {
+			r := strings.NewReader(`
+						subconf "subs/*.conf"
+						subconf foo = "foo/main.conf"
+						subconf bar="bar.conf"
+`)
+			gtl, _ := Read(r)
+			So(len(gtl.Subconfs()), ShouldEqual, 3)
+			So(gtl.Subconfs()[0].Name(), ShouldEqual, "")
+			So(gtl.Subconfs()[1].Name(), ShouldEqual, "foo")
+			So(gtl.Subconfs()[1].Pattern(), ShouldEqual, "foo/main.conf")
+			So(gtl.Subconfs()[1].Line(), ShouldEqual, 3)
+			So(gtl.Subconfs()[2].String(), ShouldEqual, `subconf bar = "bar.conf"`)
+		})
+
+		Convey("A Gitolite detect a subconf name without '='", func() {
+			gtl, err := Read(strings.NewReader(`
+						subconf foo "x.conf"
+`))
+			So(err, ShouldNotBeNil)
+			So(strings.HasPrefix(err.Error(), "Parse Error: Invalid subconf at line 2"), ShouldBeTrue)
+			So(len(gtl.Subconfs()), ShouldEqual, 0)
+		})
+
+		Convey("A Gitolite subconf can include subconfs", func() {
+			gtl, _ := Read(strings.NewReader("@foo = foo-app\n"))
+			sub, err := UpdateSubconf(strings.NewReader(`
+						subconf "foo/*.conf"
+						repo foo-app
+						RW = alice
+`), gtl, "foo")
+			So(err, ShouldBeNil)
+			So(sub.Subconfs()[0].Pattern(), ShouldEqual, "foo/*.conf")
+		})
+
 	})
 
 }
+
+// genConf generates a config with nbRepos repos and nbUsers users:
+// users are in teams of 30, repos in groups of 100, and each repo
+// has its own config, with rules for a team and two users.
+func genConf(nbRepos, nbUsers int) string {
+	var b bytes.Buffer
+	b.WriteString("repo gitolite-admin\n    RW+ = admin\n\n")
+	nbTeams := nbUsers / 30
+	for t := 0; t < nbTeams; t++ {
+		fmt.Fprintf(&b, "@team%d =", t)
+		for u := t * 30; u < (t+1)*30; u++ {
+			fmt.Fprintf(&b, " u%d", u)
+		}
+		b.WriteString("\n")
+	}
+	nbGroups := nbRepos / 100
+	for g := 0; g < nbGroups; g++ {
+		fmt.Fprintf(&b, "@grp%d =", g)
+		for r := g * 100; r < (g+1)*100; r++ {
+			fmt.Fprintf(&b, " r%d", r)
+		}
+		b.WriteString("\n")
+	}
+	for r := 0; r < nbRepos; r++ {
+		fmt.Fprintf(&b, "repo r%d\n    RW+ = @team%d\n    RW = u%d\n    R = u%d\n", r, r%nbTeams, r%nbUsers, (r*7)%nbUsers)
+	}
+	for g := 0; g < nbGroups; g++ {
+		fmt.Fprintf(&b, "repo @grp%d\n    R = @team%d\n", g, g%nbTeams)
+	}
+	return b.String()
+}
+
+func TestReadLarge(t *testing.T) {
+
+	Convey("A large config is read with all its repos and users", t, func() {
+		gtl, err := Read(strings.NewReader(genConf(2000, 600)))
+		So(err, ShouldBeNil)
+		So(gtl.NbRepos(), ShouldEqual, 2001)
+		So(gtl.NbUsers(), ShouldEqual, 601)
+		So(gtl.NbRepoGroups(), ShouldEqual, 20)
+		So(gtl.NbUserGroups(), ShouldEqual, 20)
+		So(gtl.NbConfigs(), ShouldEqual, 2021)
+		So(len(gtl.GetConfigsForRepo("r150")), ShouldEqual, 2)
+		So(len(gtl.RulesForRepo("r150")), ShouldEqual, 4)
+
+		clone := gtl.Clone()
+		So(clone.Print(), ShouldEqual, gtl.Print())
+		So(clone.String(), ShouldEqual, gtl.String())
+		So(clone.NbUsers(), ShouldEqual, 601)
+		So(len(clone.RulesForRepo("r150")), ShouldEqual, 4)
+	})
+
+}
+
+func benchmarkRead(b *testing.B, nbRepos, nbUsers int) {
+	conf := genConf(nbRepos, nbUsers)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Read(strings.NewReader(conf)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRead1k(b *testing.B)  { benchmarkRead(b, 1000, 300) }
+func BenchmarkRead10k(b *testing.B) { benchmarkRead(b, 10000, 3000) }